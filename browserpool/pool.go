@@ -0,0 +1,301 @@
+// Package browserpool shares a small number of headless Chrome processes
+// between scraping workers, so a browser is not launched for every task.
+package browserpool
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/go-rod/rod"
+	"github.com/go-rod/rod/lib/launcher"
+	"github.com/go-rod/rod/lib/proto"
+)
+
+// healthTimeout bounds the health check of a browser, which runs while the
+// pool is locked
+const healthTimeout = 5 * time.Second
+
+// Options configures a Pool
+type Options struct {
+	Browsers        int    // Number of browser processes
+	PagesPerBrowser int    // Pages each browser may have open at the same time
+	MaxUses         int    // Recycle a browser after handing out this many pages, 0 disables recycling
+	Bin             string // Optional path to the Chrome binary, rod finds or downloads one when empty
+}
+
+// Pool hands out pages from a fixed set of browsers. Browsers are launched
+// lazily, checked before use and replaced when they die or reach MaxUses.
+type Pool struct {
+	opts  Options
+	slots chan struct{}
+
+	mu       sync.Mutex
+	browsers []*pooledBrowser
+	pages    map[*rod.Page]*pooledBrowser
+	closed   bool
+}
+
+// pooledBrowser is a browser process and its usage counters. It is added to
+// the pool before its process starts, so pages can be reserved on it while
+// it launches.
+type pooledBrowser struct {
+	launcher *launcher.Launcher
+	browser  *rod.Browser
+	ready    chan struct{} // Closed once the launch finished
+	err      error         // Launch error, set before ready is closed
+	inUse    int           // Open and reserved pages
+	uses     int
+	retired  bool // Replaced in the pool, closed once its last page is released
+}
+
+// New creates a pool. No browser is launched until the first page is requested.
+func New(opts Options) *Pool {
+	if opts.Browsers < 1 {
+		opts.Browsers = 1
+	}
+	if opts.PagesPerBrowser < 1 {
+		opts.PagesPerBrowser = 1
+	}
+
+	size := opts.Browsers * opts.PagesPerBrowser
+	slots := make(chan struct{}, size)
+	for i := 0; i < size; i++ {
+		slots <- struct{}{}
+	}
+
+	return &Pool{
+		opts:     opts,
+		slots:    slots,
+		browsers: make([]*pooledBrowser, opts.Browsers),
+		pages:    make(map[*rod.Page]*pooledBrowser),
+	}
+}
+
+// Size returns the number of pages that can be in use at the same time
+func (p *Pool) Size() int {
+	return cap(p.slots)
+}
+
+// Acquire waits for a free slot and opens a new page on the least busy
+// browser. The page must be given back with Release.
+func (p *Pool) Acquire(ctx context.Context) (*rod.Page, error) {
+	select {
+	case <-p.slots:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	page, err := p.open()
+	if err != nil {
+		p.slots <- struct{}{}
+		return nil, err
+	}
+	return page, nil
+}
+
+// open creates a page on the least busy healthy browser. A browser that has
+// to be launched is reserved under the lock and started without it, so other
+// workers are not blocked while Chrome starts.
+func (p *Pool) open() (*rod.Page, error) {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil, fmt.Errorf("browser pool is closed")
+	}
+
+	// Pick the browser with the fewest open pages. A free slot guarantees at
+	// least one browser is below PagesPerBrowser.
+	index := -1
+	for i, pb := range p.browsers {
+		if pb != nil && pb.inUse >= p.opts.PagesPerBrowser {
+			continue
+		}
+		if index == -1 || inUse(pb) < inUse(p.browsers[index]) {
+			index = i
+		}
+	}
+	if index == -1 {
+		p.mu.Unlock()
+		return nil, fmt.Errorf("no browser available")
+	}
+
+	pb := p.browsers[index]
+	if pb != nil && pb.inUse == 0 && !pb.healthy() {
+		pb.close()
+		pb = nil
+	}
+	start := pb == nil
+	if start {
+		pb = &pooledBrowser{ready: make(chan struct{})}
+		p.browsers[index] = pb
+	}
+	pb.inUse++
+	p.mu.Unlock()
+
+	if start {
+		pb.launcher, pb.browser, pb.err = p.launch()
+		close(pb.ready)
+	} else {
+		<-pb.ready
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if pb.err != nil || p.closed {
+		p.unreserve(index, pb)
+		if pb.err != nil {
+			return nil, pb.err
+		}
+		return nil, fmt.Errorf("browser pool is closed")
+	}
+
+	page, err := pb.browser.Page(proto.TargetCreateTarget{})
+	if err != nil {
+		// The browser is probably gone, replace it on the next request
+		p.unreserve(index, pb)
+		if p.browsers[index] == pb {
+			p.retire(index)
+		}
+		return nil, fmt.Errorf("failed to open page: %w", err)
+	}
+
+	pb.uses++
+	p.pages[page] = pb
+	if p.opts.MaxUses > 0 && pb.uses >= p.opts.MaxUses && p.browsers[index] == pb {
+		p.retire(index)
+	}
+	return page, nil
+}
+
+// unreserve gives back a page reserved on the browser at index. A browser
+// that failed to launch leaves the pool, and a retired one is closed with
+// its last page.
+func (p *Pool) unreserve(index int, pb *pooledBrowser) {
+	pb.inUse--
+	if pb.err != nil {
+		if p.browsers[index] == pb {
+			p.browsers[index] = nil
+		}
+		return
+	}
+	if pb.retired && pb.inUse == 0 {
+		pb.close()
+	}
+}
+
+// Release closes the page and frees its slot
+func (p *Pool) Release(page *rod.Page) {
+	p.mu.Lock()
+	pb, ok := p.pages[page]
+	if !ok {
+		p.mu.Unlock()
+		return
+	}
+	delete(p.pages, page)
+	pb.inUse--
+	closeBrowser := pb.retired && pb.inUse == 0
+	p.mu.Unlock()
+
+	page.Close()
+	if closeBrowser {
+		pb.close()
+	}
+	p.slots <- struct{}{}
+}
+
+// Close shuts down every browser of the pool. Pages still in use are
+// closed together with their browser.
+func (p *Pool) Close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.closed = true
+	closed := map[*pooledBrowser]bool{}
+	for _, pb := range p.pages {
+		closed[pb] = true
+	}
+	for _, pb := range p.browsers {
+		if pb != nil {
+			closed[pb] = true
+		}
+	}
+	for pb := range closed {
+		// A browser still launching is closed by the worker that started it
+		if pb.launched() {
+			pb.close()
+		} else {
+			pb.retired = true
+		}
+	}
+	p.browsers = make([]*pooledBrowser, p.opts.Browsers)
+}
+
+// retire removes the browser at index from the pool. It is closed right away
+// when idle, otherwise when its last page is released.
+func (p *Pool) retire(index int) {
+	pb := p.browsers[index]
+	p.browsers[index] = nil
+	pb.retired = true
+	if pb.inUse == 0 {
+		pb.close()
+	}
+}
+
+// launch starts a new browser process and connects to it
+func (p *Pool) launch() (*launcher.Launcher, *rod.Browser, error) {
+	l := launcher.New().
+		Headless(true).
+		Devtools(false)
+	if p.opts.Bin != "" {
+		l = l.Bin(p.opts.Bin)
+	}
+
+	url, err := l.Launch()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to launch browser: %w", err)
+	}
+
+	browser := rod.New().ControlURL(url)
+	if err := browser.Connect(); err != nil {
+		l.Kill()
+		return nil, nil, fmt.Errorf("failed to connect to browser: %w", err)
+	}
+
+	return l, browser, nil
+}
+
+// launched reports whether the browser process started successfully
+func (pb *pooledBrowser) launched() bool {
+	select {
+	case <-pb.ready:
+		return pb.err == nil
+	default:
+		return false
+	}
+}
+
+// healthy reports whether the browser still answers over the devtools protocol
+// within healthTimeout
+func (pb *pooledBrowser) healthy() bool {
+	_, err := pb.browser.Timeout(healthTimeout).Version()
+	return err == nil
+}
+
+// close shuts down the browser process and removes its profile directory
+func (pb *pooledBrowser) close() {
+	if err := pb.browser.Close(); err != nil {
+		pb.launcher.Kill()
+	}
+	pb.launcher.Cleanup()
+}
+
+// inUse returns the number of open pages of a possibly not yet launched browser
+func inUse(pb *pooledBrowser) int {
+	if pb == nil {
+		return 0
+	}
+	return pb.inUse
+}
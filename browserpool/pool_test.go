@@ -0,0 +1,133 @@
+package browserpool
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-rod/rod/lib/launcher"
+)
+
+// newTestPool creates a pool of the Chrome installed on the machine, skipping
+// the test when there is none
+func newTestPool(t *testing.T, opts Options) *Pool {
+	t.Helper()
+	bin, found := launcher.LookPath()
+	if !found {
+		t.Skip("no Chrome or Chromium installed")
+	}
+	opts.Bin = bin
+	pool := New(opts)
+	t.Cleanup(pool.Close)
+	return pool
+}
+
+func TestAcquireWaitsForSlot(t *testing.T) {
+	pool := New(Options{})
+	<-pool.slots
+
+	// No browser is launched while every slot is taken
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := pool.Acquire(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Acquire() error = %v, want context.DeadlineExceeded", err)
+	}
+	if pool.browsers[0] != nil {
+		t.Error("a browser was launched without a free slot")
+	}
+}
+
+func TestAcquireClosed(t *testing.T) {
+	pool := New(Options{Browsers: 2, PagesPerBrowser: 2})
+	pool.Close()
+
+	if _, err := pool.Acquire(context.Background()); err == nil {
+		t.Fatal("Acquire() on a closed pool succeeded")
+	}
+	if len(pool.slots) != pool.Size() {
+		t.Errorf("%d free slots after a failed Acquire, want %d", len(pool.slots), pool.Size())
+	}
+}
+
+func TestAcquireLaunchFails(t *testing.T) {
+	pool := New(Options{Browsers: 1, PagesPerBrowser: 2, Bin: filepath.Join(t.TempDir(), "chrome")})
+	defer pool.Close()
+
+	// A failed launch gives back its slot and leaves no browser behind
+	for i := 0; i < 2; i++ {
+		if _, err := pool.Acquire(context.Background()); err == nil {
+			t.Fatal("Acquire() with a missing Chrome binary succeeded")
+		}
+		if pool.browsers[0] != nil {
+			t.Errorf("attempt %d: the failed browser stayed in the pool", i)
+		}
+		if len(pool.slots) != pool.Size() {
+			t.Errorf("attempt %d: %d free slots, want %d", i, len(pool.slots), pool.Size())
+		}
+	}
+}
+
+func TestMaxUses(t *testing.T) {
+	pool := newTestPool(t, Options{Browsers: 1, PagesPerBrowser: 1, MaxUses: 2})
+
+	page, err := pool.Acquire(context.Background())
+	if err != nil {
+		t.Fatalf("Acquire failed: %v", err)
+	}
+	first := pool.browsers[0]
+	pool.Release(page)
+
+	// The second page retires the browser, which closes with that page
+	page, err = pool.Acquire(context.Background())
+	if err != nil {
+		t.Fatalf("Acquire failed: %v", err)
+	}
+	if pool.pages[page] != first || pool.browsers[0] != nil || !first.retired {
+		t.Fatalf("the browser was not retired after %d uses", first.uses)
+	}
+	if !first.healthy() {
+		t.Fatal("the retired browser closed while its page was in use")
+	}
+	pool.Release(page)
+	if first.healthy() {
+		t.Error("the retired browser was not closed once its last page was released")
+	}
+
+	// The next page is opened on a new browser
+	page, err = pool.Acquire(context.Background())
+	if err != nil {
+		t.Fatalf("Acquire failed: %v", err)
+	}
+	defer pool.Release(page)
+	if second := pool.pages[page]; second == first || second.uses != 1 {
+		t.Errorf("page opened on browser %+v, want a new one", second)
+	}
+}
+
+func TestClose(t *testing.T) {
+	pool := newTestPool(t, Options{Browsers: 2, PagesPerBrowser: 1})
+
+	var browsers []*pooledBrowser
+	for i := 0; i < pool.Size(); i++ {
+		page, err := pool.Acquire(context.Background())
+		if err != nil {
+			t.Fatalf("Acquire failed: %v", err)
+		}
+		browsers = append(browsers, pool.pages[page])
+	}
+	if browsers[0] == browsers[1] {
+		t.Fatal("both pages were opened on the same browser")
+	}
+
+	// Browsers with pages in use are closed as well
+	pool.Close()
+	for i, pb := range browsers {
+		if pb.healthy() {
+			t.Errorf("browser %d still answers after Close", i)
+		}
+	}
+	if _, err := pool.Acquire(context.Background()); err == nil {
+		t.Error("Acquire() after Close succeeded")
+	}
+}
@@ -2,212 +2,187 @@ package main
 
 import (
 	"context"
-	"encoding/csv"
+	"encoding/json"
 	"fmt"
+	"io"
 	"log"
 	"os"
-	"regexp"
+	"os/signal"
 	"strings"
 	"sync"
+	"syscall"
 	"time"
 
-	"github.com/go-rod/rod"
-	"github.com/go-rod/rod/lib/launcher"
 	"github.com/schollz/progressbar/v3"
 	"github.com/spf13/cobra"
+
+	"mapsscrap/browserpool"
+	"mapsscrap/mapsurl"
+	"mapsscrap/phone"
+	"mapsscrap/pipeline"
+	"mapsscrap/progress"
+	"mapsscrap/scraper"
+	"mapsscrap/website"
 )
 
 const (
 	maxPhoneWorkers = 3 // Número máximo de workers concurrentes para teléfonos
 	phoneTimeout    = 30 * time.Second
+	phoneBrowserMaxUses = 50 // Páginas abiertas antes de reiniciar el navegador
+	reviewsTimeout  = 3 * time.Minute // Abrir, ordenar y desplazar las reseñas de un lugar
+	maxWebWorkers   = 8 // Sitios web leídos a la vez, sin navegador
+	websiteTimeout  = 2 * time.Minute // Leer todas las páginas de un sitio
 )
 
 // PhoneScraper estructura para el scraper de teléfonos de Google Maps
 type PhoneScraper struct {
-	browser *rod.Browser
+	pool      *browserpool.Pool
+	selectors *scraper.Profile
+	phones    *pipeline.Phones // Etapa de teléfonos del pipeline, sobre el mismo pool
 }
 
 // PlaceWithPhone representa un lugar con su información de teléfono
-type PlaceWithPhone struct {
-	Name      string
-	Address   string
-	Stars     string
-	Reviews   string
-	Phone     string
-	Hours     string
-	Website   string
-	GoogleURL string
-	ScrapedPhone string // Nuevo campo para el teléfono extraído
-}
+type PlaceWithPhone = pipeline.PlaceWithPhone
+
+// PanelPhone es el teléfono del panel de un lugar en Google Maps junto con su
+// enlace de WhatsApp
+type PanelPhone = pipeline.PanelPhone
 
 // NewPhoneScraper crea una nueva instancia del scraper de teléfonos
 func NewPhoneScraper() (*PhoneScraper, error) {
 	// Configurar el navegador para usar Google Chrome preinstalado
 	chromePath := "/usr/bin/google-chrome"
 	log.Printf("Verificando la existencia de Google Chrome en: %s", chromePath)
+	if _, ok := phone.Lookup(region); !ok {
+		return nil, fmt.Errorf("región %q desconocida, se esperaba una de %s", region, strings.Join(phone.Regions(), ", "))
+	}
+	if minConfidence < 0 || minConfidence > 1 {
+		return nil, fmt.Errorf("--min-confidence debe estar entre 0 y 1")
+	}
 	if _, err := os.Stat(chromePath); os.IsNotExist(err) {
 		log.Printf("❌ Google Chrome no encontrado en %s", chromePath)
 		return nil, fmt.Errorf("Google Chrome no está instalado en el entorno")
 	}
 
 	log.Printf("✅ Google Chrome encontrado en %s", chromePath)
-	browser := rod.New().ControlURL(launcher.New().Bin(chromePath).MustLaunch()).MustConnect()
+
+	// Perfil de selectores, el incluido en el binario si no se indica otro
+	selectors, err := scraper.LoadProfile(selectorsPath)
+	if err != nil {
+		return nil, err
+	}
+	if selectorsPath != "" {
+		log.Printf("🎯 Perfil de selectores %s (versión %s)", selectorsPath, selectors.Version)
+	}
+
+	// Un solo navegador con una pestaña por worker, reiniciado periódicamente
+	pool := browserpool.New(browserpool.Options{
+		Browsers:        1,
+		PagesPerBrowser: maxPhoneWorkers,
+		MaxUses:         phoneBrowserMaxUses,
+		Bin:             chromePath,
+	})
 	
 	return &PhoneScraper{
-		browser: browser,
+		pool:      pool,
+		selectors: selectors,
+		phones: &pipeline.Phones{
+			Pool:          pool,
+			Selectors:     selectors,
+			Region:        strings.ToUpper(region),
+			MinConfidence: minConfidence,
+			Workers:       maxPhoneWorkers,
+			Timeout:       phoneTimeout,
+		},
 	}, nil
 }
 
-// Close cierra el navegador
+// Close cierra los navegadores del pool
 func (ps *PhoneScraper) Close() {
-	if ps.browser != nil {
-		ps.browser.Close()
+	if ps.pool != nil {
+		ps.pool.Close()
 	}
 }
 
-// ExtractPhoneFromGoogleMapsURL extrae el teléfono de una URL específica de Google Maps
-func (ps *PhoneScraper) ExtractPhoneFromGoogleMapsURL(url string) (string, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), phoneTimeout)
-	defer cancel()
-
-	page := ps.browser.MustPage()
-	defer page.Close()
-
-	// Navegar a la URL de Google Maps
-	if err := page.Navigate(url); err != nil {
-		return "", fmt.Errorf("failed to navigate to URL: %w", err)
-	}
+// ExtractPhoneFromGoogleMapsURL extrae el teléfono de una URL específica de Google Maps,
+// con la regla que lo encontró y su confianza, y el enlace de WhatsApp del panel.
+// El enlace se devuelve aunque no se encuentre el teléfono.
+func (ps *PhoneScraper) ExtractPhoneFromGoogleMapsURL(url string) (PanelPhone, error) {
+	return ps.phones.Find(context.Background(), url)
+}
 
-	// Esperar a que la página se cargue completamente
-	page.MustWaitStable()
-	time.Sleep(2 * time.Second)
+// ExtractReviews extrae las reseñas de un lugar con el orden y límite indicados
+func (ps *PhoneScraper) ExtractReviews(place scraper.Place, options scraper.ReviewOptions) ([]scraper.Review, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), reviewsTimeout)
+	defer cancel()
 
-	// Buscar el teléfono usando múltiples estrategias
-	phone, err := ps.findPhoneWithTimeout(page, ctx)
+	page, err := ps.pool.Acquire(ctx)
 	if err != nil {
-		return "", err
+		return nil, fmt.Errorf("failed to get browser page: %w", err)
 	}
+	defer ps.pool.Release(page)
 
-	return phone, nil
+	return scraper.FetchReviews(page.Context(ctx), place, ps.selectors, options)
 }
 
-// findPhoneWithTimeout busca el teléfono con timeout
-func (ps *PhoneScraper) findPhoneWithTimeout(page *rod.Page, ctx context.Context) (string, error) {
-	done := make(chan string, 1)
-	errChan := make(chan error, 1)
-
-	go func() {
-		phone := ps.findPhoneNumber(page)
-		if phone != "" {
-			done <- phone
-		} else {
-			errChan <- fmt.Errorf("no phone found")
-		}
-	}()
-
-	select {
-	case phone := <-done:
-		return phone, nil
-	case err := <-errChan:
-		return "", err
-	case <-ctx.Done():
-		return "", fmt.Errorf("timeout finding phone")
-	}
-}
+// ProcessReviews extrae las reseñas de los lugares con workers concurrentes y
+// las escribe en output como NDJSON, una reseña por línea, a medida que cada
+// lugar termina. Devuelve el número de reseñas escritas.
+func ProcessReviews(ps *PhoneScraper, places []scraper.Place, options scraper.ReviewOptions, output io.Writer) (int, error) {
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	encoder := json.NewEncoder(output)
+	written := 0
+	var writeErr error
 
-// findPhoneNumber busca el número de teléfono usando múltiples estrategias
-func (ps *PhoneScraper) findPhoneNumber(page *rod.Page) string {
-	// Estrategia 1: Buscar por botón con atributo data-item-id que contiene "phone"
-	if phoneElements, err := page.Elements("button[data-item-id*='phone']"); err == nil && len(phoneElements) > 0 {
-		for _, element := range phoneElements {
-			if dataItemId, err := element.Attribute("data-item-id"); err == nil && dataItemId != nil {
-				if strings.Contains(*dataItemId, "phone:tel:") {
-					phoneFromAttr := strings.Replace(*dataItemId, "phone:tel:", "", 1)
-					return ps.formatPhone(phoneFromAttr)
-				}
-			}
-			
-			// También buscar en el texto del botón
-			if text, err := element.Text(); err == nil {
-				if extractedPhone := ps.extractPhoneFromText(text); extractedPhone != "" {
-					return extractedPhone
-				}
-			}
-		}
-	}
+	semaphore := make(chan struct{}, maxPhoneWorkers)
 
-	// Estrategia 2: Buscar por aria-label que contenga "Teléfono"
-	if phoneElements, err := page.Elements("button[aria-label*='Teléfono']"); err == nil && len(phoneElements) > 0 {
-		for _, element := range phoneElements {
-			if ariaLabel, err := element.Attribute("aria-label"); err == nil && ariaLabel != nil {
-				if extractedPhone := ps.extractPhoneFromText(*ariaLabel); extractedPhone != "" {
-					return extractedPhone
-				}
-			}
-		}
-	}
+	// La barra va a stderr para no mezclarse con el NDJSON en stdout
+	bar := progressbar.NewOptions(len(places),
+		progressbar.OptionSetWriter(os.Stderr),
+		progressbar.OptionSetDescription("💬 Extrayendo reseñas..."),
+		progressbar.OptionShowCount(),
+		progressbar.OptionSetPredictTime(true),
+	)
 
-	// Estrategia 3: Buscar por clase CSS específica del número
-	if phoneElements, err := page.Elements(".Io6YTe.fontBodyMedium.kR99db.fdkmkc"); err == nil && len(phoneElements) > 0 {
-		for _, element := range phoneElements {
-			if text, err := element.Text(); err == nil {
-				text = strings.TrimSpace(text)
-				if ps.isPhoneNumber(text) {
-					return text
-				}
-			}
-		}
-	}
+	for _, place := range places {
+		wg.Add(1)
+		go func(place scraper.Place) {
+			defer wg.Done()
 
-	return ""
-}
+			semaphore <- struct{}{}
+			defer func() { <-semaphore }()
 
-// extractPhoneFromText extrae números de teléfono de un texto
-func (ps *PhoneScraper) extractPhoneFromText(text string) string {
-	// Patrón regex para números de teléfono mexicanos con +52
-	mexicanPhoneRegex := regexp.MustCompile(`\+?52\s?\d{3}\s?\d{3}\s?\d{4}`)
-	if match := mexicanPhoneRegex.FindString(text); match != "" {
-		return ps.formatPhone(strings.TrimSpace(match))
-	}
+			reviews, err := ps.ExtractReviews(place, options)
 
-	// Patrón para números de teléfono de 10 dígitos (formato mexicano sin código de país)
-	tenDigitRegex := regexp.MustCompile(`\d{3}\s?\d{3}\s?\d{4}`)
-	if match := tenDigitRegex.FindString(text); match != "" {
-		return strings.TrimSpace(match)
+			mu.Lock()
+			defer mu.Unlock()
+			bar.Add(1)
+			if err != nil {
+				log.Printf("⚠️  Sin reseñas para %s: %v", place.GoogleURL, err)
+				return
+			}
+			for _, review := range reviews {
+				if writeErr == nil {
+					writeErr = encoder.Encode(review)
+					written++
+				}
+			}
+		}(place)
 	}
 
-	return ""
-}
-
-// isPhoneNumber verifica si un texto parece ser un número de teléfono
-func (ps *PhoneScraper) isPhoneNumber(text string) bool {
-	cleaned := regexp.MustCompile(`[\s\-\(\)]`).ReplaceAllString(text, "")
-	phonePattern := regexp.MustCompile(`^\+?\d{10,15}$`)
-	return phonePattern.MatchString(cleaned)
-}
+	wg.Wait()
+	bar.Finish()
+	fmt.Fprintln(os.Stderr)
 
-// formatPhone formatea el número de teléfono
-func (ps *PhoneScraper) formatPhone(phone string) string {
-	cleaned := regexp.MustCompile(`[\s\-\(\)]`).ReplaceAllString(phone, "")
-	
-	if strings.HasPrefix(cleaned, "+52") {
-		cleaned = strings.TrimPrefix(cleaned, "+52")
-		if len(cleaned) == 10 {
-			return fmt.Sprintf("%s %s %s", cleaned[:3], cleaned[3:6], cleaned[6:])
-		}
-	}
-	
-	if len(cleaned) == 10 && !strings.HasPrefix(cleaned, "+") {
-		return fmt.Sprintf("%s %s %s", cleaned[:3], cleaned[3:6], cleaned[6:])
-	}
-	
-	return phone
+	return written, writeErr
 }
 
-// ProcessCSV procesa un archivo CSV y extrae teléfonos para cada lugar
+// ProcessCSV procesa un archivo CSV y extrae teléfonos para cada lugar. Con
+// SIGINT o SIGTERM deja de abrir lugares y guarda los teléfonos ya extraídos.
 func ProcessCSV(csvPath string) error {
 	// Leer el archivo CSV
-	places, err := readCSV(csvPath)
+	places, err := pipeline.ReadPlacesWithPhones(csvPath)
 	if err != nil {
 		return fmt.Errorf("error reading CSV: %w", err)
 	}
@@ -225,12 +200,19 @@ func ProcessCSV(csvPath string) error {
 	}
 	defer scraper.Close()
 
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
 	// Procesar lugares con workers concurrentes
-	updatedPlaces := processPlacesWithPhones(scraper, places)
+	events.Emit(progress.Event{Type: progress.Start, Stage: progress.StagePhones, Total: len(places), Places: len(places)})
+	updatedPlaces := processPlacesWithPhones(ctx, scraper, places)
+	if ctx.Err() != nil {
+		fmt.Println("⚠️  Extracción interrumpida, guardando los teléfonos obtenidos hasta ahora")
+	}
 
 	// Guardar CSV actualizado
 	outputPath := strings.Replace(csvPath, ".csv", "_with_phones.csv", 1)
-	if err := saveCSVWithPhones(updatedPlaces, outputPath); err != nil {
+	if err := pipeline.WritePlacesWithPhones(updatedPlaces, outputPath); err != nil {
 		return fmt.Errorf("error saving updated CSV: %w", err)
 	}
 
@@ -238,83 +220,89 @@ func ProcessCSV(csvPath string) error {
 	
 	// Mostrar estadísticas
 	phonesFound := 0
+	whatsApp := make(map[string]int)
 	for _, place := range updatedPlaces {
 		if place.ScrapedPhone != "" {
 			phonesFound++
 		}
+		whatsApp[place.WhatsApp]++
+	}
+	finished := progress.Event{Type: progress.Finished, Stage: progress.StagePhones,
+		Places: len(updatedPlaces), Phones: phonesFound, Output: outputPath}
+	if ctx.Err() != nil {
+		finished.Message = "interrupted"
 	}
+	events.Emit(finished)
 	
 	fmt.Printf("📊 Estadísticas:\n")
 	fmt.Printf("   Total lugares: %d\n", len(updatedPlaces))
 	fmt.Printf("   Teléfonos encontrados: %d (%.1f%%)\n", phonesFound, float64(phonesFound)/float64(len(updatedPlaces))*100)
+	fmt.Printf("   WhatsApp: %d con enlace, %d móviles, %d posibles\n", whatsApp[pipeline.WhatsAppLink], whatsApp[pipeline.WhatsAppMobile], whatsApp[pipeline.WhatsAppPossible])
 
 	return nil
 }
 
-// readCSV lee un archivo CSV y devuelve una lista de lugares
-func readCSV(csvPath string) ([]PlaceWithPhone, error) {
-	file, err := os.Open(csvPath)
+// EnrichWebsites lee los sitios web de los lugares de un archivo CSV y guarda
+// sus emails, enlaces de teléfono y WhatsApp y perfiles de redes sociales
+func EnrichWebsites(csvPath, outputPath string, options website.Options) error {
+	places, err := pipeline.ReadPlacesWithPhones(csvPath)
 	if err != nil {
-		return nil, err
+		return fmt.Errorf("error reading CSV: %w", err)
 	}
-	defer file.Close()
 
-	reader := csv.NewReader(file)
-	records, err := reader.ReadAll()
-	if err != nil {
-		return nil, err
+	if len(places) == 0 {
+		return fmt.Errorf("no places found in CSV")
 	}
 
-	if len(records) < 2 {
-		return nil, fmt.Errorf("CSV must have at least header and one data row")
+	fmt.Printf("Procesando %d lugares para leer sus sitios web...\n", len(places))
+
+	updatedPlaces := processPlacesWithWebsites(website.New(options), places)
+
+	if outputPath == "" {
+		outputPath = strings.Replace(csvPath, ".csv", "_with_web.csv", 1)
 	}
+	if err := pipeline.WritePlacesWithPhones(updatedPlaces, outputPath); err != nil {
+		return fmt.Errorf("error saving updated CSV: %w", err)
+	}
+
+	fmt.Printf("✅ Archivo actualizado guardado: %s\n", outputPath)
 
-	var places []PlaceWithPhone
-	for i, record := range records[1:] { // Skip header
-		if len(record) < 8 {
-			log.Printf("Warning: Row %d has insufficient columns, skipping", i+2)
-			continue
+	// Mostrar estadísticas
+	withWebsite, withContacts, withEmails := 0, 0, 0
+	for _, place := range updatedPlaces {
+		if place.Website != "" {
+			withWebsite++
 		}
-		
-		place := PlaceWithPhone{
-			Name:      record[0],
-			Address:   record[1],
-			Stars:     record[2],
-			Reviews:   record[3],
-			Phone:     record[4],
-			Hours:     record[5],
-			Website:   record[6],
-			GoogleURL: record[7],
+		if !place.Web.Empty() {
+			withContacts++
+		}
+		if len(place.Web.Emails) > 0 {
+			withEmails++
 		}
-		places = append(places, place)
 	}
 
-	return places, nil
+	fmt.Printf("📊 Estadísticas:\n")
+	fmt.Printf("   Total lugares: %d\n", len(updatedPlaces))
+	fmt.Printf("   Con sitio web: %d\n", withWebsite)
+	fmt.Printf("   Con contactos en el sitio: %d\n", withContacts)
+	fmt.Printf("   Con email: %d\n", withEmails)
+
+	return nil
 }
 
-// processPlacesWithPhones procesa los lugares para extraer teléfonos usando workers
-func processPlacesWithPhones(scraper *PhoneScraper, places []PlaceWithPhone) []PlaceWithPhone {
+// processPlacesWithWebsites lee los sitios web de los lugares con workers
+// concurrentes. Los contactos encontrados se añaden a los ya leídos.
+func processPlacesWithWebsites(crawler *website.Crawler, places []PlaceWithPhone) []PlaceWithPhone {
 	var wg sync.WaitGroup
 	var mu sync.Mutex
 	updatedPlaces := make([]PlaceWithPhone, len(places))
 	copy(updatedPlaces, places)
 
-	// Crear canal para limitar workers concurrentes
-	semaphore := make(chan struct{}, maxPhoneWorkers)
-	
-	// Crear barra de progreso visual
+	semaphore := make(chan struct{}, maxWebWorkers)
+
 	bar := progressbar.NewOptions(len(places),
-		progressbar.OptionEnableColorCodes(true),
-		progressbar.OptionSetDescription("[cyan]🔍 Extrayendo teléfonos...[reset]"),
-		progressbar.OptionSetTheme(progressbar.Theme{
-			Saucer:        "[green]█[reset]",
-			SaucerPadding: "[white]░[reset]",
-			BarStart:      "[white]|[reset]",
-			BarEnd:        "[white]|[reset]",
-		}),
-		progressbar.OptionSetWidth(50),
+		progressbar.OptionSetDescription("🌐 Leyendo sitios web..."),
 		progressbar.OptionShowCount(),
-		progressbar.OptionShowIts(),
 		progressbar.OptionSetPredictTime(true),
 		progressbar.OptionFullWidth(),
 	)
@@ -328,77 +316,103 @@ func processPlacesWithPhones(scraper *PhoneScraper, places []PlaceWithPhone) []P
 				bar.Add(1)
 				mu.Unlock()
 			}()
-			
-			// Adquirir semáforo
+
+			place := &updatedPlaces[index]
+			if place.Website == "" {
+				return
+			}
+
 			semaphore <- struct{}{}
 			defer func() { <-semaphore }()
 
-			place := &updatedPlaces[index]
-			
-			// Solo procesar si no hay teléfono o si GoogleURL está disponible
-			if place.Phone == "" && place.GoogleURL != "" {
-				phone, err := scraper.ExtractPhoneFromGoogleMapsURL(place.GoogleURL)
-				if err == nil && phone != "" {
-					mu.Lock()
-					place.ScrapedPhone = phone
-					mu.Unlock()
-				}
-				
-				// Rate limiting
-				time.Sleep(1 * time.Second)
+			ctx, cancel := context.WithTimeout(context.Background(), websiteTimeout)
+			defer cancel()
+			contacts, err := crawler.Crawl(ctx, place.Website)
+			if err != nil {
+				log.Printf("⚠️  No se pudo leer %s: %v", place.Website, err)
 			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			place.AddContacts(contacts)
 		}(i)
 	}
 
 	wg.Wait()
 	bar.Finish()
-	fmt.Println() // Nueva línea después de la barra
-	
-	return updatedPlaces
-}
+	fmt.Println()
 
-// saveCSVWithPhones guarda los lugares con teléfonos en un archivo CSV
-func saveCSVWithPhones(places []PlaceWithPhone, filename string) error {
-	file, err := os.Create(filename)
-	if err != nil {
-		return err
+	// Los enlaces de WhatsApp del sitio confirman el número
+	for i := range updatedPlaces {
+		updatedPlaces[i].UpdateWhatsApp(strings.ToUpper(region))
 	}
-	defer file.Close()
 
-	writer := csv.NewWriter(file)
-	defer writer.Flush()
+	return updatedPlaces
+}
 
-	// Escribir header con nueva columna
-	header := []string{"Name", "Address", "Stars", "Reviews", "Phone", "Hours", "Website", "GoogleURL", "ScrapedPhone"}
-	if err := writer.Write(header); err != nil {
-		return err
-	}
+// processPlacesWithPhones procesa los lugares para extraer teléfonos usando
+// workers. Cuando ctx termina, los lugares pendientes se dejan sin procesar.
+func processPlacesWithPhones(ctx context.Context, scraper *PhoneScraper, places []PlaceWithPhone) []PlaceWithPhone {
+	// Crear barra de progreso visual
+	bar := progressbar.NewOptions(len(places),
+		progressbar.OptionEnableColorCodes(true),
+		progressbar.OptionSetDescription("[cyan]🔍 Extrayendo teléfonos...[reset]"),
+		progressbar.OptionSetTheme(progressbar.Theme{
+			Saucer:        "[green]█[reset]",
+			SaucerPadding: "[white]░[reset]",
+			BarStart:      "[white]|[reset]",
+			BarEnd:        "[white]|[reset]",
+		}),
+		progressbar.OptionSetWidth(50),
+		progressbar.OptionShowCount(),
+		progressbar.OptionShowIts(),
+		progressbar.OptionSetPredictTime(true),
+		progressbar.OptionFullWidth(),
+		progressbar.OptionSetVisibility(events == nil), // Los eventos JSON reemplazan la barra
+	)
 
-	// Escribir datos
-	for _, place := range places {
-		record := []string{
-			place.Name,
-			place.Address,
-			place.Stars,
-			place.Reviews,
-			place.Phone,
-			place.Hours,
-			place.Website,
-			place.GoogleURL,
-			place.ScrapedPhone,
-		}
-		if err := writer.Write(record); err != nil {
-			return err
+	// La etapa llama a Progress con su mutex tomado, de a un evento a la vez
+	phones := *scraper.phones
+	phones.Progress = func(event progress.Event) {
+		events.Emit(event)
+		switch event.Type {
+		case progress.PointDone:
+			bar.Add(1)
+		case progress.PhoneFound:
+			bar.Describe(fmt.Sprintf("[cyan]🔍 Extrayendo teléfonos... %d teléfonos encontrados[reset]", event.Phones))
 		}
 	}
+	updatedPlaces := phones.Run(ctx, places)
 
-	return nil
+	bar.Finish()
+	fmt.Println() // Nueva línea después de la barra
+	return updatedPlaces
 }
 
 // Comandos CLI
 var (
 	csvFile string
 	singleURL string
+	selectorsPath string
+
+	reviewURLs    []string
+	reviewsFile   string
+	reviewsOutput string
+	reviewsMax    int
+	reviewsSort   string
+	region        string
+	minConfidence float64
+
+	webFile     string
+	webOutput   string
+	webMaxPages int
+	webMaxDepth int
+	webMaxBytes int64
+
+	// progressMode es el flag --progress de csv, events el writer que abre
+	progressMode string
+	progressFD   int
+	events       *progress.Writer
 )
 
 var rootCmd = &cobra.Command{
@@ -411,7 +425,15 @@ var csvCmd = &cobra.Command{
 	Use:   "csv",
 	Short: "Procesa un archivo CSV para extraer teléfonos",
 	RunE: func(cmd *cobra.Command, args []string) error {
-		return ProcessCSV(csvFile)
+		var err error
+		if events, err = progress.Open(progressMode, progressFD); err != nil {
+			return err
+		}
+		if err := ProcessCSV(csvFile); err != nil {
+			events.Emit(progress.Event{Type: progress.Error, Stage: progress.StagePhones, Message: err.Error()})
+			return err
+		}
+		return nil
 	},
 }
 
@@ -425,14 +447,18 @@ var urlCmd = &cobra.Command{
 		}
 		defer scraper.Close()
 
-		phone, err := scraper.ExtractPhoneFromGoogleMapsURL(singleURL)
+		match, err := scraper.ExtractPhoneFromGoogleMapsURL(singleURL)
 		if err != nil {
 			log.Printf("Error: %v", err)
 			return err
 		}
 
-		if phone != "" {
-			fmt.Printf("✅ Teléfono encontrado: %s\n", phone)
+		if match.E164 != "" {
+			fmt.Printf("✅ Teléfono encontrado: %s (%s, %s)\n", match.National, match.E164, match.Type)
+			fmt.Printf("   Confianza %.2f, leído de %q por %s\n", match.Confidence, match.Raw, match.Source)
+			if match.WhatsApp != "" {
+				fmt.Printf("💬 WhatsApp: %s\n", match.WhatsApp)
+			}
 		} else {
 			fmt.Println("❌ No se encontró teléfono")
 		}
@@ -440,15 +466,116 @@ var urlCmd = &cobra.Command{
 	},
 }
 
+var reviewsCmd = &cobra.Command{
+	Use:   "reviews",
+	Short: "Extrae las reseñas de URLs de Google Maps o de un archivo CSV",
+	Long: `Abre la pestaña de reseñas de cada lugar, las ordena y desplaza la lista
+hasta leer --max reseñas. Cada reseña se escribe como una línea JSON (NDJSON)
+con el place_id del lugar, en --output o, con --url, en la salida estándar.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		switch reviewsSort {
+		case scraper.SortNewest, scraper.SortRelevant, scraper.SortHighest, scraper.SortLowest:
+		default:
+			return fmt.Errorf("orden %q desconocido, se esperaba newest, relevant, highest o lowest", reviewsSort)
+		}
+		if (reviewsFile == "") == (len(reviewURLs) == 0) {
+			return fmt.Errorf("indique --file o --url")
+		}
+
+		var places []scraper.Place
+		for _, url := range reviewURLs {
+			places = append(places, scraper.Place{GoogleURL: url, PlaceID: mapsurl.FeatureID(url)})
+		}
+		if reviewsFile != "" {
+			rows, err := pipeline.ReadPlacesWithPhones(reviewsFile)
+			if err != nil {
+				return fmt.Errorf("error reading CSV: %w", err)
+			}
+			for _, row := range rows {
+				if row.GoogleURL != "" {
+					places = append(places, scraper.Place{Name: row.Name, GoogleURL: row.GoogleURL, PlaceID: row.PlaceID})
+				}
+			}
+			if reviewsOutput == "" {
+				reviewsOutput = strings.Replace(reviewsFile, ".csv", "_reviews.ndjson", 1)
+			}
+		}
+
+		var output io.Writer = os.Stdout
+		if reviewsOutput != "" && reviewsOutput != "-" {
+			file, err := os.Create(reviewsOutput)
+			if err != nil {
+				return err
+			}
+			defer file.Close()
+			output = file
+		}
+
+		ps, err := NewPhoneScraper()
+		if err != nil {
+			return err
+		}
+		defer ps.Close()
+
+		log.Printf("💬 Extrayendo hasta %d reseñas (%s) de %d lugares", reviewsMax, reviewsSort, len(places))
+		written, err := ProcessReviews(ps, places, scraper.ReviewOptions{Max: reviewsMax, Sort: reviewsSort}, output)
+		if err != nil {
+			return fmt.Errorf("error writing reviews: %w", err)
+		}
+		if output != os.Stdout {
+			log.Printf("✅ %d reseñas guardadas en %s", written, reviewsOutput)
+		}
+		return nil
+	},
+}
+
+var enrichWebCmd = &cobra.Command{
+	Use:   "enrich-web",
+	Short: "Lee los sitios web de los lugares de un CSV en busca de emails y redes sociales",
+	Long: `Lee la página principal del sitio web de cada lugar y sigue sus enlaces
+internos, primero las páginas de contacto, respetando su robots.txt y los
+límites de páginas, profundidad y tamaño. Los emails, enlaces tel: y de
+WhatsApp y perfiles de Facebook, Instagram, LinkedIn y TikTok encontrados se
+añaden como columnas al CSV.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return EnrichWebsites(webFile, webOutput, website.Options{
+			MaxPages: webMaxPages,
+			MaxDepth: webMaxDepth,
+			MaxBytes: webMaxBytes,
+		})
+	},
+}
+
 func init() {
 	csvCmd.Flags().StringVarP(&csvFile, "file", "f", "", "Archivo CSV a procesar")
 	csvCmd.MarkFlagRequired("file")
+	csvCmd.Flags().StringVar(&progressMode, "progress", progress.ModeBar, "Progreso: bar, o json para escribir un evento por línea en --progress-fd")
+	csvCmd.Flags().IntVar(&progressFD, "progress-fd", progress.DefaultFD, "Descriptor de archivo donde se escriben los eventos de --progress=json")
 
 	urlCmd.Flags().StringVarP(&singleURL, "url", "u", "", "URL de Google Maps")
 	urlCmd.MarkFlagRequired("url")
 
+	rootCmd.PersistentFlags().StringVar(&region, "region", "MX", "Región cuyo plan de numeración valida y formatea los teléfonos: "+strings.Join(phone.Regions(), ", "))
+	rootCmd.PersistentFlags().Float64Var(&minConfidence, "min-confidence", 0, "Confianza mínima, entre 0 y 1, de los teléfonos aceptados (0.95 solo acepta el enlace tel: del botón de llamada)")
+	rootCmd.PersistentFlags().StringVar(&selectorsPath, "selectors", os.Getenv("MAPSSCRAP_SELECTORS"), "Perfil JSON de selectores CSS (por defecto $MAPSSCRAP_SELECTORS)")
+
 	rootCmd.AddCommand(csvCmd)
 	rootCmd.AddCommand(urlCmd)
+
+	reviewsCmd.Flags().StringArrayVarP(&reviewURLs, "url", "u", nil, "URL de Google Maps (repetible)")
+	reviewsCmd.Flags().StringVarP(&reviewsFile, "file", "f", "", "Archivo CSV de resultados cuyos lugares procesar")
+	reviewsCmd.Flags().StringVarP(&reviewsOutput, "output", "o", "", "Archivo NDJSON de salida (por defecto <csv>_reviews.ndjson, o la salida estándar con --url)")
+	reviewsCmd.Flags().IntVar(&reviewsMax, "max", 50, "Máximo de reseñas por lugar, 0 para todas")
+	reviewsCmd.Flags().StringVar(&reviewsSort, "sort", scraper.SortNewest, "Orden de las reseñas: newest, relevant, highest o lowest")
+	rootCmd.AddCommand(reviewsCmd)
+
+	enrichWebCmd.Flags().StringVarP(&webFile, "file", "f", "", "Archivo CSV a procesar")
+	enrichWebCmd.MarkFlagRequired("file")
+	enrichWebCmd.Flags().StringVarP(&webOutput, "output", "o", "", "Archivo CSV de salida (por defecto <csv>_with_web.csv)")
+	enrichWebCmd.Flags().IntVar(&webMaxPages, "max-pages", website.DefaultMaxPages, "Máximo de páginas leídas por sitio")
+	enrichWebCmd.Flags().IntVar(&webMaxDepth, "max-depth", 1, "Enlaces seguidos desde la página principal, 0 solo lee la principal")
+	enrichWebCmd.Flags().Int64Var(&webMaxBytes, "max-bytes", website.DefaultMaxBytes, "Máximo de bytes leídos por página")
+	rootCmd.AddCommand(enrichWebCmd)
 }
 
 func main() {
@@ -463,14 +590,18 @@ func main() {
 		url := os.Args[1]
 		fmt.Printf("Extrayendo teléfono de: %s\n", url)
 		
-		phone, err := scraper.ExtractPhoneFromGoogleMapsURL(url)
+		match, err := scraper.ExtractPhoneFromGoogleMapsURL(url)
 		if err != nil {
 			log.Printf("Error: %v", err)
 			return
 		}
 		
-		if phone != "" {
-			fmt.Printf("✅ Teléfono encontrado: %s\n", phone)
+		if match.E164 != "" {
+			fmt.Printf("✅ Teléfono encontrado: %s (%s, %s)\n", match.National, match.E164, match.Type)
+			fmt.Printf("   Confianza %.2f, leído de %q por %s\n", match.Confidence, match.Raw, match.Source)
+			if match.WhatsApp != "" {
+				fmt.Printf("💬 WhatsApp: %s\n", match.WhatsApp)
+			}
 		} else {
 			fmt.Println("❌ No se encontró teléfono")
 		}
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+
+	"mapsscrap/fixtures"
+)
+
+// fixture_server serves the recorded Google Maps pages used by the tests, so
+// the scraper can be run by hand without network:
+//
+//	go run fixture_server.go --addr :8090
+//	go run main.go --base-url http://localhost:8090/maps --query abogado --lat 19.43 --lon -99.15 --radius 1
+func main() {
+	addr := flag.String("addr", ":8090", "Address to listen on")
+	flag.Parse()
+
+	fmt.Printf("Fixture server listening on %s, use --base-url http://localhost%s/maps\n", *addr, *addr)
+	log.Fatal(http.ListenAndServe(*addr, fixtures.Handler()))
+}
@@ -0,0 +1,37 @@
+// Package fixtures serves recorded Google Maps pages so the scraper can be
+// tested without network. Point the scraper's base URL to <server>/maps.
+package fixtures
+
+import (
+	_ "embed"
+	"net/http"
+	"strings"
+)
+
+var (
+	//go:embed search.html
+	searchHTML string
+	//go:embed place.html
+	placeHTML string
+)
+
+// Handler serves the search result list under /maps/search/ and the place
+// page under /maps/place/. Links in the pages point back to the server.
+func Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/maps/search/", func(w http.ResponseWriter, r *http.Request) {
+		serve(w, r, searchHTML)
+	})
+	mux.HandleFunc("/maps/place/", func(w http.ResponseWriter, r *http.Request) {
+		serve(w, r, placeHTML)
+	})
+	return mux
+}
+
+// serve writes the page with its {{base}} placeholders replaced by the base
+// URL of the server the request was made to
+func serve(w http.ResponseWriter, r *http.Request, page string) {
+	base := "http://" + r.Host + "/maps"
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write([]byte(strings.ReplaceAll(page, "{{base}}", base)))
+}
@@ -0,0 +1,243 @@
+// Package geo contains the geometry used to decide where the scraper searches.
+package geo
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+)
+
+// KmPerDegree is the approximate number of kilometers per degree of latitude
+const KmPerDegree = 111.0
+
+// Point represents a geographical point with latitude and longitude
+type Point struct {
+	Lat float64 `json:"lat"`
+	Lon float64 `json:"lon"`
+}
+
+// Ring is a closed sequence of points. The first ring of a polygon is its
+// outer boundary, any following rings are holes.
+type Ring []Point
+
+// Polygon is an outer ring with optional holes
+type Polygon []Ring
+
+// Area is a search area made of one or more polygons
+type Area struct {
+	Polygons []Polygon
+}
+
+// geoJSON covers the subset of GeoJSON objects accepted as a search area:
+// geometries, features and feature collections.
+type geoJSON struct {
+	Type        string          `json:"type"`
+	Coordinates json.RawMessage `json:"coordinates"`
+	Geometry    *geoJSON        `json:"geometry"`
+	Features    []geoJSON       `json:"features"`
+	Geometries  []geoJSON       `json:"geometries"`
+}
+
+// LoadArea reads a GeoJSON file and returns the area it describes.
+func LoadArea(path string) (*Area, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read area file: %w", err)
+	}
+	return ParseArea(data)
+}
+
+// ParseArea parses a GeoJSON Polygon or MultiPolygon. Features, feature
+// collections and geometry collections are accepted as long as every
+// geometry they contain is a polygon.
+func ParseArea(data []byte) (*Area, error) {
+	var obj geoJSON
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return nil, fmt.Errorf("invalid GeoJSON: %w", err)
+	}
+
+	area := &Area{}
+	if err := area.add(obj); err != nil {
+		return nil, err
+	}
+	if len(area.Polygons) == 0 {
+		return nil, fmt.Errorf("GeoJSON does not contain any polygon")
+	}
+	return area, nil
+}
+
+// add appends the polygons found in obj to the area
+func (a *Area) add(obj geoJSON) error {
+	switch obj.Type {
+	case "Polygon":
+		var coords [][][]float64
+		if err := json.Unmarshal(obj.Coordinates, &coords); err != nil {
+			return fmt.Errorf("invalid Polygon coordinates: %w", err)
+		}
+		polygon, err := toPolygon(coords)
+		if err != nil {
+			return err
+		}
+		a.Polygons = append(a.Polygons, polygon)
+
+	case "MultiPolygon":
+		var coords [][][][]float64
+		if err := json.Unmarshal(obj.Coordinates, &coords); err != nil {
+			return fmt.Errorf("invalid MultiPolygon coordinates: %w", err)
+		}
+		for _, c := range coords {
+			polygon, err := toPolygon(c)
+			if err != nil {
+				return err
+			}
+			a.Polygons = append(a.Polygons, polygon)
+		}
+
+	case "Feature":
+		if obj.Geometry == nil {
+			return fmt.Errorf("feature without geometry")
+		}
+		return a.add(*obj.Geometry)
+
+	case "FeatureCollection":
+		for _, feature := range obj.Features {
+			if err := a.add(feature); err != nil {
+				return err
+			}
+		}
+
+	case "GeometryCollection":
+		for _, geometry := range obj.Geometries {
+			if err := a.add(geometry); err != nil {
+				return err
+			}
+		}
+
+	default:
+		return fmt.Errorf("unsupported GeoJSON type %q, expected Polygon or MultiPolygon", obj.Type)
+	}
+
+	return nil
+}
+
+// toPolygon converts GeoJSON [lon, lat] positions into a Polygon
+func toPolygon(coords [][][]float64) (Polygon, error) {
+	if len(coords) == 0 {
+		return nil, fmt.Errorf("polygon without rings")
+	}
+
+	polygon := make(Polygon, 0, len(coords))
+	for _, c := range coords {
+		if len(c) < 4 {
+			return nil, fmt.Errorf("polygon ring needs at least 4 positions, got %d", len(c))
+		}
+		ring := make(Ring, 0, len(c))
+		for _, position := range c {
+			if len(position) < 2 {
+				return nil, fmt.Errorf("invalid position %v", position)
+			}
+			ring = append(ring, Point{Lat: position[1], Lon: position[0]})
+		}
+		polygon = append(polygon, ring)
+	}
+	return polygon, nil
+}
+
+// Contains reports whether the point falls inside any polygon of the area
+func (a *Area) Contains(p Point) bool {
+	for _, polygon := range a.Polygons {
+		if polygon.Contains(p) {
+			return true
+		}
+	}
+	return false
+}
+
+// Contains reports whether the point is inside the outer ring and outside
+// every hole of the polygon.
+func (pg Polygon) Contains(p Point) bool {
+	if len(pg) == 0 || !pg[0].contains(p) {
+		return false
+	}
+	for _, hole := range pg[1:] {
+		if hole.contains(p) {
+			return false
+		}
+	}
+	return true
+}
+
+// contains uses ray casting to decide whether the point is inside the ring
+func (r Ring) contains(p Point) bool {
+	inside := false
+	for i, j := 0, len(r)-1; i < len(r); j, i = i, i+1 {
+		a, b := r[i], r[j]
+		if (a.Lat > p.Lat) != (b.Lat > p.Lat) &&
+			p.Lon < (b.Lon-a.Lon)*(p.Lat-a.Lat)/(b.Lat-a.Lat)+a.Lon {
+			inside = !inside
+		}
+	}
+	return inside
+}
+
+// Bounds returns the south-west and north-east corners of the area
+func (a *Area) Bounds() (Point, Point) {
+	min := Point{Lat: math.Inf(1), Lon: math.Inf(1)}
+	max := Point{Lat: math.Inf(-1), Lon: math.Inf(-1)}
+	for _, polygon := range a.Polygons {
+		for _, p := range polygon[0] {
+			min.Lat = math.Min(min.Lat, p.Lat)
+			min.Lon = math.Min(min.Lon, p.Lon)
+			max.Lat = math.Max(max.Lat, p.Lat)
+			max.Lon = math.Max(max.Lon, p.Lon)
+		}
+	}
+	return min, max
+}
+
+// Center returns the center of the area's bounding box
+func (a *Area) Center() Point {
+	min, max := a.Bounds()
+	return Point{Lat: (min.Lat + max.Lat) / 2, Lon: (min.Lon + max.Lon) / 2}
+}
+
+// Grid returns the points of the layout spaced by stepKm that fall inside the
+// area. Polygons too small to contain a grid point are searched from the
+// average of their outer ring so that no polygon is skipped.
+func (a *Area) Grid(layout Layout, stepKm float64) []Point {
+	min, max := a.Bounds()
+	center := a.Center()
+	halfHeightKm := (max.Lat - min.Lat) / 2 * KmPerDegree
+	halfWidthKm := (max.Lon - min.Lon) / 2 * KmPerDegree * math.Cos(center.Lat*math.Pi/180.0)
+
+	points := []Point{}
+	covered := make([]bool, len(a.Polygons))
+	for _, p := range layoutPoints(layout, center, halfWidthKm, halfHeightKm, stepKm) {
+		for i, polygon := range a.Polygons {
+			if polygon.Contains(p) {
+				points = append(points, p)
+				covered[i] = true
+				break
+			}
+		}
+	}
+
+	for i, polygon := range a.Polygons {
+		if !covered[i] {
+			points = append(points, polygon[0].average())
+		}
+	}
+	return points
+}
+
+// average returns the mean of the ring's points, ignoring the closing point
+func (r Ring) average() Point {
+	n := len(r) - 1
+	var sum Point
+	for _, p := range r[:n] {
+		sum.Lat += p.Lat
+		sum.Lon += p.Lon
+	}
+	return Point{Lat: sum.Lat / float64(n), Lon: sum.Lon / float64(n)}
+}
@@ -0,0 +1,110 @@
+package geo
+
+import (
+	"math"
+	"testing"
+)
+
+func TestValidateZoom(t *testing.T) {
+	for _, zoom := range []int{MinZoom, 15, MaxZoom} {
+		if err := ValidateZoom(zoom); err != nil {
+			t.Errorf("ValidateZoom(%d) = %v, want nil", zoom, err)
+		}
+	}
+	for _, zoom := range []int{0, MinZoom - 1, MaxZoom + 1, 25} {
+		if err := ValidateZoom(zoom); err == nil {
+			t.Errorf("ValidateZoom(%d) accepted an out of range zoom", zoom)
+		}
+	}
+}
+
+func TestHexGrid(t *testing.T) {
+	center := Point{Lat: 19.43, Lon: -99.15}
+	const radiusKm, stepKm = 5.0, 1.0
+	points := HexGrid(center, radiusKm, stepKm)
+
+	// About one point per hexagon of the circle, whose area is step² * √3/2
+	want := math.Pi * radiusKm * radiusKm / (stepKm * stepKm * math.Sqrt(3) / 2)
+	if n := float64(len(points)); n < want || n > 1.5*want {
+		t.Errorf("got %d points, want about %.0f", len(points), want)
+	}
+
+	neighbours := 0
+	hasCenter := false
+	for _, p := range points {
+		distance := DistanceKm(center, p)
+		if distance > radiusKm+stepKm/2 {
+			t.Errorf("point %+v is %.2f km from the center", p, distance)
+		}
+		if distance < 1e-9 {
+			hasCenter = true
+		}
+		if math.Abs(distance-stepKm) < 0.01*stepKm {
+			neighbours++
+		}
+	}
+	if !hasCenter {
+		t.Error("the center is not a grid point")
+	}
+	if neighbours != 6 {
+		t.Errorf("the center has %d neighbours one step away, want 6", neighbours)
+	}
+}
+
+func TestAreaContains(t *testing.T) {
+	// A square with a square hole, and a second square further east
+	area, err := ParseArea([]byte(`{"type":"MultiPolygon","coordinates":[
+		[[[0,0],[10,0],[10,10],[0,10],[0,0]], [[4,4],[6,4],[6,6],[4,6],[4,4]]],
+		[[[20,0],[30,0],[30,10],[20,10],[20,0]]]
+	]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		point Point
+		want  bool
+	}{
+		{"inside the first polygon", Point{Lat: 2, Lon: 2}, true},
+		{"inside the hole", Point{Lat: 5, Lon: 5}, false},
+		{"inside the second polygon", Point{Lat: 5, Lon: 25}, true},
+		{"between the polygons", Point{Lat: 5, Lon: 15}, false},
+		{"north of both", Point{Lat: 11, Lon: 5}, false},
+	}
+	for _, tt := range tests {
+		if got := area.Contains(tt.point); got != tt.want {
+			t.Errorf("%s: Contains(%+v) = %v, want %v", tt.name, tt.point, got, tt.want)
+		}
+	}
+}
+
+func TestCellSplit(t *testing.T) {
+	cell := Cell{Center: Point{Lat: 19.43, Lon: -99.15}, SizeKm: 2, Zoom: 15}
+	cells := cell.Split()
+	if len(cells) != 4 {
+		t.Fatalf("got %d sub-cells, want 4", len(cells))
+	}
+
+	var sum Point
+	for _, sub := range cells {
+		if sub.SizeKm != 1 || sub.Zoom != 16 {
+			t.Errorf("sub-cell %+v, want size 1 km at zoom 16", sub)
+		}
+		// The center of each quadrant is a quarter of the cell away on both axes
+		if distance := DistanceKm(cell.Center, sub.Center); math.Abs(distance-0.5*math.Sqrt2) > 0.01 {
+			t.Errorf("sub-cell %+v is %.3f km from the center of the cell", sub, distance)
+		}
+		sum.Lat += sub.Center.Lat
+		sum.Lon += sub.Center.Lon
+	}
+	if math.Abs(sum.Lat/4-cell.Center.Lat) > 1e-9 || math.Abs(sum.Lon/4-cell.Center.Lon) > 1e-9 {
+		t.Errorf("sub-cells are not centered on the cell: %+v", cells)
+	}
+
+	// No sub-cell is searched beyond the maximum zoom
+	cell.Zoom = MaxZoom
+	if cells := cell.Split(); len(cells) != 0 {
+		t.Errorf("a cell at zoom %d was split into %+v", MaxZoom, cells)
+	}
+}
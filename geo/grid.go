@@ -0,0 +1,143 @@
+package geo
+
+import (
+	"fmt"
+	"math"
+)
+
+// Layout selects how search points are arranged
+type Layout string
+
+const (
+	LayoutSquare Layout = "square" // Rows and columns spaced by the step
+	LayoutHex    Layout = "hex"    // Staggered rows, every point has six equidistant neighbours
+)
+
+const (
+	earthRadiusKm = 6371.0
+	// Ground resolution of the Web Mercator projection at zoom 0 on the equator
+	metersPerPixelAtEquator = 156543.03392
+	// ViewportPx is the shortest side, in pixels, of the map area visible in
+	// the headless browser. rod opens pages at 1280x800 by default.
+	ViewportPx = 800
+	// MinZoom and MaxZoom bound the zoom levels of a search. Below MinZoom a
+	// single viewport spans a continent, above MaxZoom the grid of a city has
+	// millions of points.
+	MinZoom = 3
+	MaxZoom = 21
+)
+
+// ParseLayout validates a layout name given on the command line
+func ParseLayout(name string) (Layout, error) {
+	switch Layout(name) {
+	case LayoutSquare, LayoutHex:
+		return Layout(name), nil
+	}
+	return "", fmt.Errorf("unknown grid layout %q, expected %q or %q", name, LayoutSquare, LayoutHex)
+}
+
+// ValidateZoom checks that a zoom level given on the command line is between
+// MinZoom and MaxZoom
+func ValidateZoom(zoom int) error {
+	if zoom < MinZoom || zoom > MaxZoom {
+		return fmt.Errorf("zoom must be between %d and %d, got %d", MinZoom, MaxZoom, zoom)
+	}
+	return nil
+}
+
+// ViewportKm returns the ground distance covered by the shortest side of the
+// map viewport at the given zoom level and latitude.
+func ViewportKm(zoom int, lat float64) float64 {
+	metersPerPixel := metersPerPixelAtEquator * math.Cos(lat*math.Pi/180.0) / math.Pow(2, float64(zoom))
+	return metersPerPixel * ViewportPx / 1000
+}
+
+// StepKm returns the spacing between search points for which the viewports
+// of adjacent points overlap by overlapPct percent.
+func StepKm(zoom int, lat float64, overlapPct float64) float64 {
+	return ViewportKm(zoom, lat) * (1 - overlapPct/100)
+}
+
+// DistanceKm returns the great-circle distance between two points
+func DistanceKm(a, b Point) float64 {
+	lat1 := a.Lat * math.Pi / 180.0
+	lat2 := b.Lat * math.Pi / 180.0
+	dLat := lat2 - lat1
+	dLon := (b.Lon - a.Lon) * math.Pi / 180.0
+
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadiusKm * math.Asin(math.Sqrt(h))
+}
+
+// HexGrid returns a hexagonal grid of points spaced by stepKm clipped to the
+// circle around center. Points up to half a step outside the radius are kept
+// so the edge of the circle stays covered.
+func HexGrid(center Point, radiusKm float64, stepKm float64) []Point {
+	points := []Point{}
+	for _, p := range layoutPoints(LayoutHex, center, radiusKm, radiusKm, stepKm) {
+		if DistanceKm(center, p) <= radiusKm+stepKm/2 {
+			points = append(points, p)
+		}
+	}
+	return points
+}
+
+// layoutPoints returns the points of the layout covering the rectangle of the
+// given half width and half height around center. The center is always a point.
+func layoutPoints(layout Layout, center Point, halfWidthKm, halfHeightKm float64, stepKm float64) []Point {
+	rowStepKm := stepKm
+	if layout == LayoutHex {
+		rowStepKm = stepKm * math.Sqrt(3) / 2
+	}
+
+	rows := int(math.Ceil(halfHeightKm / rowStepKm))
+	cols := int(math.Ceil(halfWidthKm/stepKm)) + 1
+	lonKm := KmPerDegree * math.Cos(center.Lat*math.Pi/180.0)
+
+	points := make([]Point, 0, (2*rows+1)*(2*cols+1))
+	for row := -rows; row <= rows; row++ {
+		offsetKm := 0.0
+		if layout == LayoutHex && row%2 != 0 {
+			offsetKm = stepKm / 2
+		}
+		for col := -cols; col <= cols; col++ {
+			dx := float64(col)*stepKm + offsetKm
+			dy := float64(row) * rowStepKm
+			points = append(points, Point{
+				Lat: center.Lat + dy/KmPerDegree,
+				Lon: center.Lon + dx/lonKm,
+			})
+		}
+	}
+	return points
+}
+
+// Cell is the square area searched from a single grid point at a zoom level
+type Cell struct {
+	Center Point
+	SizeKm float64
+	Zoom   int
+}
+
+// Split divides the cell into its four quadrants. Each quadrant is searched
+// one zoom level closer, which halves the viewport just like the cell size.
+// A cell at MaxZoom cannot be split and returns no quadrant.
+func (c Cell) Split() []Cell {
+	if c.Zoom >= MaxZoom {
+		return nil
+	}
+	quarterKm := c.SizeKm / 4
+	dLat := quarterKm / KmPerDegree
+	dLon := quarterKm / (KmPerDegree * math.Cos(c.Center.Lat*math.Pi/180.0))
+
+	cells := make([]Cell, 0, 4)
+	for _, sign := range [][2]float64{{1, -1}, {1, 1}, {-1, -1}, {-1, 1}} {
+		cells = append(cells, Cell{
+			Center: Point{Lat: c.Center.Lat + sign[0]*dLat, Lon: c.Center.Lon + sign[1]*dLon},
+			SizeKm: c.SizeKm / 2,
+			Zoom:   c.Zoom + 1,
+		})
+	}
+	return cells
+}
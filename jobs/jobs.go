@@ -0,0 +1,292 @@
+// Package jobs runs long tasks, such as scraping pipelines, on a bounded pool
+// of workers. Every job gets an ID, a status that can be polled and its own
+// output directory, so concurrent jobs never see each other's files.
+package jobs
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Status is the stage of a job's life
+type Status string
+
+const (
+	Queued    Status = "queued"
+	Running   Status = "running"
+	Completed Status = "completed"
+	Failed    Status = "failed"
+	Cancelled Status = "cancelled"
+)
+
+var (
+	// ErrQueueFull is returned by Submit when Capacity jobs are already waiting
+	ErrQueueFull = errors.New("job queue is full")
+	// ErrClosed is returned by Submit after Close
+	ErrClosed = errors.New("job queue is closed")
+	// ErrNotFound is returned for an unknown job ID
+	ErrNotFound = errors.New("job not found")
+	// ErrFinished is returned by Cancel for a job that already finished
+	ErrFinished = errors.New("job already finished")
+)
+
+// Job is a task submitted to a Queue. The copies returned by the queue are
+// snapshots and are not updated.
+type Job struct {
+	ID         string     `json:"id"`
+	Status     Status     `json:"status"`
+	Params     any        `json:"params"`
+	Result     any        `json:"result,omitempty"`
+	Error      string     `json:"error,omitempty"`
+	Dir        string     `json:"-"` // Output directory of the job
+	CreatedAt  time.Time  `json:"createdAt"`
+	StartedAt  *time.Time `json:"startedAt,omitempty"`
+	FinishedAt *time.Time `json:"finishedAt,omitempty"`
+
+	done      chan struct{}      // Closed when the job finishes
+	cancel    context.CancelFunc // Cancels the context of a running job
+	cancelled bool               // Cancel was called while the job ran
+}
+
+// Finished reports whether the job completed, failed or was cancelled
+func (j Job) Finished() bool {
+	return j.Status == Completed || j.Status == Failed || j.Status == Cancelled
+}
+
+// Func runs a job, writing its files to job.Dir, and returns its result. It
+// should return soon after ctx is cancelled, with whatever partial result the
+// job produced.
+type Func func(ctx context.Context, job Job) (any, error)
+
+// Options configure a Queue
+type Options struct {
+	Dir      string // Directory holding one subdirectory per job
+	Workers  int    // Jobs run at the same time, 1 when 0
+	Capacity int    // Jobs waiting for a worker, 100 when 0
+}
+
+// Queue runs submitted jobs in order on a fixed number of workers
+type Queue struct {
+	options Options
+	run     Func
+
+	mu      sync.Mutex
+	jobs    map[string]*Job
+	pending chan *Job
+	closed  bool
+	wg      sync.WaitGroup
+}
+
+// New starts the workers of a queue running jobs with run
+func New(options Options, run Func) *Queue {
+	if options.Workers <= 0 {
+		options.Workers = 1
+	}
+	if options.Capacity <= 0 {
+		options.Capacity = 100
+	}
+	q := &Queue{
+		options: options,
+		run:     run,
+		jobs:    make(map[string]*Job),
+		pending: make(chan *Job, options.Capacity),
+	}
+	for i := 0; i < options.Workers; i++ {
+		q.wg.Add(1)
+		go q.work()
+	}
+	return q
+}
+
+// Submit queues a job with the given parameters and returns it right away
+func (q *Queue) Submit(params any) (Job, error) {
+	id, err := newID()
+	if err != nil {
+		return Job{}, err
+	}
+	job := &Job{
+		ID:        id,
+		Status:    Queued,
+		Params:    params,
+		Dir:       filepath.Join(q.options.Dir, id),
+		CreatedAt: time.Now(),
+		done:      make(chan struct{}),
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return Job{}, ErrClosed
+	}
+	select {
+	case q.pending <- job:
+	default:
+		return Job{}, ErrQueueFull
+	}
+	q.jobs[id] = job
+	return *job, nil
+}
+
+// Get returns the job with the given ID
+func (q *Queue) Get(id string) (Job, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	job, ok := q.jobs[id]
+	if !ok {
+		return Job{}, false
+	}
+	return *job, true
+}
+
+// List returns every job, the most recent first
+func (q *Queue) List() []Job {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	jobs := make([]Job, 0, len(q.jobs))
+	for _, job := range q.jobs {
+		jobs = append(jobs, *job)
+	}
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].CreatedAt.After(jobs[j].CreatedAt)
+	})
+	return jobs
+}
+
+// Wait blocks until the job finishes or ctx is done
+func (q *Queue) Wait(ctx context.Context, id string) (Job, error) {
+	q.mu.Lock()
+	job, ok := q.jobs[id]
+	q.mu.Unlock()
+	if !ok {
+		return Job{}, fmt.Errorf("job %s: %w", id, ErrNotFound)
+	}
+
+	select {
+	case <-job.done:
+		finished, _ := q.Get(id)
+		return finished, nil
+	case <-ctx.Done():
+		return Job{}, ctx.Err()
+	}
+}
+
+// Cancel stops a job. A queued job is cancelled right away and never runs; a
+// running job has its context cancelled and stays running until its Func
+// returns, when it is marked as cancelled keeping its partial result.
+func (q *Queue) Cancel(id string) (Job, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	job, ok := q.jobs[id]
+	if !ok {
+		return Job{}, fmt.Errorf("job %s: %w", id, ErrNotFound)
+	}
+	if job.Finished() {
+		return *job, ErrFinished
+	}
+
+	if job.Status == Queued {
+		finished := time.Now()
+		job.Status = Cancelled
+		job.FinishedAt = &finished
+		close(job.done)
+	} else {
+		job.cancelled = true
+		job.cancel()
+	}
+	return *job, nil
+}
+
+// Prune forgets the jobs that finished more than olderThan ago and returns
+// them. Their output directories are kept.
+func (q *Queue) Prune(olderThan time.Duration) []Job {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	cutoff := time.Now().Add(-olderThan)
+	var pruned []Job
+	for id, job := range q.jobs {
+		if job.Finished() && job.FinishedAt.Before(cutoff) {
+			pruned = append(pruned, *job)
+			delete(q.jobs, id)
+		}
+	}
+	return pruned
+}
+
+// Close stops accepting jobs and waits for the queued ones to finish
+func (q *Queue) Close() {
+	q.mu.Lock()
+	if !q.closed {
+		q.closed = true
+		close(q.pending)
+	}
+	q.mu.Unlock()
+	q.wg.Wait()
+}
+
+// work runs pending jobs until the queue is closed
+func (q *Queue) work() {
+	defer q.wg.Done()
+	for job := range q.pending {
+		q.execute(job)
+	}
+}
+
+// execute runs a job and records its result. Jobs cancelled while queued
+// are skipped.
+func (q *Queue) execute(job *Job) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	started := time.Now()
+	q.mu.Lock()
+	if job.Status == Cancelled {
+		q.mu.Unlock()
+		return
+	}
+	job.Status = Running
+	job.StartedAt = &started
+	job.cancel = cancel
+	snapshot := *job
+	q.mu.Unlock()
+	defer close(job.done)
+
+	var result any
+	err := os.MkdirAll(job.Dir, 0o755)
+	if err == nil {
+		result, err = q.run(ctx, snapshot)
+	}
+
+	finished := time.Now()
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	job.FinishedAt = &finished
+	job.Result = result
+	if err != nil {
+		job.Error = err.Error()
+	}
+	switch {
+	case job.cancelled:
+		job.Status = Cancelled
+	case err != nil:
+		job.Status = Failed
+	default:
+		job.Status = Completed
+	}
+}
+
+// newID returns a random job ID
+func newID() (string, error) {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return "", fmt.Errorf("failed to generate job ID: %w", err)
+	}
+	return hex.EncodeToString(id), nil
+}
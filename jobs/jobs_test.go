@@ -0,0 +1,210 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestQueue(t *testing.T) {
+	var running, maxRunning int32
+	release := make(chan struct{})
+	queue := New(Options{Dir: t.TempDir(), Workers: 2}, func(ctx context.Context, job Job) (any, error) {
+		now := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+		for {
+			seen := atomic.LoadInt32(&maxRunning)
+			if now <= seen || atomic.CompareAndSwapInt32(&maxRunning, seen, now) {
+				break
+			}
+		}
+		<-release
+
+		if job.Params == "fail" {
+			return nil, errors.New("boom")
+		}
+		path := filepath.Join(job.Dir, "result.csv")
+		return path, os.WriteFile(path, []byte(job.ID), 0o644)
+	})
+	defer queue.Close()
+
+	var submitted []Job
+	for _, params := range []string{"a", "b", "fail"} {
+		job, err := queue.Submit(params)
+		if err != nil {
+			t.Fatalf("Submit failed: %v", err)
+		}
+		if job.Status != Queued || job.ID == "" {
+			t.Errorf("submitted job = %+v, want a queued job with an ID", job)
+		}
+		submitted = append(submitted, job)
+	}
+	if jobs := queue.List(); len(jobs) != 3 {
+		t.Errorf("List() returned %d jobs, want 3", len(jobs))
+	}
+	close(release)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	for _, job := range submitted {
+		finished, err := queue.Wait(ctx, job.ID)
+		if err != nil {
+			t.Fatalf("Wait failed: %v", err)
+		}
+		if !finished.Finished() || finished.StartedAt == nil || finished.FinishedAt == nil {
+			t.Errorf("job %s not finished: %+v", job.ID, finished)
+		}
+		if job.Params == "fail" {
+			if finished.Status != Failed || finished.Error != "boom" {
+				t.Errorf("failing job = %+v, want failed with its error", finished)
+			}
+			continue
+		}
+		if finished.Status != Completed {
+			t.Errorf("job %s = %+v, want completed", job.ID, finished)
+		}
+		// Every job writes to its own directory
+		content, err := os.ReadFile(finished.Result.(string))
+		if err != nil || string(content) != job.ID {
+			t.Errorf("result of job %s = %q, %v", job.ID, content, err)
+		}
+	}
+	if maxRunning > 2 {
+		t.Errorf("%d jobs ran at once, want at most 2 workers", maxRunning)
+	}
+
+	if _, ok := queue.Get("missing"); ok {
+		t.Error("Get found a job that was never submitted")
+	}
+}
+
+func TestQueueFull(t *testing.T) {
+	release := make(chan struct{})
+	queue := New(Options{Dir: t.TempDir(), Workers: 1, Capacity: 1}, func(ctx context.Context, job Job) (any, error) {
+		<-release
+		return nil, nil
+	})
+
+	first, err := queue.Submit(1)
+	if err != nil {
+		t.Fatalf("Submit failed: %v", err)
+	}
+	// Wait for the worker to take the first job, freeing the only slot
+	for {
+		if job, _ := queue.Get(first.ID); job.Status == Running {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if _, err := queue.Submit(2); err != nil {
+		t.Fatalf("Submit failed: %v", err)
+	}
+	if _, err := queue.Submit(3); !errors.Is(err, ErrQueueFull) {
+		t.Errorf("Submit on a full queue returned %v, want ErrQueueFull", err)
+	}
+
+	close(release)
+	queue.Close()
+	if _, err := queue.Submit(4); !errors.Is(err, ErrClosed) {
+		t.Errorf("Submit after Close returned %v, want ErrClosed", err)
+	}
+}
+
+func TestQueueCancel(t *testing.T) {
+	started := make(chan struct{})
+	queue := New(Options{Dir: t.TempDir(), Workers: 1}, func(ctx context.Context, job Job) (any, error) {
+		close(started)
+		<-ctx.Done()
+		return "partial", ctx.Err()
+	})
+	defer queue.Close()
+
+	running, err := queue.Submit("running")
+	if err != nil {
+		t.Fatalf("Submit failed: %v", err)
+	}
+	queued, err := queue.Submit("queued")
+	if err != nil {
+		t.Fatalf("Submit failed: %v", err)
+	}
+	<-started
+
+	// The queued job is cancelled before it starts
+	job, err := queue.Cancel(queued.ID)
+	if err != nil || job.Status != Cancelled {
+		t.Errorf("Cancel(queued) = %+v, %v, want a cancelled job", job, err)
+	}
+
+	// The running job is cancelled once its Func returns
+	if _, err := queue.Cancel(running.ID); err != nil {
+		t.Fatalf("Cancel(running) failed: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	for _, id := range []string{running.ID, queued.ID} {
+		if _, err := queue.Wait(ctx, id); err != nil {
+			t.Fatalf("Wait failed: %v", err)
+		}
+	}
+	job, _ = queue.Get(running.ID)
+	if job.Status != Cancelled || job.Result != "partial" || job.FinishedAt == nil {
+		t.Errorf("cancelled job = %+v, want cancelled with its partial result", job)
+	}
+	job, _ = queue.Get(queued.ID)
+	if job.StartedAt != nil {
+		t.Errorf("job cancelled while queued was started: %+v", job)
+	}
+
+	if _, err := queue.Cancel(running.ID); !errors.Is(err, ErrFinished) {
+		t.Errorf("Cancel of a finished job returned %v, want ErrFinished", err)
+	}
+	if _, err := queue.Cancel("missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Cancel of a missing job returned %v, want ErrNotFound", err)
+	}
+}
+
+func TestPrune(t *testing.T) {
+	release := make(chan struct{})
+	queue := New(Options{Dir: t.TempDir()}, func(ctx context.Context, job Job) (any, error) {
+		if job.Params == "running" {
+			<-release
+		}
+		return nil, nil
+	})
+	defer queue.Close()
+	defer close(release)
+
+	done, err := queue.Submit("done")
+	if err != nil {
+		t.Fatalf("Submit failed: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := queue.Wait(ctx, done.ID); err != nil {
+		t.Fatalf("Wait failed: %v", err)
+	}
+	running, err := queue.Submit("running")
+	if err != nil {
+		t.Fatalf("Submit failed: %v", err)
+	}
+
+	// Jobs that finished recently are kept
+	if pruned := queue.Prune(time.Hour); len(pruned) != 0 {
+		t.Errorf("Prune(1h) = %+v, want no job", pruned)
+	}
+
+	pruned := queue.Prune(0)
+	if len(pruned) != 1 || pruned[0].ID != done.ID {
+		t.Errorf("Prune(0) = %+v, want the finished job", pruned)
+	}
+	if _, ok := queue.Get(done.ID); ok {
+		t.Error("the pruned job is still listed")
+	}
+	if _, ok := queue.Get(running.ID); !ok {
+		t.Error("the unfinished job was pruned")
+	}
+}
@@ -2,56 +2,42 @@ package main
 
 import (
 	"context"
-	"encoding/csv"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"math"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"strconv"
 	"strings"
-	"sync"
+	"syscall"
 	"time"
 
-	"github.com/go-rod/rod"
-	"github.com/go-rod/rod/lib/launcher"
-	"github.com/go-rod/rod/lib/proto"
 	"github.com/schollz/progressbar/v3"
 	"github.com/spf13/cobra"
+
+	"mapsscrap/browserpool"
+	"mapsscrap/geo"
+	"mapsscrap/phone"
+	"mapsscrap/pipeline"
+	"mapsscrap/progress"
+	"mapsscrap/scraper"
+	"mapsscrap/store"
 )
 
 const (
-	kmPerDegree = 111.0 // Approximate number of kilometers per degree of latitude
-	maxRecommendedRadiusKm = 25.0  // Maximum recommended radius for scraping
-	gridStepKm  = 2.5   // Distance between grid points in kilometers
-	maxWorkers  = 4     // Maximum number of concurrent workers
-	taskTimeout = 45 * time.Second // Timeout for each scraping task
+	maxRecommendedRadiusKm = 25.0                   // Maximum recommended radius for scraping
+	defaultZoom            = 15                     // Google Maps zoom level used for each search
+	maxWorkers             = pipeline.SearchWorkers // Maximum number of concurrent workers
+	taskTimeout            = pipeline.CellTimeout   // Timeout for each scraping task
 )
 
 // SearchParams holds the parameters for the search operation
-type SearchParams struct {
-	Latitude   float64
-	Longitude  float64
-	Query string
-	RadiusKm   float64
-}
+type SearchParams = pipeline.SearchParams
 
 // Place represents a business place with its details
-type Place struct {
-	Name        string      `json:"name"`
-	Address     string      `json:"address"`
-	Stars       float64     `json:"rating"`
-	Reviews     int         `json:"reviews"`
-	Coordinates Coordinates `json:"location"`
-	Hours       string      `json:"hours,omitempty"`
-	Phone       string      `json:"phone,omitempty"`
-	Website     string      `json:"website,omitempty"`
-	GoogleURL   string      `json:"google_url,omitempty"`
-}
-
-// Coordinates represents a geographical point with latitude and longitude
-type Coordinates struct {
-	Lat float64 `json:"lat"`
-	Lon float64 `json:"lon"`
-}
+type Place = scraper.Place
 
 // Global variables for command-line flags
 // Need to have these because of the way Cobra works
@@ -60,26 +46,114 @@ var (
 	longitude  float64
 	searchTerm string
 	radiusKm   float64
+	areaFile   string
+	layoutName string
+	zoom       int
+	overlapPct float64
+	adaptive   bool
+	minCellKm  float64
+	resumePath string
+	withinOnly bool
+	details    bool
+	skipClosed bool
+	region     string
+	outputPath string
+	formats    []string
+	dbPath     string
+	baseURL    string
+	// selectorsPath is the --selectors file, loaded into selectors before searching
+	selectorsPath string
+	selectors     *scraper.Profile
+	// progressMode is the --progress flag, events the writer it opens
+	progressMode string
+	progressFD   int
+	events       *progress.Writer
 )
 
 // runSearchCmd runs the runSearch job
-// It is the only command in this CLI tool
+// It is the root command, the diff, selftest and open subcommands are added to it
 var runSearchCmd = &cobra.Command{
 	Use:   "mapsscrap",
 	Short: "A Google Maps business scraper",
 	Long: `mapsscrap is a CLI tool that scrapes business information from Google Maps 
 using web automation. It collects details like business names, addresses, 
 ratings, review counts, and phone numbers for a given search term and location.`,
+	// Every command that scrapes shares the selector profile
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		var err error
+		if events, err = progress.Open(progressMode, progressFD); err != nil {
+			return err
+		}
+		selectors, err = scraper.LoadProfile(selectorsPath)
+		return err
+	},
 	RunE: func(cmd *cobra.Command, args []string) error {
+		if resumePath != "" {
+			checkpoint, err := loadCheckpoint(resumePath)
+			if err != nil {
+				return err
+			}
+			if cmd.Flags().Changed("db") {
+				checkpoint.DBPath = dbPath
+			}
+			// Failed cells are reported after the usage was validated
+			cmd.SilenceUsage = true
+			return resumeSearch(checkpoint)
+		}
+
+		if searchTerm == "" {
+			return fmt.Errorf("required flag(s) \"query\" not set")
+		}
+
+		for _, format := range formats {
+			if _, ok := outputFormats[format]; !ok {
+				return fmt.Errorf("unknown output format %q, expected csv, json, ndjson or geojson", format)
+			}
+		}
+		if _, ok := phone.Lookup(region); !ok {
+			return fmt.Errorf("unknown region %q, expected one of %s", region, strings.Join(phone.Regions(), ", "))
+		}
+
 		params := SearchParams{
 			Latitude:   latitude,
 			Longitude:  longitude,
-			Query: searchTerm,
+			Query:      searchTerm,
 			RadiusKm:   radiusKm,
+			Zoom:       zoom,
+			OverlapPct: overlapPct,
+			Adaptive:   adaptive,
+			MinCellKm:  minCellKm,
+			WithinOnly: withinOnly,
+			Details:    details || skipClosed,
+			SkipClosed: skipClosed,
+			Region:     strings.ToUpper(region),
 		}
 
-		runSearch(params)
-		return nil
+		layout, err := geo.ParseLayout(layoutName)
+		if err != nil {
+			return err
+		}
+		params.Layout = layout
+
+		if err := geo.ValidateZoom(zoom); err != nil {
+			return fmt.Errorf("invalid --zoom: %w", err)
+		}
+		if overlapPct < 0 || overlapPct >= 100 {
+			return fmt.Errorf("--overlap must be between 0 and 100, got %.1f", overlapPct)
+		}
+
+		if areaFile != "" {
+			area, err := geo.LoadArea(areaFile)
+			if err != nil {
+				return err
+			}
+			params.Area = area
+		} else if !cmd.Flags().Changed("lat") || !cmd.Flags().Changed("lon") {
+			return fmt.Errorf("either --lat and --lon or --area must be set")
+		}
+
+		cmd.SilenceUsage = true
+		return runSearch(params, outputPath, formats, dbPath)
 	},
 }
 
@@ -89,10 +163,24 @@ func init() {
 	runSearchCmd.Flags().Float64VarP(&longitude, "lon", "o", 0, "Longitude of search center")
 	runSearchCmd.Flags().StringVarP(&searchTerm, "query", "q", "", "Search query")
 	runSearchCmd.Flags().Float64VarP(&radiusKm, "radius", "r", 2.0, "Search radius in kilometers")
-
-	runSearchCmd.MarkFlagRequired("lat")
-	runSearchCmd.MarkFlagRequired("lon")
-	runSearchCmd.MarkFlagRequired("query")
+	runSearchCmd.Flags().StringVar(&areaFile, "area", "", "GeoJSON file with a Polygon/MultiPolygon search area (overrides --lat, --lon and --radius)")
+	runSearchCmd.Flags().StringVar(&layoutName, "layout", string(geo.LayoutSquare), "Grid layout: square (fixed 2.5 km step) or hex (step derived from --zoom and --overlap)")
+	runSearchCmd.Flags().IntVar(&zoom, "zoom", defaultZoom, "Google Maps zoom level for each search point, 3 to 21")
+	runSearchCmd.Flags().Float64Var(&overlapPct, "overlap", 20, "Percentage of overlap between adjacent viewports in the hex layout")
+	runSearchCmd.Flags().BoolVar(&adaptive, "adaptive", false, "Split cells that hit the result list cap into four smaller cells at a higher zoom")
+	runSearchCmd.Flags().Float64Var(&minCellKm, "min-cell", 0.5, "Smallest cell size in kilometers for --adaptive")
+	runSearchCmd.Flags().BoolVar(&withinOnly, "within-radius", false, "Drop places located outside the search radius (or the --area polygon)")
+	runSearchCmd.Flags().BoolVar(&details, "details", false, "Open every place page for its category, price level, plus code, status, claimed flag and weekly hours")
+	runSearchCmd.Flags().BoolVar(&skipClosed, "skip-closed", false, "Drop temporarily and permanently closed places (implies --details)")
+	runSearchCmd.Flags().StringVar(&region, "region", "MX", "Region whose numbering plan validates and formats phones: "+strings.Join(phone.Regions(), ", "))
+	runSearchCmd.Flags().StringVar(&outputPath, "output", "", "Output file path, the extension is set per format (default prospects_<query>_<radius>_<time>)")
+	runSearchCmd.Flags().StringSliceVar(&formats, "format", []string{"csv"}, "Output format: csv, json, ndjson or geojson (repeatable)")
+	runSearchCmd.Flags().StringVar(&dbPath, "db", os.Getenv("MAPSSCRAP_DB"), "SQLite database where places are upserted across runs (default $MAPSSCRAP_DB)")
+	runSearchCmd.PersistentFlags().StringVar(&baseURL, "base-url", scraper.DefaultBaseURL, "Google Maps URL to search against, e.g. a local fixture server")
+	runSearchCmd.PersistentFlags().StringVar(&selectorsPath, "selectors", os.Getenv("MAPSSCRAP_SELECTORS"), "JSON selector profile overriding the built-in CSS selectors (default $MAPSSCRAP_SELECTORS)")
+	runSearchCmd.Flags().StringVar(&resumePath, "resume", "", "Resume an interrupted search from its checkpoint file (other search flags are ignored)")
+	runSearchCmd.Flags().StringVar(&progressMode, "progress", progress.ModeBar, "Progress output: bar, or json to write one event per line to --progress-fd")
+	runSearchCmd.Flags().IntVar(&progressFD, "progress-fd", progress.DefaultFD, "File descriptor the --progress=json events are written to")
 }
 
 // main is the entry point of the application
@@ -100,10 +188,16 @@ func main() {
 	Execute()
 }
 
+// errDegraded is returned by selftest when the report is below its
+// thresholds. The report already explains why, so it is not printed.
+var errDegraded = errors.New("selftest failed")
+
 // Execute runs the root command and handles any errors
 func Execute() {
 	if err := runSearchCmd.Execute(); err != nil {
-		fmt.Println(err)
+		if !errors.Is(err, errDegraded) {
+			fmt.Println(err)
+		}
 		os.Exit(1)
 	}
 }
@@ -111,99 +205,208 @@ func Execute() {
 // runSearch executes the search operation based on provided parameters
 // It generates a grid of points within the specified radius and launches workers
 // to scrape Google Maps for business information at each point.
-func runSearch(params SearchParams) {
+// Results are written to outputPath in each of the given formats and, when
+// dbPath is set, recorded in the SQLite database.
+func runSearch(params SearchParams, outputPath string, formats []string, dbPath string) error {
 	if params.RadiusKm > maxRecommendedRadiusKm {
 		fmt.Println("Radius is very large, this may take a long time.")
 	}
 
-	// Generate grid points around the center coordinates
-	gridPoints := generateSearchGrid(
-		params.Latitude,
-		params.Longitude,
-		params.RadiusKm,
-		gridStepKm,
-	)
+	// Cells inside the area, or around the center coordinates
+	params, cells := pipeline.Plan(params)
+
+	// Without --output, results are saved in the working directory
+	savePath := outputPath
+	if savePath == "" {
+		workDir, err := os.Getwd()
+		if err != nil {
+			return fmt.Errorf("failed to get current working directory: %w", err)
+		}
+		savePath = filepath.Join(workDir, pipeline.FileName(params, time.Now()))
+	}
+
+	checkpoint := newCheckpoint(params, cells, savePath, formats, dbPath)
+	fmt.Printf("Progress is saved to %s, resume an interrupted run with --resume.\n", checkpoint.path)
+	return finishSearch(checkpoint)
+}
+
+// resumeSearch continues an interrupted search from its checkpoint
+func resumeSearch(checkpoint *Checkpoint) error {
+	fmt.Printf("Resuming search for '%s': %d locations done, %d pending, %d places collected.\n",
+		checkpoint.Params.Query, len(checkpoint.Done), len(checkpoint.Pending), len(checkpoint.Places))
+	return finishSearch(checkpoint)
+}
 
-	// Validate grid points
-	allPlaces := launchScrappingWorkers(params, gridPoints)
+// finishSearch scrapes the pending cells of the checkpoint and saves the results
+// to the checkpoint's output file. The checkpoint is removed once every cell was
+// searched and every output written. On SIGINT or SIGTERM the places found so
+// far are saved and the checkpoint is kept, so the search can be resumed.
+// Cells that failed are kept in the checkpoint as well, to be retried with
+// --resume, and reported as an error.
+func finishSearch(checkpoint *Checkpoint) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	allPlaces := launchScrappingWorkers(ctx, checkpoint)
+	interrupted := ctx.Err() != nil
+	finished := progress.Event{Type: progress.Finished, Stage: progress.StageScraping}
+	if interrupted {
+		finished.Message = "interrupted"
+	}
 	if len(allPlaces) == 0 {
 		fmt.Println("No places found for the given search parameters.")
-		return
+		events.Emit(finished)
+		return checkpoint.finish(interrupted, true)
 	}
 
-	// Save results to CSV file
-	workDir, err := os.Getwd()
-	if err != nil {
-		fmt.Printf("Error getting current working directory: %v\n", err)
-		return
+	// Details take as long as the search, an interrupted search skips them.
+	// The output is written once they are read.
+	if checkpoint.Params.Details && !interrupted {
+		events.Emit(finished)
+		allPlaces = fetchDetails(ctx, allPlaces, checkpoint.Params)
+		interrupted = ctx.Err() != nil
+		finished = progress.Event{Type: progress.Finished, Stage: progress.StageDetails}
+		if interrupted {
+			finished.Message = "interrupted"
+		}
+	}
+
+	saved := true
+	for _, format := range checkpoint.Formats {
+		path := formatPath(checkpoint.OutputPath, format)
+		if err := outputFormats[format](allPlaces, path); err != nil {
+			fmt.Printf("Error saving places to %s: %v\n", format, err)
+			saved = false
+			continue
+		}
+		fmt.Printf("%d places saved to %s\n", len(allPlaces), path)
+		if finished.Output == "" {
+			finished.Output = path
+		}
 	}
-	now := time.Now()
-	// Sanitize query for filename (replace spaces and special characters)
-	sanitizedQuery := strings.ReplaceAll(params.Query, " ", "_")
-	sanitizedQuery = strings.ReplaceAll(sanitizedQuery, "/", "_")
-	sanitizedQuery = strings.ReplaceAll(sanitizedQuery, "\\", "_")
-	fileName := fmt.Sprintf("prospects_%s_%.0fkm_%s.csv", sanitizedQuery, params.RadiusKm, now.Format("2006-01-02_15-04-05"))
-	savePath := filepath.Join(workDir, fileName)
-	if err := savePlacesToCSV(allPlaces, savePath); err != nil {
-		fmt.Printf("Error saving places to CSV: %v\n", err)
-		return
+
+	if checkpoint.DBPath != "" {
+		run, err := savePlacesToDB(checkpoint, allPlaces)
+		if err != nil {
+			fmt.Printf("Error saving places to database: %v\n", err)
+			saved = false
+		} else {
+			fmt.Printf("Run %d recorded in %s: %d places, %d new\n", run.ID, checkpoint.DBPath, run.PlaceCount, run.NewCount)
+		}
 	}
-	fmt.Printf("%d places saved to %s\n", len(allPlaces), savePath)
+
+	finished.Places = len(allPlaces)
+	events.Emit(finished)
+
+	return checkpoint.finish(interrupted, saved)
 }
 
 // launchScrappingWorkers starts multiple goroutines to scrape Google Maps for business information
-// at various grid points around the specified center coordinates.
-func launchScrappingWorkers(params SearchParams, gridPoints []Coordinates) []Place {
+// at the pending cells of the checkpoint, saving the checkpoint after every batch.
+// In adaptive mode a cell whose result list is full is split into four
+// sub-cells at a higher zoom and re-queued, down to params.MinCellKm, keeping
+// the sub-cells inside the search area or radius. No batch is started once ctx is done; the cells left stay pending.
+func launchScrappingWorkers(ctx context.Context, checkpoint *Checkpoint) []Place {
+	params := checkpoint.Params
+	queue := checkpoint.Pending
+
 	text := fmt.Sprintf("Searching %d locations in a radius of %.1f km around (%.6f, %.6f) for query '%s'.",
-		len(gridPoints), params.RadiusKm, params.Latitude, params.Longitude, params.Query)
+		len(queue), params.RadiusKm, params.Latitude, params.Longitude, params.Query)
+	if params.Area != nil {
+		text = fmt.Sprintf("Searching %d locations inside %d polygon(s) for query '%s'.",
+			len(queue), len(params.Area.Polygons), params.Query)
+	}
 	fmt.Println(text)
 
-	estimatedTime := estimateJobTime(len(gridPoints), maxWorkers)
+	estimatedTime := estimateJobTime(len(queue), maxWorkers)
 	barText := fmt.Sprintf("Please wait... Estimated time: %s", estimatedTime)
-	bar := progressbar.Default(int64(len(gridPoints)), barText)
-
-	maxWorkers := maxWorkers
-	results := make(chan []Place, len(gridPoints))
-	var wg sync.WaitGroup
-
-	// Process grid points in batches
-	for i := 0; i < len(gridPoints); i += maxWorkers {
-		end := i + maxWorkers
-		if end > len(gridPoints) {
-			end = len(gridPoints)
-		}
-
-		// Launch workers for this batch
-		for j := i; j < end; j++ {
-			wg.Add(1)
-			params := SearchParams{
-				Latitude:   gridPoints[j].Lat,
-				Longitude:  gridPoints[j].Lon,
-				Query: params.Query,
-				RadiusKm:   1.0,
+	bar := newProgressBar(len(queue), barText)
+
+	// Workers share a few long-lived browsers instead of launching one per cell
+	pool := pipeline.NewPool("")
+	defer pool.Close()
+
+	search := pipeline.Search{
+		Params:    params,
+		Pool:      pool,
+		BaseURL:   baseURL,
+		Selectors: selectors,
+		Workers:   maxWorkers,
+		Timeout:   taskTimeout,
+		Progress: func(event progress.Event) {
+			events.Emit(event)
+			switch event.Type {
+			case progress.PointDone:
+				// Adaptive searches add the cells they split
+				if event.Total != bar.GetMax() {
+					bar.ChangeMax(event.Total)
+				}
+				bar.Set(event.Done)
+				bar.Describe(fmt.Sprintf("%s, %d places found", barText, event.Places))
+			case progress.Error:
+				fmt.Printf("Error %s\n", event.Message)
 			}
-
-			go searchWorker(params, results, &wg, bar)
-		}
-
-		// Wait for batch to complete
-		wg.Wait()
-		time.Sleep(2 * time.Second) // Rate limiting between batches
+		},
+		Checkpoint: func(state pipeline.State) {
+			checkpoint.Pending, checkpoint.Done, checkpoint.Failed = state.Pending, state.Done, state.Failed
+			checkpoint.Places = state.Places
+			if err := checkpoint.save(); err != nil {
+				fmt.Printf("Error saving checkpoint: %v\n", err)
+			}
+		},
 	}
+	result := search.Run(ctx, pipeline.State{
+		Pending: queue,
+		Done:    checkpoint.Done,
+		Failed:  checkpoint.Failed,
+		Places:  checkpoint.Places,
+	})
+
+	if ctx.Err() != nil {
+		fmt.Printf("\nSearch interrupted, %d locations left pending. Saving the places found so far.\n", len(result.Pending))
+	}
+	if result.SplitCells > 0 {
+		fmt.Printf("%d saturated cells were split into smaller cells.\n", result.SplitCells)
+	}
+	if result.Outside > 0 {
+		fmt.Printf("%d results outside the search area were dropped.\n", result.Outside)
+	}
+	return result.Places
+}
 
-	// Collect all results
-	allPlaces := make([]Place, 0)
-	close(results)
-
-	// Process results and remove duplicates
-	for places := range results {
-		for _, place := range places {
-			if !containsPlace(allPlaces, place) {
-				allPlaces = append(allPlaces, place)
+// fetchDetails runs the details stage on the places: their category, price
+// level, plus code, status, unclaimed flag and weekly hours. Places whose page
+// fails to load, or left when ctx is done, are kept as they are. With
+// params.SkipClosed closed places are dropped.
+func fetchDetails(ctx context.Context, places []Place, params SearchParams) []Place {
+	fmt.Printf("Fetching details of %d places.\n", len(places))
+	bar := newProgressBar(len(places), "Fetching details...")
+
+	pool := pipeline.NewPool("")
+	defer pool.Close()
+
+	details := pipeline.Details{
+		Pool:       pool,
+		Selectors:  selectors,
+		Region:     params.Region,
+		SkipClosed: params.SkipClosed,
+		Workers:    maxWorkers,
+		Timeout:    taskTimeout,
+		Progress: func(event progress.Event) {
+			events.Emit(event)
+			switch event.Type {
+			case progress.PointDone:
+				bar.Set(event.Done)
+			case progress.Error:
+				fmt.Printf("Error fetching details of %s: %s\n", event.Place, event.Message)
 			}
-		}
+		},
+	}
+	places, closed := details.Run(ctx, places)
+	if closed > 0 {
+		fmt.Printf("%d closed places were dropped.\n", closed)
 	}
-	return allPlaces
+	return places
 }
 
 // estimateJobTime calculates the estimated time to complete the job.
@@ -227,237 +430,473 @@ func estimateJobTime(numTasks int, maxWorkers int) time.Duration {
     return totalTime
 }
 
-// searchWorker performs the actual scraping for a single grid point.
-// It launches a browser, navigates to Google Maps, and extracts information.
-func searchWorker(params SearchParams, results chan<- []Place, wg *sync.WaitGroup, bar *progressbar.ProgressBar) {
-	defer wg.Done()
-	defer bar.Add(1)
-
-	// Create context with timeout
-	ctx, cancel := context.WithTimeout(context.Background(), taskTimeout)
-	defer cancel()
+// Checkpoint records the progress of a search so an interrupted run can be
+// resumed. It is written next to the output CSV after every batch.
+type Checkpoint struct {
+	Params     SearchParams `json:"params"`
+	OutputPath string       `json:"output_path"`
+	Formats    []string     `json:"formats"`
+	DBPath     string       `json:"db,omitempty"`
+	StartedAt  time.Time    `json:"started_at"`
+	Pending    []geo.Cell   `json:"pending"`
+	Done       []geo.Cell   `json:"done"`
+	Failed     []geo.Cell   `json:"failed,omitempty"`
+	Places     []Place      `json:"places"`
+
+	path string
+}
 
-	// Create done channel for timeout handling
-	done := make(chan bool)
-	var places []Place
-	var err error
+// newCheckpoint creates the checkpoint of a new search over the cells
+func newCheckpoint(params SearchParams, pending []geo.Cell, outputPath string, formats []string, dbPath string) *Checkpoint {
+	return &Checkpoint{
+		Params:     params,
+		OutputPath: outputPath,
+		Formats:    formats,
+		DBPath:     dbPath,
+		StartedAt:  time.Now(),
+		Pending:    pending,
+		Places:     []Place{},
+		path:       formatPath(outputPath, "checkpoint.json"),
+	}
+}
 
-	// Run scraping in goroutine
-	go func() {
-		places, err = scrapeGoogleMaps(params)
-		if err != nil {
-			fmt.Printf("Error searching at point %.6f, %.6f: %v\n", params.Latitude, params.Longitude, err)
-		}
-		done <- true
-	}()
+// loadCheckpoint reads a checkpoint file. Cells that failed in the previous
+// run are queued again.
+func loadCheckpoint(path string) (*Checkpoint, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read checkpoint: %w", err)
+	}
 
-	// Wait for either completion or timeout
-	select {
-	case <-done:
-		if err == nil {
-			results <- places
-		}
-	case <-ctx.Done():
-		fmt.Printf("Search timed out for coordinates: %.6f, %.6f\n", params.Latitude, params.Longitude)
+	var checkpoint Checkpoint
+	if err := json.Unmarshal(data, &checkpoint); err != nil {
+		return nil, fmt.Errorf("invalid checkpoint file %s: %w", path, err)
 	}
+	checkpoint.path = path
+	checkpoint.Pending = append(checkpoint.Pending, checkpoint.Failed...)
+	checkpoint.Failed = nil
+	if checkpoint.Places == nil {
+		checkpoint.Places = []Place{}
+	}
+	if len(checkpoint.Formats) == 0 {
+		checkpoint.Formats = []string{"csv"}
+	}
+	if checkpoint.StartedAt.IsZero() {
+		checkpoint.StartedAt = time.Now()
+	}
+	// Checkpoints written before phones were validated by region
+	if checkpoint.Params.Region == "" {
+		checkpoint.Params.Region = "MX"
+	}
+	return &checkpoint, nil
 }
 
-// containsPlace checks if a place already exists in the list of places.
-func containsPlace(places []Place, newPlace Place) bool {
-	for _, p := range places {
-		if p.Name == newPlace.Name && p.Address == newPlace.Address {
-			return true
-		}
+// save writes the checkpoint atomically so a kill never leaves a truncated file
+func (c *Checkpoint) save() error {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return fmt.Errorf("failed to encode checkpoint: %w", err)
 	}
-	return false
+
+	tmpPath := c.path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write checkpoint: %w", err)
+	}
+	return os.Rename(tmpPath, c.path)
 }
 
-// generateSearchGrid creates a grid of coordinates around the center point
-// within the specified radius. The grid points are spaced by stepKm.
-func generateSearchGrid(centerLat, centerLng float64, radiusKm float64, stepKm float64) []Coordinates {
-	// Calculate degree deltas
-	latDelta := radiusKm / kmPerDegree
-	// Longitude degrees per km varies with latitude
-	lngDelta := radiusKm / (kmPerDegree * math.Cos(centerLat*math.Pi/180.0))
+// finish removes the checkpoint once the search is complete: not interrupted,
+// with every output saved and no failed cells. Failed cells are reported as an
+// error, so the command exits with a non-zero status.
+func (c *Checkpoint) finish(interrupted, saved bool) error {
+	if len(c.Failed) > 0 {
+		return fmt.Errorf("%d locations failed, run again with --resume %s to retry them", len(c.Failed), c.path)
+	}
+	if saved && !interrupted {
+		c.remove()
+	}
+	return nil
+}
 
-	// Calculate steps
-	latSteps := int(math.Ceil(2 * radiusKm / stepKm))
-	lngSteps := int(math.Ceil(2 * radiusKm / stepKm))
+// remove deletes the checkpoint file once the search is complete
+func (c *Checkpoint) remove() {
+	if err := os.Remove(c.path); err != nil && !os.IsNotExist(err) {
+		fmt.Printf("Error removing checkpoint: %v\n", err)
+	}
+}
 
-	// Generate grid points
-	points := make([]Coordinates, 0, latSteps*lngSteps)
+// outputFormats maps each --format value to the function writing it
+var outputFormats = map[string]func([]Place, string) error{
+	"csv":     pipeline.WritePlacesCSV,
+	"json":    savePlacesToJSON,
+	"ndjson":  savePlacesToNDJSON,
+	"geojson": savePlacesToGeoJSON,
+}
 
-	for i := 0; i < latSteps; i++ {
-		for j := 0; j < lngSteps; j++ {
-			lat := centerLat - latDelta + (2 * latDelta * float64(i) / float64(latSteps-1))
-			lon := centerLng - lngDelta + (2 * lngDelta * float64(j) / float64(lngSteps-1))
-			points = append(points, Coordinates{Lat: lat, Lon: lon})
-		}
+// newProgressBar returns the default progress bar, or a silent one when
+// progress is reported as JSON events
+func newProgressBar(max int, description string) *progressbar.ProgressBar {
+	if events != nil {
+		return progressbar.DefaultSilent(int64(max), description)
 	}
+	return progressbar.Default(int64(max), description)
+}
 
-	return points
+// formatPath replaces the extension of the output path with the one of the format
+func formatPath(outputPath string, format string) string {
+	return strings.TrimSuffix(outputPath, filepath.Ext(outputPath)) + "." + format
 }
 
-// scrapeGoogleMaps performs the actual scraping of Google Maps
-// It maps HTML elements to relevant fields.
-func scrapeGoogleMaps(params SearchParams) ([]Place, error) {
-	// Launch browser
-	launch := launcher.New().
-		Headless(true).
-		Devtools(false)
+// savePlacesToDB records the run of the checkpoint and upserts its places in
+// the SQLite database of the checkpoint.
+func savePlacesToDB(checkpoint *Checkpoint, places []Place) (store.Run, error) {
+	return pipeline.SaveRun(checkpoint.DBPath, checkpoint.Params, checkpoint.OutputPath, checkpoint.StartedAt, places)
+}
 
-	url, err := launch.Launch()
+// savePlacesToJSON saves the list of places as a JSON array.
+func savePlacesToJSON(places []Place, filename string) error {
+	file, err := os.Create(filename)
 	if err != nil {
-		return nil, fmt.Errorf("failed to launch browser: %w", err)
+		return fmt.Errorf("failed to create JSON file: %w", err)
 	}
+	defer file.Close()
 
-	browser := rod.New().ControlURL(url).MustConnect()
-	defer browser.Close()
-
-	page := browser.MustPage()
-	defer page.Close()
+	encoder := json.NewEncoder(file)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(places); err != nil {
+		return fmt.Errorf("failed to write JSON: %w", err)
+	}
+	return nil
+}
 
-	// Navigate to Google Maps
-	mapURL := fmt.Sprintf("https://www.google.com/maps/search/%s/@%f,%f,15z",
-		params.Query,
-		params.Latitude,
-		params.Longitude,
-	)
+// savePlacesToNDJSON saves the places as newline delimited JSON, one place per line.
+func savePlacesToNDJSON(places []Place, filename string) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return fmt.Errorf("failed to create NDJSON file: %w", err)
+	}
+	defer file.Close()
 
-	if err := page.Navigate(mapURL); err != nil {
-		return nil, fmt.Errorf("failed to navigate: %w", err)
+	encoder := json.NewEncoder(file)
+	for _, place := range places {
+		if err := encoder.Encode(place); err != nil {
+			return fmt.Errorf("failed to write record to NDJSON: %w", err)
+		}
 	}
+	return nil
+}
 
-	page.MustWaitStable()
+// geoJSONFeature is a GeoJSON Point feature
+type geoJSONFeature struct {
+	Type       string         `json:"type"`
+	Geometry   *geoJSONPoint  `json:"geometry"`
+	Properties map[string]any `json:"properties"`
+}
 
-	listDivClass := "m6QErb.DxyBCb.kA9KIf.dS8AEf"
-	places := []Place{}
+// geoJSONPoint is a GeoJSON Point geometry, coordinates are [lon, lat]
+type geoJSONPoint struct {
+	Type        string     `json:"type"`
+	Coordinates [2]float64 `json:"coordinates"`
+}
 
-	container := page.MustElement("div." + listDivClass)
-	container.MustWaitVisible()
+// savePlacesToGeoJSON saves the places as a GeoJSON FeatureCollection with one
+// Point feature per place. All place attributes are stored as properties; places
+// without a known location get a null geometry.
+func savePlacesToGeoJSON(places []Place, filename string) error {
+	features := make([]geoJSONFeature, 0, len(places))
+	for _, place := range places {
+		// Reuse the JSON field names of Place for the properties
+		data, err := json.Marshal(place)
+		if err != nil {
+			return fmt.Errorf("failed to encode place: %w", err)
+		}
+		properties := map[string]any{}
+		if err := json.Unmarshal(data, &properties); err != nil {
+			return fmt.Errorf("failed to encode place: %w", err)
+		}
+		delete(properties, "location")
 
-	// move mouse pointer to list which is first third of screen and scroll
-	for i := 0; i < 10; i++ { // 10
-		page.Mouse.MoveTo(proto.Point{X: 250, Y: 300})
-		page.Mouse.Scroll(0.0, 6000.0, 30)
-		// page.Mouse.Scroll(0.0, 1000.0, 5)
-		time.Sleep(500 * time.Millisecond)
+		feature := geoJSONFeature{Type: "Feature", Properties: properties}
+		if place.HasLocation() {
+			feature.Geometry = &geoJSONPoint{
+				Type:        "Point",
+				Coordinates: [2]float64{place.Coordinates.Lon, place.Coordinates.Lat},
+			}
+		}
+		features = append(features, feature)
 	}
 
-	placeElements := container.MustElements("div.Nv2PK")
+	file, err := os.Create(filename)
+	if err != nil {
+		return fmt.Errorf("failed to create GeoJSON file: %w", err)
+	}
+	defer file.Close()
 
-	for _, element := range placeElements {
-		place := extractPlaceDetails(element, params)
-		if place.Name != "" {
-			places = append(places, place)
-		}
+	collection := struct {
+		Type     string           `json:"type"`
+		Features []geoJSONFeature `json:"features"`
+	}{
+		Type:     "FeatureCollection",
+		Features: features,
+	}
+	if err := json.NewEncoder(file).Encode(collection); err != nil {
+		return fmt.Errorf("failed to write GeoJSON: %w", err)
 	}
+	return nil
+}
 
-	return places, nil
+// diffFormat is the output format of the diff command
+var diffFormat string
+
+// diffCmd compares the places of two result files
+var diffCmd = &cobra.Command{
+	Use:   "diff OLD NEW",
+	Short: "Compare two result files and list added, removed and changed places",
+	Long: `diff matches the places of two result files (CSV, including the
+_with_phones.csv files of the phone scraper, JSON or NDJSON) by place ID, or by
+normalized name and address when the ID is unknown, and reports the places
+added, removed and those whose rating, reviews, phone, website or hours changed.
+Phones read from the place pages are compared only when both files have them.`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if diffFormat != "text" && diffFormat != "json" {
+			return fmt.Errorf("unknown diff format %q, expected text or json", diffFormat)
+		}
+
+		diff, err := pipeline.DiffFiles(args[0], args[1])
+		if err != nil {
+			return err
+		}
+
+		if diffFormat == "json" {
+			encoder := json.NewEncoder(os.Stdout)
+			encoder.SetIndent("", "  ")
+			return encoder.Encode(diff)
+		}
+		printDiff(diff)
+		return nil
+	},
 }
 
-// extractPlaceDetails extracts details of a place from the given element
-// It retrieves the name, address, rating, reviews, phone number, opening hours, and website
-// from the Google Maps search result element.
-func extractPlaceDetails(element *rod.Element, params SearchParams) Place {
-	place := Place{
-		Coordinates: Coordinates{
-			Lat: params.Latitude,
-			Lon: params.Longitude,
-		},
-	}
+func init() {
+	diffCmd.Flags().StringVar(&diffFormat, "format", "text", "Output format: text or json")
+	runSearchCmd.AddCommand(diffCmd)
+}
 
-	// Extract place details
-	if nameEl, err := element.Element("div.qBF1Pd.fontHeadlineSmall"); err == nil {
-		place.Name = nameEl.MustText()
+// printDiff writes a human readable summary of the diff to stdout
+func printDiff(d pipeline.PlaceDiff) {
+	fmt.Printf("Added (%d):\n", len(d.Added))
+	for _, place := range d.Added {
+		fmt.Printf("  + %s, %s\n", place.Name, place.Address)
 	}
-
-	if ratingEl, err := element.Element("span.MW4etd"); err == nil {
-		ratingText := ratingEl.MustText()
-		fmt.Sscanf(ratingText, "%f", &place.Stars)
+	fmt.Printf("Removed (%d):\n", len(d.Removed))
+	for _, place := range d.Removed {
+		fmt.Printf("  - %s, %s\n", place.Name, place.Address)
 	}
-
-	if reviewsEl, err := element.Element("span.UY7F9"); err == nil {
-		reviewText := reviewsEl.MustText()
-		fmt.Sscanf(reviewText, "(%d)", &place.Reviews)
+	fmt.Printf("Changed (%d):\n", len(d.Changed))
+	for _, change := range d.Changed {
+		fmt.Printf("  ~ %s, %s\n", change.Place.Name, change.Place.Address)
+		for _, field := range change.Changes {
+			fmt.Printf("      %s: %q -> %q\n", field.Field, field.Old, field.New)
+		}
 	}
+}
+
+var (
+	selftestCheck      = scraper.DefaultHealthCheck()
+	selftestThresholds map[string]string
+	selftestFormat     string
+)
 
-	if addressEl, err := element.Element("div.W4Efsd:nth-child(1)"); err == nil {
-		line, err := addressEl.Text()
-		if err == nil {
-			lineSplit := strings.Split(line, "·")
-			address := lineSplit[len(lineSplit)-1]
-			place.Address = address
+// selftestCmd checks that the selectors still match Google Maps
+var selftestCmd = &cobra.Command{
+	Use:   "selftest",
+	Short: "Run a known search and check the fill rate of every field",
+	Long: `selftest runs one known search and reports how many results came back and
+the share of them with a name, rating, reviews, address, phone, website and
+Google Maps URL. It exits with status 1 when the result count or a fill rate
+is below its threshold, which usually means Google changed its markup and the
+selector profile needs a fix.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if selftestFormat != "text" && selftestFormat != "json" {
+			return fmt.Errorf("unknown selftest format %q, expected text or json", selftestFormat)
+		}
+		if err := geo.ValidateZoom(selftestCheck.Zoom); err != nil {
+			return fmt.Errorf("invalid --zoom: %w", err)
+		}
+		for field, value := range selftestThresholds {
+			if _, ok := selftestCheck.Thresholds[field]; !ok {
+				return fmt.Errorf("unknown field %q in --threshold, expected one of %s", field, strings.Join(scraper.HealthFields, ", "))
+			}
+			threshold, err := strconv.ParseFloat(value, 64)
+			if err != nil || threshold < 0 || threshold > 1 {
+				return fmt.Errorf("invalid threshold %q for %s, expected a fill rate between 0 and 1", value, field)
+			}
+			selftestCheck.Thresholds[field] = threshold
+		}
+
+		cmd.SilenceUsage = true
+		report, err := runSelftest(selftestCheck)
+		if err != nil {
+			return err
 		}
-	}
 
-	if oppeningHoursEl, err := element.Element("div.W4Efsd:nth-child(2)"); err == nil {
-		line, err := oppeningHoursEl.Text()
-		if err == nil {
-			lineSplit := strings.Split(line, "·")
-			if len(lineSplit) > 1 {
-				openingHours := lineSplit[0]
-				place.Hours = openingHours
+		if selftestFormat == "json" {
+			encoder := json.NewEncoder(os.Stdout)
+			encoder.SetIndent("", "  ")
+			if err := encoder.Encode(report); err != nil {
+				return fmt.Errorf("failed to write report: %w", err)
 			}
+		} else {
+			fmt.Print(report)
 		}
+		if !report.Healthy {
+			cmd.SilenceErrors = true
+			return errDegraded
+		}
+		return nil
+	},
+}
+
+func init() {
+	selftestCmd.Flags().StringVarP(&selftestCheck.Query, "query", "q", selftestCheck.Query, "Search query of the check")
+	selftestCmd.Flags().Float64VarP(&selftestCheck.Center.Lat, "lat", "a", selftestCheck.Center.Lat, "Latitude of the search")
+	selftestCmd.Flags().Float64VarP(&selftestCheck.Center.Lon, "lon", "o", selftestCheck.Center.Lon, "Longitude of the search")
+	selftestCmd.Flags().IntVar(&selftestCheck.Zoom, "zoom", selftestCheck.Zoom, "Google Maps zoom level of the search")
+	selftestCmd.Flags().IntVar(&selftestCheck.MinResults, "min-results", selftestCheck.MinResults, "Minimum number of results")
+	selftestCmd.Flags().StringToStringVar(&selftestThresholds, "threshold", nil, "Minimum fill rate of a field, e.g. --threshold phone=0.5 (repeatable)")
+	selftestCmd.Flags().StringVar(&selftestFormat, "format", "text", "Output format: text or json")
+	runSearchCmd.AddCommand(selftestCmd)
+}
+
+// runSelftest runs the health check in a browser of its own
+func runSelftest(check scraper.HealthCheck) (scraper.HealthReport, error) {
+	pool := browserpool.New(browserpool.Options{Browsers: 1, PagesPerBrowser: 1})
+	defer pool.Close()
+
+	page, err := pool.Acquire(context.Background())
+	if err != nil {
+		return scraper.HealthReport{}, err
 	}
+	defer pool.Release(page)
+
+	return check.Run(page.Timeout(taskTimeout), baseURL, selectors), nil
+}
+
+var (
+	openAt       string
+	openTimezone string
+	openOutput   string
+	openFormats  []string
+)
 
-	if phoneEl, err := element.Element("div.W4Efsd span.UsdlK"); err == nil {
-		phone, err := phoneEl.Text()
-		if err == nil {
-			place.Phone = phone
+// openCmd keeps the places of a result file that are open at a given time
+var openCmd = &cobra.Command{
+	Use:   "open RESULTS",
+	Short: "Keep the places of a result file that are open at a given time",
+	Long: `open reads a result file (CSV, JSON or NDJSON) of a search run with
+--details and writes the places open at the time given by --at, "now" by
+default. Places whose opening hours are unknown are left out.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		location := time.Local
+		if openTimezone != "" {
+			var err error
+			if location, err = time.LoadLocation(openTimezone); err != nil {
+				return fmt.Errorf("invalid --timezone: %w", err)
+			}
+		}
+		at, err := parseOpenAt(openAt, time.Now().In(location))
+		if err != nil {
+			return err
+		}
+		for _, format := range openFormats {
+			if _, ok := outputFormats[format]; !ok {
+				return fmt.Errorf("unknown output format %q, expected csv, json, ndjson or geojson", format)
+			}
 		}
-	}
 
-	if websiteEl, err := element.Element("a.lcr4fd"); err == nil {
-		if href, err := websiteEl.Attribute("href"); err == nil {
-			place.Website = *href
+		places, err := pipeline.LoadPlaces(args[0])
+		if err != nil {
+			return err
 		}
-	}
 
-	// Extract Google Maps URL - look for the main business link
-	if googleUrlEl, err := element.Element("a.hfpxzc"); err == nil {
-		if href, err := googleUrlEl.Attribute("href"); err == nil {
-			place.GoogleURL = *href
+		open, unknown := filterOpenPlaces(places, at)
+		fmt.Printf("%d of %d places are open at %s.\n", len(open), len(places), at.Format("Mon 2006-01-02 15:04 MST"))
+		if unknown > 0 {
+			fmt.Printf("%d places have no opening hours; search with --details to get them.\n", unknown)
 		}
-	}
 
-	return place
+		output := openOutput
+		if output == "" {
+			output = strings.TrimSuffix(args[0], filepath.Ext(args[0])) + "_open"
+		}
+		for _, format := range openFormats {
+			path := formatPath(output, format)
+			if err := outputFormats[format](open, path); err != nil {
+				return fmt.Errorf("failed to save places to %s: %w", format, err)
+			}
+			fmt.Printf("%d places saved to %s\n", len(open), path)
+		}
+		return nil
+	},
 }
 
-// savePlacesToCSV saves the list of places to a CSV file.
-func savePlacesToCSV(places []Place, filename string) error {
-	file, err := os.Create(filename)
-	if err != nil {
-		return fmt.Errorf("failed to create CSV file: %w", err)
-	}
-	defer file.Close()
+func init() {
+	openCmd.Flags().StringVar(&openAt, "at", "now", `Time to check: "now", "15:04" (today), "monday 15:04" or "2006-01-02 15:04"`)
+	openCmd.Flags().StringVar(&openTimezone, "timezone", "", "IANA time zone of the places, e.g. America/Mexico_City (default the local time zone)")
+	openCmd.Flags().StringVar(&openOutput, "output", "", "Base name of the output files (default the input file name with an _open suffix)")
+	openCmd.Flags().StringSliceVar(&openFormats, "format", []string{"csv"}, "Output formats: csv, json, ndjson, geojson (repeatable)")
+	runSearchCmd.AddCommand(openCmd)
+}
 
-	writer := csv.NewWriter(file)
-	defer writer.Flush()
+// parseOpenAt parses the --at flag of the open command in the time zone of now
+func parseOpenAt(text string, now time.Time) (time.Time, error) {
+	text = strings.ToLower(strings.TrimSpace(text))
+	if text == "now" {
+		return now, nil
+	}
+	if at, err := time.ParseInLocation("2006-01-02 15:04", text, now.Location()); err == nil {
+		return at, nil
+	}
 
-	// Write header
-	header := []string{"Name", "Address", "Stars", "Reviews", "Phone", "Hours", "Website", "GoogleURL"}
-	if err := writer.Write(header); err != nil {
-		return fmt.Errorf("failed to write header to CSV: %w", err)
+	// "15:04" today, or "monday 15:04" on the next such day
+	day, clock, found := strings.Cut(text, " ")
+	if !found {
+		day, clock = "", text
+	}
+	var minute scraper.Clock
+	if err := minute.UnmarshalText([]byte(clock)); err != nil {
+		return time.Time{}, fmt.Errorf("invalid --at %q, expected now, 15:04, monday 15:04 or 2006-01-02 15:04", text)
 	}
+	at := time.Date(now.Year(), now.Month(), now.Day(), int(minute)/60, int(minute)%60, 0, 0, now.Location())
+	if day != "" {
+		var weekday scraper.Weekday
+		if err := weekday.UnmarshalText([]byte(day)); err != nil {
+			return time.Time{}, fmt.Errorf("invalid --at %q: %w", text, err)
+		}
+		at = at.AddDate(0, 0, (int(weekday)-int(at.Weekday())+7)%7)
+	}
+	return at, nil
+}
 
-	// Write place data
+// filterOpenPlaces returns the places open at the given time and the number
+// of places whose opening hours are unknown.
+func filterOpenPlaces(places []Place, at time.Time) ([]Place, int) {
+	open := []Place{}
+	unknown := 0
 	for _, place := range places {
-		record := []string{
-			place.Name,
-			place.Address,
-			fmt.Sprintf("%.1f", place.Stars),
-			fmt.Sprintf("%d", place.Reviews),
-			place.Phone,
-			place.Hours,
-			place.Website,
-			place.GoogleURL,
+		// Files written before the schedule was parsed still have the weekly hours
+		if place.Schedule == nil {
+			place.Schedule = scraper.ParseSchedule(place.WeeklyHours)
 		}
-		if err := writer.Write(record); err != nil {
-			return fmt.Errorf("failed to write record to CSV: %w", err)
+		if place.Schedule == nil {
+			unknown++
+			continue
+		}
+		if place.Schedule.OpenAt(at) {
+			open = append(open, place)
 		}
 	}
-
-	return nil
+	return open, unknown
 }
@@ -0,0 +1,58 @@
+// Package mapsurl extracts identifiers and coordinates embedded in Google Maps
+// place URLs.
+//
+// Place links look like
+//
+//	https://www.google.com/maps/place/Name/data=!4m7!3m6!1s0x85cfc5ec051634e9:0x4f65d92bbc9f0dae!8m2!3d19.1019061!4d-98.2810447!16s...
+//
+// where the !1s segment holds the feature ID of the place and !3d/!4d its
+// latitude and longitude.
+package mapsurl
+
+import (
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"mapsscrap/geo"
+)
+
+var featureIDRegex = regexp.MustCompile(`!1s(0x[0-9a-fA-F]+:0x[0-9a-fA-F]+)`)
+
+// FeatureID returns the Google feature ID ("0x...:0x...") of a place URL, or
+// an empty string when the URL does not contain one.
+func FeatureID(placeURL string) string {
+	if unescaped, err := url.PathUnescape(placeURL); err == nil {
+		placeURL = unescaped
+	}
+
+	match := featureIDRegex.FindStringSubmatch(placeURL)
+	if match == nil {
+		return ""
+	}
+	return strings.ToLower(match[1])
+}
+
+var locationRegex = regexp.MustCompile(`!3d(-?\d+(?:\.\d+)?)!4d(-?\d+(?:\.\d+)?)`)
+
+// Location returns the coordinates of the place stored in the !3d (latitude)
+// and !4d (longitude) segments of a place URL. Unlike the @lat,lon part of
+// the path, which is the map viewport, these are the business location.
+func Location(placeURL string) (geo.Point, bool) {
+	if unescaped, err := url.PathUnescape(placeURL); err == nil {
+		placeURL = unescaped
+	}
+
+	match := locationRegex.FindStringSubmatch(placeURL)
+	if match == nil {
+		return geo.Point{}, false
+	}
+
+	lat, errLat := strconv.ParseFloat(match[1], 64)
+	lon, errLon := strconv.ParseFloat(match[2], 64)
+	if errLat != nil || errLon != nil {
+		return geo.Point{}, false
+	}
+	return geo.Point{Lat: lat, Lon: lon}, true
+}
@@ -0,0 +1,40 @@
+package mapsurl
+
+import (
+	"testing"
+
+	"mapsscrap/geo"
+)
+
+const placeURL = "https://www.google.com/maps/place/Bufete/@19.4,-99.1,17z/data=!4m7!3m6!1s0x85d1ff35f5bd1563:0x6c366f0e2de02ff7!8m2!3d19.42847!4d-99.16766!16s%2Fg%2F11c1"
+
+func TestFeatureID(t *testing.T) {
+	tests := []struct {
+		name string
+		url  string
+		want string
+	}{
+		{"place URL", placeURL, "0x85d1ff35f5bd1563:0x6c366f0e2de02ff7"},
+		{"escaped colon", "https://www.google.com/maps/place/Bufete/data=!4m7!3m6!1s0x85d1ff35f5bd1563%3A0x6c366f0e2de02ff7!8m2", "0x85d1ff35f5bd1563:0x6c366f0e2de02ff7"},
+		{"upper case", "https://www.google.com/maps/place/Bufete/data=!1s0x85D1FF35F5BD1563:0x6C366F0E2DE02FF7", "0x85d1ff35f5bd1563:0x6c366f0e2de02ff7"},
+		{"no feature ID", "https://www.google.com/maps/place/Bufete/@19.4,-99.1,17z", ""},
+		{"empty", "", ""},
+	}
+	for _, tt := range tests {
+		if got := FeatureID(tt.url); got != tt.want {
+			t.Errorf("%s: FeatureID() = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestLocation(t *testing.T) {
+	got, ok := Location(placeURL)
+	if want := (geo.Point{Lat: 19.42847, Lon: -99.16766}); !ok || got != want {
+		t.Errorf("Location() = %+v, %v, want %+v", got, ok, want)
+	}
+
+	// The viewport in the path is not the place location
+	if got, ok := Location("https://www.google.com/maps/place/Bufete/@19.4,-99.1,17z"); ok {
+		t.Errorf("Location() = %+v for a URL without !3d/!4d", got)
+	}
+}
@@ -0,0 +1,132 @@
+// Package phone parses phone numbers as written on Google Maps into E.164 and
+// national formats. Numbers are validated against the numbering plan of a
+// region, which also tells mobile numbers from landlines where it allows.
+package phone
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Type is the kind of line a number belongs to
+type Type string
+
+const (
+	Mobile   Type = "mobile"
+	Landline Type = "landline"
+	TollFree Type = "toll_free"
+	Unknown  Type = "unknown" // The numbering plan does not tell mobiles from landlines
+)
+
+// Number is a validated phone number
+type Number struct {
+	E164     string `json:"e164"`     // e.g. +525552081234
+	National string `json:"national"` // As dialed within the region, e.g. 55 5208 1234
+	Region   string `json:"region"`   // Empty for countries without a registered plan
+	Type     Type   `json:"type"`
+}
+
+// Plan validates and formats the numbers of a region's numbering plan
+type Plan interface {
+	// Region is the ISO 3166-1 alpha-2 code of the region, e.g. "MX"
+	Region() string
+	// CountryCode is the calling code of the region, e.g. "52"
+	CountryCode() string
+	// Parse validates the digits of a number. International numbers come
+	// without their country code, national ones as dialed in the region,
+	// with any trunk prefix.
+	Parse(digits string, international bool) (Number, error)
+}
+
+// plans are the registered numbering plans by region code
+var plans = map[string]Plan{}
+
+// Register adds a numbering plan, replacing the plan of the same region
+func Register(plan Plan) {
+	plans[strings.ToUpper(plan.Region())] = plan
+}
+
+// Lookup returns the numbering plan of the region
+func Lookup(region string) (Plan, bool) {
+	plan, ok := plans[strings.ToUpper(region)]
+	return plan, ok
+}
+
+// Regions returns the codes of the regions with a registered plan, sorted
+func Regions() []string {
+	regions := make([]string, 0, len(plans))
+	for region := range plans {
+		regions = append(regions, region)
+	}
+	sort.Strings(regions)
+	return regions
+}
+
+// Parse validates a phone number written in any usual way, e.g.
+// "+52 55 5208 1234", "(55) 5208-1234" or "0052 5552081234". Numbers without
+// a country code are read with the plan of the region. Numbers with a country
+// code without registered plan are only checked for their length.
+func Parse(text, region string) (Number, error) {
+	digits, international, err := clean(text)
+	if err != nil {
+		return Number{}, err
+	}
+
+	if international {
+		var match Plan
+		for _, plan := range plans {
+			code := plan.CountryCode()
+			if strings.HasPrefix(digits, code) && (match == nil || len(code) > len(match.CountryCode())) {
+				match = plan
+			}
+		}
+		if match != nil {
+			return match.Parse(digits[len(match.CountryCode()):], true)
+		}
+		if len(digits) < 8 || len(digits) > 15 {
+			return Number{}, fmt.Errorf("%q is not a valid international number", text)
+		}
+		return Number{E164: "+" + digits, National: "+" + digits, Type: Unknown}, nil
+	}
+
+	plan, ok := Lookup(region)
+	if !ok {
+		return Number{}, fmt.Errorf("no numbering plan for region %q", region)
+	}
+	return plan.Parse(digits, false)
+}
+
+// clean returns the digits of a number and whether it starts with an
+// international prefix. Text other than digits, spaces and the usual
+// separators, such as prices or words, is rejected.
+func clean(text string) (string, bool, error) {
+	text = strings.TrimSpace(text)
+	international := strings.HasPrefix(text, "+")
+
+	var digits strings.Builder
+	for i, r := range text {
+		switch {
+		case r >= '0' && r <= '9':
+			digits.WriteRune(r)
+		case r == '+' && i == 0:
+		case strings.ContainsRune(" -‐‑–()./\u00a0\u202f", r):
+		default:
+			return "", false, fmt.Errorf("%q is not a phone number", text)
+		}
+	}
+
+	number := digits.String()
+	if !international && strings.HasPrefix(number, "00") {
+		number, international = number[2:], true
+	}
+	if number == "" {
+		return "", false, fmt.Errorf("%q is not a phone number", text)
+	}
+	return number, international, nil
+}
+
+// invalid returns the error of digits not valid in the region's plan
+func invalid(plan Plan, digits string) error {
+	return fmt.Errorf("%s is not a valid %s number", digits, plan.Region())
+}
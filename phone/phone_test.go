@@ -0,0 +1,91 @@
+package phone
+
+import "testing"
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		text   string
+		region string
+		want   Number
+	}{
+		{"+525552081234", "MX", Number{"+525552081234", "55 5208 1234", "MX", Unknown}},
+		{"(222) 123-4567", "MX", Number{"+522221234567", "222 123 4567", "MX", Unknown}},
+		{"044 55 5208 1234", "MX", Number{"+525552081234", "55 5208 1234", "MX", Mobile}},
+		{"+52 1 33 1234 5678", "US", Number{"+523312345678", "33 1234 5678", "MX", Mobile}},
+		{"800 123 4567", "MX", Number{"+528001234567", "800 123 4567", "MX", TollFree}},
+		{"+1 415-555-0100", "MX", Number{"+14155550100", "(415) 555-0100", "US", Unknown}},
+		{"1 (800) 555 0199", "US", Number{"+18005550199", "(800) 555-0199", "US", TollFree}},
+		{"300 1234567", "CO", Number{"+573001234567", "300 1234567", "CO", Mobile}},
+		{"+57 601 2345678", "MX", Number{"+576012345678", "601 2345678", "CO", Landline}},
+		{"01 8000 123456", "CO", Number{"+5718000123456", "01 8000 123456", "CO", TollFree}},
+		{"612 34 56 78", "ES", Number{"+34612345678", "612 34 56 78", "ES", Mobile}},
+		{"0034 912 345 678", "MX", Number{"+34912345678", "912 34 56 78", "ES", Landline}},
+		{"900 123 456", "ES", Number{"+34900123456", "900 123 456", "ES", TollFree}},
+		{"011 15-2345-6789", "AR", Number{"+5491123456789", "011 15-2345-6789", "AR", Mobile}},
+		{"+54 9 351 123-4567", "MX", Number{"+5493511234567", "0351 15-123-4567", "AR", Mobile}},
+		{"0351 423-4567", "AR", Number{"+543514234567", "0351 423-4567", "AR", Landline}},
+		{"+49 30 1234567", "MX", Number{"+49301234567", "+49301234567", "", Unknown}},
+	}
+	for _, tt := range tests {
+		got, err := Parse(tt.text, tt.region)
+		if err != nil {
+			t.Errorf("Parse(%q, %s) failed: %v", tt.text, tt.region, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Parse(%q, %s) = %+v, want %+v", tt.text, tt.region, got, tt.want)
+		}
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	tests := []struct {
+		text   string
+		region string
+	}{
+		{"06600", "MX"},         // Postal code
+		{"$1,250.00", "MX"},     // Price
+		{"123 456 7890", "MX"},  // Numbers do not start with 1
+		{"55 5208 123", "MX"},   // Too short
+		{"555 0100", "US"},      // Without area code
+		{"+57 1 2345678", "CO"}, // Landline in the format replaced in 2021
+		{"512 34 56 78", "ES"},
+		{"55 5208 1234", "XX"}, // Unknown region
+	}
+	for _, tt := range tests {
+		if got, err := Parse(tt.text, tt.region); err == nil {
+			t.Errorf("Parse(%q, %s) = %+v, want an error", tt.text, tt.region, got)
+		}
+	}
+}
+
+func TestParseWhatsAppURL(t *testing.T) {
+	tests := []struct {
+		link string
+		want string
+	}{
+		{"https://wa.me/5215552081234?text=Hola", "+525552081234"},
+		{"https://api.whatsapp.com/send?phone=573001234567&text=Hola", "+573001234567"},
+		{"whatsapp://send?phone=%2B34612345678", "+34612345678"},
+		{"https://web.whatsapp.com/send?phone=14155550100", "+14155550100"},
+	}
+	for _, tt := range tests {
+		number, err := ParseWhatsAppURL(tt.link)
+		if err != nil {
+			t.Errorf("ParseWhatsAppURL(%q) failed: %v", tt.link, err)
+			continue
+		}
+		if number.E164 != tt.want {
+			t.Errorf("ParseWhatsAppURL(%q) = %s, want %s", tt.link, number.E164, tt.want)
+		}
+		if url := WhatsAppURL(number); url != "https://wa.me/"+tt.want[1:] {
+			t.Errorf("WhatsAppURL(%s) = %s", number.E164, url)
+		}
+	}
+
+	for _, link := range []string{"https://wa.me/", "https://wa.me/message/ABCDEF", "https://example.com/5215552081234", "https://api.whatsapp.com/send?phone=123"} {
+		if number, err := ParseWhatsAppURL(link); err == nil {
+			t.Errorf("ParseWhatsAppURL(%q) = %+v, want an error", link, number)
+		}
+	}
+}
@@ -0,0 +1,196 @@
+package phone
+
+import (
+	"regexp"
+	"strings"
+)
+
+func init() {
+	Register(mexico{})
+	Register(unitedStates{})
+	Register(colombia{})
+	Register(spain{})
+	Register(argentina{})
+}
+
+// number builds the Number of a national significant number of the plan
+func number(plan Plan, nsn, national string, kind Type) Number {
+	return Number{E164: "+" + plan.CountryCode() + nsn, National: national, Region: plan.Region(), Type: kind}
+}
+
+var mexicanNumber = regexp.MustCompile(`^[2-9]\d{9}$`)
+
+// mexico is the plan of Mexico: ten digit numbers since 2019, mobiles and
+// landlines share the same ranges
+type mexico struct{}
+
+func (mexico) Region() string      { return "MX" }
+func (mexico) CountryCode() string { return "52" }
+
+func (p mexico) Parse(digits string, international bool) (Number, error) {
+	kind := Unknown
+	switch {
+	// Mobiles used to be dialed from abroad with a 1 after the country code
+	case international && len(digits) == 11 && digits[0] == '1':
+		digits, kind = digits[1:], Mobile
+	// and nationally with 044 or 045, long distance calls with 01
+	case !international && len(digits) == 13 && (strings.HasPrefix(digits, "044") || strings.HasPrefix(digits, "045")):
+		digits, kind = digits[3:], Mobile
+	case !international && len(digits) == 12 && strings.HasPrefix(digits, "01"):
+		digits = digits[2:]
+	}
+	if !mexicanNumber.MatchString(digits) {
+		return Number{}, invalid(p, digits)
+	}
+	if strings.HasPrefix(digits, "800") {
+		kind = TollFree
+	}
+
+	// Mexico City, Guadalajara and Monterrey have two digit area codes
+	national := digits[:3] + " " + digits[3:6] + " " + digits[6:]
+	switch digits[:2] {
+	case "55", "56", "33", "81":
+		national = digits[:2] + " " + digits[2:6] + " " + digits[6:]
+	}
+	return number(p, digits, national, kind), nil
+}
+
+var (
+	nanpNumber   = regexp.MustCompile(`^[2-9]\d{2}[2-9]\d{6}$`)
+	nanpTollFree = regexp.MustCompile(`^8(00|33|44|55|66|77|88)`)
+)
+
+// unitedStates is the North American Numbering Plan, where mobiles and
+// landlines share the same area codes
+type unitedStates struct{}
+
+func (unitedStates) Region() string      { return "US" }
+func (unitedStates) CountryCode() string { return "1" }
+
+func (p unitedStates) Parse(digits string, international bool) (Number, error) {
+	if !international && len(digits) == 11 && digits[0] == '1' {
+		digits = digits[1:]
+	}
+	if !nanpNumber.MatchString(digits) {
+		return Number{}, invalid(p, digits)
+	}
+	kind := Unknown
+	if nanpTollFree.MatchString(digits) {
+		kind = TollFree
+	}
+	return number(p, digits, "("+digits[:3]+") "+digits[3:6]+"-"+digits[6:], kind), nil
+}
+
+var (
+	colombianMobile   = regexp.MustCompile(`^3\d{9}$`)
+	colombianLandline = regexp.MustCompile(`^60[1-8]\d{7}$`)
+	colombianTollFree = regexp.MustCompile(`^18000\d{6}$`)
+)
+
+// colombia is the plan of Colombia: ten digit mobiles starting with 3 and,
+// since 2021, ten digit landlines starting with 60 and the area code
+type colombia struct{}
+
+func (colombia) Region() string      { return "CO" }
+func (colombia) CountryCode() string { return "57" }
+
+func (p colombia) Parse(digits string, international bool) (Number, error) {
+	// Toll free numbers are dialed as 01 8000
+	if !international && strings.HasPrefix(digits, "018000") {
+		digits = digits[1:]
+	}
+	switch {
+	case colombianMobile.MatchString(digits):
+		return number(p, digits, digits[:3]+" "+digits[3:], Mobile), nil
+	case colombianLandline.MatchString(digits):
+		return number(p, digits, digits[:3]+" "+digits[3:], Landline), nil
+	case colombianTollFree.MatchString(digits):
+		return number(p, digits, "01 8000 "+digits[5:], TollFree), nil
+	}
+	return Number{}, invalid(p, digits)
+}
+
+var (
+	spanishMobile   = regexp.MustCompile(`^(6\d|7[1-9])\d{7}$`)
+	spanishTollFree = regexp.MustCompile(`^[89]00\d{6}$`)
+	spanishLandline = regexp.MustCompile(`^[89]\d{8}$`)
+)
+
+// spain is the plan of Spain: nine digit numbers, mobiles starting with 6 or
+// 7 and landlines with 8 or 9
+type spain struct{}
+
+func (spain) Region() string      { return "ES" }
+func (spain) CountryCode() string { return "34" }
+
+func (p spain) Parse(digits string, international bool) (Number, error) {
+	switch {
+	case spanishMobile.MatchString(digits):
+		return number(p, digits, digits[:3]+" "+digits[3:5]+" "+digits[5:7]+" "+digits[7:], Mobile), nil
+	case spanishTollFree.MatchString(digits):
+		return number(p, digits, digits[:3]+" "+digits[3:6]+" "+digits[6:], TollFree), nil
+	case spanishLandline.MatchString(digits):
+		return number(p, digits, digits[:3]+" "+digits[3:5]+" "+digits[5:7]+" "+digits[7:], Landline), nil
+	}
+	return Number{}, invalid(p, digits)
+}
+
+var (
+	argentineNumber   = regexp.MustCompile(`^[1-3]\d{9}$`)
+	argentineTollFree = regexp.MustCompile(`^800\d{7}$`)
+)
+
+// argentina is the plan of Argentina: ten digits made of an area code of two
+// to four digits and the subscriber number. Mobiles are dialed with a 9 after
+// the country code from abroad, and with 15 after the area code nationally.
+type argentina struct{}
+
+func (argentina) Region() string      { return "AR" }
+func (argentina) CountryCode() string { return "54" }
+
+func (p argentina) Parse(digits string, international bool) (Number, error) {
+	kind := Landline
+	if international {
+		if len(digits) == 11 && digits[0] == '9' {
+			digits, kind = digits[1:], Mobile
+		}
+	} else {
+		digits = strings.TrimPrefix(digits, "0")
+		if len(digits) == 12 {
+			for _, area := range []int{argentineAreaLength(digits), 4} {
+				if digits[area:area+2] == "15" {
+					digits, kind = digits[:area]+digits[area+2:], Mobile
+					break
+				}
+			}
+		}
+	}
+
+	if argentineTollFree.MatchString(digits) {
+		return number(p, digits, "0800 "+digits[3:6]+" "+digits[6:], TollFree), nil
+	}
+	if !argentineNumber.MatchString(digits) {
+		return Number{}, invalid(p, digits)
+	}
+
+	area := argentineAreaLength(digits)
+	subscriber := digits[area:]
+	subscriber = subscriber[:len(subscriber)-4] + "-" + subscriber[len(subscriber)-4:]
+	national := "0" + digits[:area] + " " + subscriber
+	if kind == Mobile {
+		national = "0" + digits[:area] + " 15-" + subscriber
+		digits = "9" + digits
+	}
+	return number(p, digits, national, kind), nil
+}
+
+// argentineAreaLength returns the length of the area code of a number. Buenos
+// Aires has the only two digit code; four digit codes of smaller towns cannot
+// be told from three digit ones without the list of codes, and are grouped as
+// three digits.
+func argentineAreaLength(digits string) int {
+	if strings.HasPrefix(digits, "11") {
+		return 2
+	}
+	return 3
+}
@@ -0,0 +1,37 @@
+package phone
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// WhatsAppURL returns the wa.me link that opens a WhatsApp chat with the number
+func WhatsAppURL(number Number) string {
+	return "https://wa.me/" + strings.TrimPrefix(number.E164, "+")
+}
+
+// ParseWhatsAppURL reads the number of a WhatsApp chat link, such as
+// https://wa.me/5215552081234, https://api.whatsapp.com/send?phone=5215552081234
+// or whatsapp://send?phone=5215552081234. These links always carry the
+// country code.
+func ParseWhatsAppURL(link string) (Number, error) {
+	target, err := url.Parse(strings.TrimSpace(link))
+	if err != nil {
+		return Number{}, fmt.Errorf("invalid WhatsApp link %q: %w", link, err)
+	}
+
+	var digits string
+	switch host := strings.TrimPrefix(strings.ToLower(target.Host), "www."); {
+	case host == "wa.me":
+		digits = strings.Trim(target.Path, "/")
+	case target.Scheme == "whatsapp", host == "api.whatsapp.com", host == "web.whatsapp.com":
+		digits = target.Query().Get("phone")
+	default:
+		return Number{}, fmt.Errorf("%q is not a WhatsApp link", link)
+	}
+	if digits == "" {
+		return Number{}, fmt.Errorf("WhatsApp link %q has no number", link)
+	}
+	return Parse("+"+strings.TrimPrefix(digits, "+"), "")
+}
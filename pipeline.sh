@@ -1,7 +1,12 @@
 #!/bin/bash
 
 # Pipeline para ejecutar mapsscrap y luego extraer teléfonos
-# Uso: ./pipeline.sh <lat> <lon> <query> <radius>
+# Uso: ./pipeline.sh [--progress=json] <lat> <lon> <query> <radius> [area.geojson]
+# Los CSV se escriben en el directorio actual. Los binarios se buscan junto a
+# este script. Con --progress=json ambos binarios escriben sus eventos de
+# progreso en el descriptor 3, heredado del proceso que ejecuta el script.
+# El servidor web no usa este script: ejecuta las mismas etapas con el paquete
+# pipeline.
 
 set -e  # Salir si cualquier comando falla
 
@@ -29,9 +34,16 @@ warning() {
     echo -e "${YELLOW}[WARNING] $1${NC}"
 }
 
+# Modo de progreso de los binarios
+PROGRESS="--progress=bar"
+if [[ "${1:-}" == --progress=* ]]; then
+    PROGRESS=$1
+    shift
+fi
+
 # Validar argumentos
-if [ $# -ne 4 ]; then
-    error "Uso: $0 <latitud> <longitud> <consulta> <radio_km>"
+if [ $# -ne 4 ] && [ $# -ne 5 ]; then
+    error "Uso: $0 [--progress=json] <latitud> <longitud> <consulta> <radio_km> [area.geojson]"
     error "Ejemplo: $0 19.1019061 -98.2810447 \"spa\" 2.0"
     exit 1
 fi
@@ -40,11 +52,16 @@ LAT=$1
 LON=$2
 QUERY=$3
 RADIUS=$4
+AREA=${5:-}
+BIN_DIR=$(cd "$(dirname "$0")" && pwd)
 
 log "🚀 Iniciando pipeline de scraping de Google Maps"
 log "📍 Coordenadas: $LAT, $LON"
 log "🔍 Consulta: $QUERY"
 log "📏 Radio: ${RADIUS}km"
+if [ -n "$AREA" ]; then
+    log "🗺️  Área: $AREA"
+fi
 
 # Verificar Google Chrome
 # NOTE: Google Chrome debe estar instalado durante el proceso de build/deploy.
@@ -59,34 +76,28 @@ elif [ -x "/usr/bin/google-chrome" ]; then
 fi
 
 if [ -z "$CHROME_BIN" ]; then
-    log "Google Chrome no encontrado, intentando instalar..."
-    wget https://dl.google.com/linux/direct/google-chrome-stable_current_x86_64.rpm -O /tmp/google-chrome.rpm
-    sudo yum update -y && sudo yum localinstall -y /tmp/google-chrome.rpm
-    if command -v google-chrome >/dev/null 2>&1; then
-       CHROME_BIN=$(command -v google-chrome)
-       success "✅ Google Chrome instalado en: $CHROME_BIN"
-       log "🔎 Usando navegador: $CHROME_BIN"
-    else
-       error "Error al instalar Google Chrome"
-       exit 1
-    fi
+    warning "Google Chrome no encontrado, los binarios descargarán Chromium"
 else
     success "✅ Google Chrome disponible en: $CHROME_BIN"
     log "🔎 Usando navegador: $CHROME_BIN"
 fi
 
 # Verificar que mapsscrap-1 existe
-if [ ! -f "./mapsscrap-1" ]; then
+if [ ! -f "$BIN_DIR/mapsscrap-1" ]; then
     error "El ejecutable mapsscrap-1 no existe. Ejecuta 'make build-all' primero."
     exit 1
 fi
 
 # Verificar permisos de ejecución para mapsscrap-1
-chmod +x ./mapsscrap-1
+chmod +x "$BIN_DIR/mapsscrap-1"
 
 # Paso 1: Ejecutar mapsscrap-1 para obtener lugares
 log "📊 Paso 1: Ejecutando mapsscrap-1 para obtener lugares..."
-./mapsscrap-1 --lat "$LAT" --lon "$LON" --query "$QUERY" --radius "$RADIUS"
+if [ -n "$AREA" ]; then
+    "$BIN_DIR/mapsscrap-1" "$PROGRESS" --query "$QUERY" --area "$AREA"
+else
+    "$BIN_DIR/mapsscrap-1" "$PROGRESS" --lat "$LAT" --lon "$LON" --query "$QUERY" --radius "$RADIUS"
+fi
 
 if [ $? -ne 0 ]; then
     error "Error ejecutando mapsscrap-1"
@@ -137,7 +148,7 @@ fi
 
 # Paso 2: Ejecutar phone_scraper para extraer teléfonos
 log "📞 Paso 2: Extrayendo números de teléfono de los lugares encontrados..."
-./phone_scraper csv --file "$LATEST_CSV"
+"$BIN_DIR/phone_scraper" csv "$PROGRESS" --file "$LATEST_CSV"
 
 if [ $? -ne 0 ]; then
     error "Error ejecutando phone_scraper"
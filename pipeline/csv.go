@@ -0,0 +1,367 @@
+package pipeline
+
+import (
+	"encoding/csv"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"strings"
+
+	"mapsscrap/mapsurl"
+	"mapsscrap/phone"
+	"mapsscrap/scraper"
+	"mapsscrap/website"
+)
+
+// placeColumns is the header of the CSV written by the search stage
+var placeColumns = []string{"Name", "Address", "Stars", "Reviews", "Phone", "Hours", "Website", "GoogleURL", "PlaceID", "Latitude", "Longitude", "DistanceKm",
+	"Category", "PriceLevel", "PlusCode", "Status", "Claimed", "WeeklyHours", "PhoneE164", "PhoneType"}
+
+// extraColumns are the columns the search stage writes after DistanceKm
+var extraColumns = []string{"Category", "PriceLevel", "PlusCode", "Status", "Claimed", "WeeklyHours", "PhoneE164", "PhoneType"}
+
+// webColumns are the columns of the website contacts, with the values
+// separated by "; "
+var webColumns = []string{"Emails", "WebPhones", "WhatsAppLinks", "Facebook", "Instagram", "LinkedIn", "TikTok"}
+
+// webValues returns the contacts in the order of webColumns
+func webValues(contacts *website.Contacts) []*[]string {
+	return []*[]string{&contacts.Emails, &contacts.Phones, &contacts.WhatsApp, &contacts.Facebook, &contacts.Instagram, &contacts.LinkedIn, &contacts.TikTok}
+}
+
+// WritePlacesCSV writes the places found by a search to a CSV file
+func WritePlacesCSV(places []scraper.Place, filename string) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return fmt.Errorf("failed to create CSV file: %w", err)
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	defer writer.Flush()
+
+	if err := writer.Write(placeColumns); err != nil {
+		return fmt.Errorf("failed to write header to CSV: %w", err)
+	}
+	for _, place := range places {
+		if err := writer.Write(placeRecord(place)); err != nil {
+			return fmt.Errorf("failed to write record to CSV: %w", err)
+		}
+	}
+	return nil
+}
+
+// placeRecord returns the CSV record of a place in the order of placeColumns
+func placeRecord(place scraper.Place) []string {
+	lat, lon, distance := "", "", ""
+	if place.HasLocation() {
+		lat = fmt.Sprintf("%.7f", place.Coordinates.Lat)
+		lon = fmt.Sprintf("%.7f", place.Coordinates.Lon)
+		distance = fmt.Sprintf("%.2f", place.DistanceKm)
+	}
+	return []string{
+		place.Name,
+		place.Address,
+		fmt.Sprintf("%.1f", place.Stars),
+		fmt.Sprintf("%d", place.Reviews),
+		place.Phone,
+		place.Hours,
+		place.Website,
+		place.GoogleURL,
+		place.PlaceID,
+		lat,
+		lon,
+		distance,
+		place.Category,
+		place.PriceLevel,
+		place.PlusCode,
+		place.Status,
+		formatClaimed(place.Claimed),
+		formatWeeklyHours(place.WeeklyHours),
+		place.PhoneE164,
+		string(place.PhoneType),
+	}
+}
+
+// formatClaimed writes the claimed flag as yes or no, empty when unknown
+func formatClaimed(claimed *bool) string {
+	switch {
+	case claimed == nil:
+		return ""
+	case *claimed:
+		return "yes"
+	}
+	return "no"
+}
+
+// formatWeeklyHours joins the opening hours of every day in a single cell,
+// e.g. "lunes: 9 a.m.–6 p.m.; martes: 9 a.m.–6 p.m."
+func formatWeeklyHours(days []scraper.DayHours) string {
+	parts := make([]string, len(days))
+	for i, day := range days {
+		parts[i] = day.Day + ": " + day.Hours
+	}
+	return strings.Join(parts, "; ")
+}
+
+// PlaceWithPhone is a row of a results CSV: a place as the search stage wrote
+// it plus the columns the phone and website stages add
+type PlaceWithPhone struct {
+	Name                   string
+	Address                string
+	Stars                  string
+	Reviews                string
+	Phone                  string
+	Hours                  string
+	Website                string
+	GoogleURL              string
+	ScrapedPhone           string // Phone read from the place page, in national format
+	ScrapedPhoneE164       string // The scraped phone in E.164
+	ScrapedPhoneType       string // mobile, landline, toll_free or unknown
+	ScrapedPhoneSource     string // Rule of the selector profile that found the phone
+	ScrapedPhoneConfidence string // Confidence between 0 and 1
+	ScrapedPhoneRaw        string // Page text the phone was read from
+	PlaceID                string // Google feature ID parsed from GoogleURL
+	Latitude               string // Location of the business
+	Longitude              string
+	DistanceKm             string           // Distance from the search center
+	Extra                  []string         // Values of extraColumns
+	Web                    website.Contacts // Contacts read from the website by enrich-web
+	MapsWhatsApp           string           // WhatsApp link of the Google Maps panel
+	WhatsApp               string           // Reach by WhatsApp, see UpdateWhatsApp
+	WhatsAppURL            string           // wa.me link opening the chat
+}
+
+// Reach by WhatsApp of a place, from most to least certain
+const (
+	WhatsAppLink     = "link"     // The number is in a WhatsApp link of the panel or the website
+	WhatsAppMobile   = "mobile"   // Mobile according to the numbering plan
+	WhatsAppPossible = "possible" // The plan cannot tell mobiles from landlines, as in Mexico
+)
+
+// NewPlaceWithPhone returns the row of a place found by the search stage,
+// the same that reading its CSV gives
+func NewPlaceWithPhone(place scraper.Place) PlaceWithPhone {
+	return parseRecord(newColumnIndex(placeColumns), placeRecord(place))
+}
+
+// columnIndex maps the names of the header of a CSV to their positions
+type columnIndex map[string]int
+
+func newColumnIndex(header []string) columnIndex {
+	columns := make(columnIndex, len(header))
+	for i, name := range header {
+		columns[name] = i
+	}
+	return columns
+}
+
+// get returns the value of the named column, empty when the CSV lacks it
+func (columns columnIndex) get(record []string, name string) string {
+	if i, ok := columns[name]; ok && i < len(record) {
+		return record[i]
+	}
+	return ""
+}
+
+// parseRecord reads a row of a results CSV with the given columns. The first
+// eight columns are fixed; the rest are looked up by name.
+func parseRecord(columns columnIndex, record []string) PlaceWithPhone {
+	place := PlaceWithPhone{
+		Name:       record[0],
+		Address:    record[1],
+		Stars:      record[2],
+		Reviews:    record[3],
+		Phone:      record[4],
+		Hours:      record[5],
+		Website:    record[6],
+		GoogleURL:  record[7],
+		PlaceID:    columns.get(record, "PlaceID"),
+		Latitude:   columns.get(record, "Latitude"),
+		Longitude:  columns.get(record, "Longitude"),
+		DistanceKm: columns.get(record, "DistanceKm"),
+	}
+	for _, name := range extraColumns {
+		place.Extra = append(place.Extra, columns.get(record, name))
+	}
+	// Results of earlier runs of the phone and website stages
+	place.ScrapedPhone = columns.get(record, "ScrapedPhone")
+	place.ScrapedPhoneE164 = columns.get(record, "ScrapedPhoneE164")
+	place.ScrapedPhoneType = columns.get(record, "ScrapedPhoneType")
+	place.ScrapedPhoneSource = columns.get(record, "ScrapedPhoneSource")
+	place.ScrapedPhoneConfidence = columns.get(record, "ScrapedPhoneConfidence")
+	place.ScrapedPhoneRaw = columns.get(record, "ScrapedPhoneRaw")
+	for i, values := range webValues(&place.Web) {
+		if value := columns.get(record, webColumns[i]); value != "" {
+			*values = strings.Split(value, "; ")
+		}
+	}
+	place.MapsWhatsApp = columns.get(record, "MapsWhatsAppLink")
+	place.WhatsApp = columns.get(record, "WhatsApp")
+	place.WhatsAppURL = columns.get(record, "WhatsAppURL")
+	// Old CSVs have no PlaceID column, it is parsed from the URL
+	if place.PlaceID == "" {
+		place.PlaceID = mapsurl.FeatureID(place.GoogleURL)
+	}
+	if place.Latitude == "" {
+		if location, ok := mapsurl.Location(place.GoogleURL); ok {
+			place.Latitude = fmt.Sprintf("%.7f", location.Lat)
+			place.Longitude = fmt.Sprintf("%.7f", location.Lon)
+		}
+	}
+	return place
+}
+
+// ReadPlacesWithPhones reads the rows of a results CSV, written by any stage
+func ReadPlacesWithPhones(csvPath string) ([]PlaceWithPhone, error) {
+	file, err := os.Open(csvPath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	records, err := csv.NewReader(file).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) < 2 {
+		return nil, fmt.Errorf("CSV must have at least header and one data row")
+	}
+
+	columns := newColumnIndex(records[0])
+	var places []PlaceWithPhone
+	for i, record := range records[1:] {
+		if len(record) < 8 {
+			log.Printf("Warning: Row %d has insufficient columns, skipping", i+2)
+			continue
+		}
+		places = append(places, parseRecord(columns, record))
+	}
+	return places, nil
+}
+
+// WritePlacesWithPhones writes the rows to a CSV file with the columns of
+// every stage
+func WritePlacesWithPhones(places []PlaceWithPhone, filename string) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	defer writer.Flush()
+
+	header := []string{"Name", "Address", "Stars", "Reviews", "Phone", "Hours", "Website", "GoogleURL", "ScrapedPhone", "PlaceID", "Latitude", "Longitude", "DistanceKm"}
+	header = append(header, extraColumns...)
+	header = append(header, "ScrapedPhoneE164", "ScrapedPhoneType", "ScrapedPhoneSource", "ScrapedPhoneConfidence", "ScrapedPhoneRaw")
+	header = append(header, webColumns...)
+	header = append(header, "MapsWhatsAppLink", "WhatsApp", "WhatsAppURL")
+	if err := writer.Write(header); err != nil {
+		return err
+	}
+
+	for _, place := range places {
+		record := []string{
+			place.Name,
+			place.Address,
+			place.Stars,
+			place.Reviews,
+			place.Phone,
+			place.Hours,
+			place.Website,
+			place.GoogleURL,
+			place.ScrapedPhone,
+			place.PlaceID,
+			place.Latitude,
+			place.Longitude,
+			place.DistanceKm,
+		}
+		record = append(record, place.Extra...)
+		record = append(record, place.ScrapedPhoneE164, place.ScrapedPhoneType, place.ScrapedPhoneSource, place.ScrapedPhoneConfidence, place.ScrapedPhoneRaw)
+		for _, values := range webValues(&place.Web) {
+			record = append(record, strings.Join(*values, "; "))
+		}
+		record = append(record, place.MapsWhatsApp, place.WhatsApp, place.WhatsAppURL)
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// extra returns the value of one of the extraColumns
+func (p *PlaceWithPhone) extra(name string) string {
+	for i, column := range extraColumns {
+		if column == name && i < len(p.Extra) {
+			return p.Extra[i]
+		}
+	}
+	return ""
+}
+
+// SetPanelPhone stores what the phone stage read from the place page
+func (p *PlaceWithPhone) SetPanelPhone(panel PanelPhone) {
+	p.MapsWhatsApp = panel.WhatsApp
+	if panel.E164 == "" {
+		return
+	}
+	p.ScrapedPhone = panel.National
+	p.ScrapedPhoneE164 = panel.E164
+	p.ScrapedPhoneType = string(panel.Type)
+	p.ScrapedPhoneSource = panel.Source
+	p.ScrapedPhoneConfidence = fmt.Sprintf("%.2f", panel.Confidence)
+	p.ScrapedPhoneRaw = panel.Raw
+}
+
+// AddContacts adds the contacts read from the website of the place to the
+// ones already known
+func (p *PlaceWithPhone) AddContacts(contacts website.Contacts) {
+	existing := webValues(&p.Web)
+	for i, values := range webValues(&contacts) {
+		for _, value := range *values {
+			if !slices.Contains(*existing[i], value) {
+				*existing[i] = append(*existing[i], value)
+			}
+		}
+	}
+}
+
+// UpdateWhatsApp decides whether the place can be reached by WhatsApp and on
+// which number. A WhatsApp link of the panel or the website is the most
+// certain, even when its number is not the phone of the place. Without a link
+// the scraped phone is used or, failing that, the original one, unless it is
+// a landline or toll free.
+func (p *PlaceWithPhone) UpdateWhatsApp(region string) {
+	p.WhatsApp, p.WhatsAppURL = "", ""
+
+	var number phone.Number
+	if p.ScrapedPhoneE164 != "" {
+		number = phone.Number{E164: p.ScrapedPhoneE164, Type: phone.Type(p.ScrapedPhoneType)}
+	} else if p.extra("PhoneE164") != "" {
+		number = phone.Number{E164: p.extra("PhoneE164"), Type: phone.Type(p.extra("PhoneType"))}
+	} else if parsed, err := phone.Parse(p.Phone, region); err == nil {
+		number = parsed // CSVs written before the PhoneE164 column
+	}
+
+	var linked []phone.Number
+	for _, link := range append([]string{p.MapsWhatsApp}, p.Web.WhatsApp...) {
+		if chat, err := phone.ParseWhatsAppURL(link); err == nil {
+			if chat.E164 == number.E164 {
+				p.WhatsApp, p.WhatsAppURL = WhatsAppLink, phone.WhatsAppURL(chat)
+				return
+			}
+			linked = append(linked, chat)
+		}
+	}
+	switch {
+	case len(linked) > 0:
+		p.WhatsApp, p.WhatsAppURL = WhatsAppLink, phone.WhatsAppURL(linked[0])
+	case number.E164 == "":
+	case number.Type == phone.Mobile:
+		p.WhatsApp, p.WhatsAppURL = WhatsAppMobile, phone.WhatsAppURL(number)
+	case number.Type == phone.Unknown:
+		p.WhatsApp, p.WhatsAppURL = WhatsAppPossible, phone.WhatsAppURL(number)
+	}
+}
@@ -0,0 +1,119 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"mapsscrap/browserpool"
+	"mapsscrap/progress"
+	"mapsscrap/scraper"
+)
+
+// DetailsTimeout is the timeout for the page of a place by default
+const DetailsTimeout = 45 * time.Second
+
+// Details is the stage that opens the Google Maps page of every place to read
+// its category, price level, plus code, status, unclaimed flag and weekly
+// hours
+type Details struct {
+	Pool       *browserpool.Pool
+	Selectors  *scraper.Profile // The built-in profile when nil
+	Region     string           // Region whose numbering plan validates a phone taken from the page
+	SkipClosed bool             // Drop temporarily and permanently closed places
+	Workers    int              // SearchWorkers when 0
+	Timeout    time.Duration    // DetailsTimeout when 0
+
+	// Progress receives the start, point_done and error events of the stage,
+	// one at a time. It may be nil.
+	Progress func(progress.Event)
+}
+
+// Run reads the details of the places, Workers places at a time. Places
+// whose page fails to load are kept as they are, and so are the places left
+// once ctx is done. With SkipClosed the closed places are dropped; their
+// number is returned along with the places kept.
+func (s *Details) Run(ctx context.Context, places []scraper.Place) ([]scraper.Place, int) {
+	workers := s.Workers
+	if workers <= 0 {
+		workers = SearchWorkers
+	}
+	s.emit(progress.Event{Type: progress.Start, Stage: progress.StageDetails, Total: len(places), Places: len(places)})
+
+	enriched := make([]scraper.Place, len(places))
+	copy(enriched, places)
+	indexes := make(chan int)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	done := 0
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for index := range indexes {
+				place, err := s.fetch(ctx, places[index])
+				mu.Lock()
+				if err != nil {
+					s.emit(progress.Event{Type: progress.Error, Stage: progress.StageDetails,
+						Place: places[index].Name, Message: err.Error()})
+				} else {
+					enriched[index] = place
+				}
+				done++
+				s.emit(progress.Event{Type: progress.PointDone, Stage: progress.StageDetails,
+					Done: done, Total: len(places), Places: len(places)})
+				mu.Unlock()
+			}
+		}()
+	}
+	for i := range places {
+		if ctx.Err() != nil {
+			break
+		}
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+
+	if !s.SkipClosed {
+		return enriched, 0
+	}
+	open := enriched[:0]
+	for _, place := range enriched {
+		if !place.Closed() {
+			open = append(open, place)
+		}
+	}
+	return open, len(enriched) - len(open)
+}
+
+// fetch borrows a page from the pool to read the details of the place
+func (s *Details) fetch(ctx context.Context, place scraper.Place) (scraper.Place, error) {
+	if place.GoogleURL == "" {
+		return place, nil
+	}
+	timeout := s.Timeout
+	if timeout <= 0 {
+		timeout = DetailsTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	pooledPage, err := s.Pool.Acquire(ctx)
+	if err != nil {
+		return place, fmt.Errorf("failed to get browser page: %w", err)
+	}
+	defer s.Pool.Release(pooledPage)
+
+	selectors := s.Selectors
+	if selectors == nil {
+		selectors = scraper.DefaultProfile()
+	}
+	return scraper.FetchDetails(pooledPage.Context(ctx), place, selectors, s.Region)
+}
+
+// emit sends an event to the Progress callback, if any
+func (s *Details) emit(event progress.Event) {
+	emit(s.Progress, event)
+}
@@ -0,0 +1,305 @@
+package pipeline
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"mapsscrap/mapsurl"
+	"mapsscrap/phone"
+	"mapsscrap/scraper"
+)
+
+// PlaceDiff is the result of comparing two result files
+type PlaceDiff struct {
+	Added   []scraper.Place `json:"added"`
+	Removed []scraper.Place `json:"removed"`
+	Changed []PlaceChange   `json:"changed"`
+}
+
+// PlaceChange lists the fields of a place that differ between two files
+type PlaceChange struct {
+	Place   scraper.Place `json:"place"`
+	Changes []FieldChange `json:"changes"`
+}
+
+// FieldChange is the old and new value of a single field
+type FieldChange struct {
+	Field string `json:"field"`
+	Old   string `json:"old"`
+	New   string `json:"new"`
+}
+
+// DiffFiles compares the places of two result files. The phones read from
+// the place pages are compared only when both files have them, otherwise the
+// phones of the list cards are.
+func DiffFiles(oldPath, newPath string) (PlaceDiff, error) {
+	oldResults, err := readResults(oldPath)
+	if err != nil {
+		return PlaceDiff{}, err
+	}
+	newResults, err := readResults(newPath)
+	if err != nil {
+		return PlaceDiff{}, err
+	}
+
+	if oldResults.scraped != nil && newResults.scraped != nil {
+		return DiffPlaces(oldResults.withScrapedPhones(), newResults.withScrapedPhones()), nil
+	}
+	return DiffPlaces(oldResults.places, newResults.places), nil
+}
+
+// DiffPlaces matches the places of both lists by feature ID, or by name and
+// address when either lacks it. Changed places are reported with their new
+// values.
+func DiffPlaces(oldPlaces, newPlaces []scraper.Place) PlaceDiff {
+	diff := PlaceDiff{Added: []scraper.Place{}, Removed: []scraper.Place{}, Changed: []PlaceChange{}}
+
+	oldByID := make(map[string]int, len(oldPlaces))
+	oldByName := make(map[string]int, len(oldPlaces))
+	for i, place := range oldPlaces {
+		if place.PlaceID != "" {
+			oldByID[place.PlaceID] = i
+		}
+		if _, ok := oldByName[nameKey(place)]; !ok {
+			oldByName[nameKey(place)] = i
+		}
+	}
+	find := func(place scraper.Place) (int, bool) {
+		if i, ok := oldByID[place.PlaceID]; ok && place.PlaceID != "" {
+			return i, true
+		}
+		i, ok := oldByName[nameKey(place)]
+		if ok && place.PlaceID != "" && oldPlaces[i].PlaceID != "" {
+			// Another place with the same name and address
+			return 0, false
+		}
+		return i, ok
+	}
+
+	matched := make([]bool, len(oldPlaces))
+	index := newPlaceIndex(nil)
+	for _, place := range newPlaces {
+		if !index.add(place) {
+			continue
+		}
+
+		i, ok := find(place)
+		if !ok || matched[i] {
+			diff.Added = append(diff.Added, place)
+			continue
+		}
+		matched[i] = true
+		if changes := compareFields(oldPlaces[i], place); len(changes) > 0 {
+			diff.Changed = append(diff.Changed, PlaceChange{Place: place, Changes: changes})
+		}
+	}
+
+	index = newPlaceIndex(nil)
+	for i, place := range oldPlaces {
+		if index.add(place) && !matched[i] {
+			diff.Removed = append(diff.Removed, place)
+		}
+	}
+	return diff
+}
+
+// compareFields returns the tracked fields whose value differs. Phones are
+// compared in E.164 when both places have one, so the same number written
+// another way is not a change.
+func compareFields(old, new scraper.Place) []FieldChange {
+	oldPhone, newPhone := old.Phone, new.Phone
+	if old.PhoneE164 != "" && new.PhoneE164 != "" {
+		oldPhone, newPhone = old.PhoneE164, new.PhoneE164
+	}
+
+	fields := []struct {
+		name     string
+		old, new string
+	}{
+		{"rating", fmt.Sprintf("%.1f", old.Stars), fmt.Sprintf("%.1f", new.Stars)},
+		{"reviews", strconv.Itoa(old.Reviews), strconv.Itoa(new.Reviews)},
+		{"phone", oldPhone, newPhone},
+		{"website", old.Website, new.Website},
+		{"hours", old.Hours, new.Hours},
+	}
+
+	changes := []FieldChange{}
+	for _, field := range fields {
+		if field.old != field.new {
+			changes = append(changes, FieldChange{Field: field.name, Old: field.old, New: field.new})
+		}
+	}
+	return changes
+}
+
+// LoadPlaces reads a result file written by WritePlacesCSV,
+// WritePlacesWithPhones or the JSON and NDJSON outputs, chosen by its
+// extension. The phone read from the place page, when there is one, takes
+// precedence over the phone of the list card.
+func LoadPlaces(path string) ([]scraper.Place, error) {
+	results, err := readResults(path)
+	if err != nil {
+		return nil, err
+	}
+	return results.withScrapedPhones(), nil
+}
+
+// results are the places of a result file. scraped holds the phone the phone
+// stage read for each place, nil when the file has no ScrapedPhone column.
+type results struct {
+	places  []scraper.Place
+	scraped []scraper.Place
+}
+
+// withScrapedPhones returns the places with their scraped phone, when found,
+// instead of the phone of the list card
+func (r results) withScrapedPhones() []scraper.Place {
+	if r.scraped == nil {
+		return r.places
+	}
+	places := make([]scraper.Place, len(r.places))
+	for i, place := range r.places {
+		if scraped := r.scraped[i]; scraped.Phone != "" {
+			place.Phone = scraped.Phone
+			place.PhoneE164 = scraped.PhoneE164
+			place.PhoneType = scraped.PhoneType
+		}
+		places[i] = place
+	}
+	return places
+}
+
+// readResults reads a result file by its extension
+func readResults(path string) (results, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		return readResultsCSV(path)
+
+	case ".json":
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return results{}, fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		var places []scraper.Place
+		if err := json.Unmarshal(data, &places); err != nil {
+			return results{}, fmt.Errorf("invalid JSON file %s: %w", path, err)
+		}
+		return results{places: places}, nil
+
+	case ".ndjson":
+		file, err := os.Open(path)
+		if err != nil {
+			return results{}, fmt.Errorf("failed to open %s: %w", path, err)
+		}
+		defer file.Close()
+
+		places := []scraper.Place{}
+		decoder := json.NewDecoder(file)
+		for decoder.More() {
+			var place scraper.Place
+			if err := decoder.Decode(&place); err != nil {
+				return results{}, fmt.Errorf("invalid NDJSON file %s: %w", path, err)
+			}
+			places = append(places, place)
+		}
+		return results{places: places}, nil
+
+	default:
+		return results{}, fmt.Errorf("unsupported result file %s, expected .csv, .json or .ndjson", path)
+	}
+}
+
+// readResultsCSV reads a CSV file, looking up its columns by header name
+func readResultsCSV(path string) (results, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return results{}, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer file.Close()
+
+	records, err := csv.NewReader(file).ReadAll()
+	if err != nil {
+		return results{}, fmt.Errorf("invalid CSV file %s: %w", path, err)
+	}
+	if len(records) == 0 {
+		return results{}, fmt.Errorf("CSV file %s is empty", path)
+	}
+
+	columns := newColumnIndex(records[0])
+	if _, ok := columns["Name"]; !ok {
+		return results{}, fmt.Errorf("CSV file %s has no Name column", path)
+	}
+
+	var r results
+	r.places = make([]scraper.Place, 0, len(records)-1)
+	if _, ok := columns["ScrapedPhone"]; ok {
+		r.scraped = make([]scraper.Place, 0, len(records)-1)
+	}
+	for _, record := range records[1:] {
+		place := scraper.Place{
+			Name:      columns.get(record, "Name"),
+			Address:   columns.get(record, "Address"),
+			Hours:     columns.get(record, "Hours"),
+			Phone:     columns.get(record, "Phone"),
+			Website:   columns.get(record, "Website"),
+			GoogleURL: columns.get(record, "GoogleURL"),
+			PlaceID:   columns.get(record, "PlaceID"),
+
+			Category:    columns.get(record, "Category"),
+			PriceLevel:  columns.get(record, "PriceLevel"),
+			PlusCode:    columns.get(record, "PlusCode"),
+			Status:      columns.get(record, "Status"),
+			Claimed:     parseClaimed(columns.get(record, "Claimed")),
+			WeeklyHours: parseWeeklyHours(columns.get(record, "WeeklyHours")),
+			PhoneE164:   columns.get(record, "PhoneE164"),
+			PhoneType:   phone.Type(columns.get(record, "PhoneType")),
+		}
+		place.Schedule = scraper.ParseSchedule(place.WeeklyHours)
+		place.Stars, _ = strconv.ParseFloat(columns.get(record, "Stars"), 64)
+		place.Reviews, _ = strconv.Atoi(columns.get(record, "Reviews"))
+		place.DistanceKm, _ = strconv.ParseFloat(columns.get(record, "DistanceKm"), 64)
+		place.Coordinates.Lat, _ = strconv.ParseFloat(columns.get(record, "Latitude"), 64)
+		place.Coordinates.Lon, _ = strconv.ParseFloat(columns.get(record, "Longitude"), 64)
+
+		// Files written before the PlaceID column existed
+		if place.PlaceID == "" {
+			place.PlaceID = mapsurl.FeatureID(place.GoogleURL)
+		}
+		r.places = append(r.places, place)
+
+		if r.scraped != nil {
+			r.scraped = append(r.scraped, scraper.Place{
+				Phone:     columns.get(record, "ScrapedPhone"),
+				PhoneE164: columns.get(record, "ScrapedPhoneE164"),
+				PhoneType: phone.Type(columns.get(record, "ScrapedPhoneType")),
+			})
+		}
+	}
+	return r, nil
+}
+
+// parseClaimed reads a claimed flag written by formatClaimed
+func parseClaimed(text string) *bool {
+	switch text {
+	case "yes", "no":
+		claimed := text == "yes"
+		return &claimed
+	}
+	return nil
+}
+
+// parseWeeklyHours reads the opening hours written by formatWeeklyHours
+func parseWeeklyHours(text string) []scraper.DayHours {
+	var days []scraper.DayHours
+	for _, part := range strings.Split(text, "; ") {
+		if day, hours, found := strings.Cut(part, ": "); found {
+			days = append(days, scraper.DayHours{Day: day, Hours: hours})
+		}
+	}
+	return days
+}
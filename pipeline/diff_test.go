@@ -0,0 +1,172 @@
+package pipeline
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"mapsscrap/scraper"
+)
+
+func TestDiffPlaces(t *testing.T) {
+	bufete := scraper.Place{Name: "Bufete", Address: "Reforma 222", PlaceID: "0x1:0x2", Stars: 4.5, Reviews: 10, Phone: "55 5208 1234"}
+	notaria := scraper.Place{Name: "Notaría 12", Address: "Juárez 14", Stars: 4.0, Reviews: 3}
+	despacho := scraper.Place{Name: "Despacho", Address: "Madero 5", PlaceID: "0x3:0x4"}
+
+	changed := bufete
+	changed.Stars, changed.Reviews = 4.7, 12
+	withoutID := bufete
+	withoutID.PlaceID = ""
+	sameNameOtherID := bufete
+	sameNameOtherID.PlaceID = "0x5:0x6"
+	normalized := bufete
+	normalized.PhoneE164 = "+525552081234"
+	reformatted := normalized
+	reformatted.Phone = "(55) 5208-1234"
+	otherNumber := normalized
+	otherNumber.Phone, otherNumber.PhoneE164 = "55 1111 2222", "+525511112222"
+
+	names := func(places []scraper.Place) []string {
+		out := []string{}
+		for _, place := range places {
+			out = append(out, place.Name+"|"+place.PlaceID)
+		}
+		return out
+	}
+
+	tests := []struct {
+		name           string
+		old, new       []scraper.Place
+		added, removed []string
+		changed        []string
+		changedFields  []string
+	}{
+		{
+			name:    "added",
+			old:     []scraper.Place{bufete},
+			new:     []scraper.Place{bufete, notaria},
+			added:   []string{"Notaría 12|"},
+			removed: []string{},
+		},
+		{
+			name:    "removed",
+			old:     []scraper.Place{bufete, despacho},
+			new:     []scraper.Place{bufete},
+			added:   []string{},
+			removed: []string{"Despacho|0x3:0x4"},
+		},
+		{
+			name:          "changed",
+			old:           []scraper.Place{bufete, notaria},
+			new:           []scraper.Place{notaria, changed},
+			added:         []string{},
+			removed:       []string{},
+			changed:       []string{"Bufete|0x1:0x2"},
+			changedFields: []string{"rating", "reviews"},
+		},
+		{
+			name:    "matched by name when the ID is unknown",
+			old:     []scraper.Place{withoutID},
+			new:     []scraper.Place{bufete},
+			added:   []string{},
+			removed: []string{},
+		},
+		{
+			name:    "another ID at the same name and address",
+			old:     []scraper.Place{bufete},
+			new:     []scraper.Place{sameNameOtherID},
+			added:   []string{"Bufete|0x5:0x6"},
+			removed: []string{"Bufete|0x1:0x2"},
+		},
+		{
+			name:    "same phone in another format",
+			old:     []scraper.Place{normalized},
+			new:     []scraper.Place{reformatted},
+			added:   []string{},
+			removed: []string{},
+		},
+		{
+			name:          "another phone number",
+			old:           []scraper.Place{normalized},
+			new:           []scraper.Place{otherNumber},
+			added:         []string{},
+			removed:       []string{},
+			changed:       []string{"Bufete|0x1:0x2"},
+			changedFields: []string{"phone"},
+		},
+		{
+			name:    "duplicates counted once",
+			old:     []scraper.Place{},
+			new:     []scraper.Place{notaria, notaria},
+			added:   []string{"Notaría 12|"},
+			removed: []string{},
+		},
+	}
+	for _, tt := range tests {
+		diff := DiffPlaces(tt.old, tt.new)
+		if got := names(diff.Added); !reflect.DeepEqual(got, tt.added) {
+			t.Errorf("%s: added %q, want %q", tt.name, got, tt.added)
+		}
+		if got := names(diff.Removed); !reflect.DeepEqual(got, tt.removed) {
+			t.Errorf("%s: removed %q, want %q", tt.name, got, tt.removed)
+		}
+
+		var changedNames, fields []string
+		for _, change := range diff.Changed {
+			changedNames = append(changedNames, change.Place.Name+"|"+change.Place.PlaceID)
+			for _, field := range change.Changes {
+				fields = append(fields, field.Field)
+			}
+		}
+		if !reflect.DeepEqual(changedNames, tt.changed) || !reflect.DeepEqual(fields, tt.changedFields) {
+			t.Errorf("%s: changed %q with fields %q, want %q with %q", tt.name, changedNames, fields, tt.changed, tt.changedFields)
+		}
+	}
+}
+
+func TestDiffFiles(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	const header = "Name,Address,Stars,Reviews,Phone,Hours,Website,GoogleURL"
+	search := write("search.csv", header+",PlaceID\nBufete,Reforma 222,4.5,10,55 5208 1234,,,,0x1:0x2\n")
+	withPhones := write("search_with_phones.csv", header+",ScrapedPhone,PlaceID\nBufete,Reforma 222,4.5,10,55 5208 1234,,,,55 1111 2222,0x1:0x2\n")
+	laterPhones := write("later_with_phones.csv", header+",ScrapedPhone,PlaceID\nBufete,Reforma 222,4.5,10,55 5208 1234,,,,55 3333 4444,0x1:0x2\n")
+
+	// A search CSV compared with its _with_phones CSV has no phone change
+	diff, err := DiffFiles(search, withPhones)
+	if err != nil {
+		t.Fatalf("DiffFiles failed: %v", err)
+	}
+	if len(diff.Added) != 0 || len(diff.Removed) != 0 || len(diff.Changed) != 0 {
+		t.Errorf("diff of a CSV and its phones = %+v, want no change", diff)
+	}
+
+	// Scraped phones are compared when both files have them
+	diff, err = DiffFiles(withPhones, laterPhones)
+	if err != nil {
+		t.Fatalf("DiffFiles failed: %v", err)
+	}
+	want := []FieldChange{{Field: "phone", Old: "55 1111 2222", New: "55 3333 4444"}}
+	if len(diff.Changed) != 1 || !reflect.DeepEqual(diff.Changed[0].Changes, want) {
+		t.Errorf("diff of two phone CSVs = %+v, want %+v", diff.Changed, want)
+	}
+
+	// LoadPlaces prefers the scraped phone
+	places, err := LoadPlaces(withPhones)
+	if err != nil || len(places) != 1 || places[0].Phone != "55 1111 2222" {
+		t.Errorf("LoadPlaces() = %+v, %v, want the scraped phone", places, err)
+	}
+
+	geojson := write("search.geojson", `{"type":"FeatureCollection","features":[]}`)
+	if _, err := DiffFiles(search, geojson); err == nil {
+		t.Error("DiffFiles accepted a .geojson file")
+	}
+}
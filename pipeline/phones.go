@@ -0,0 +1,168 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"mapsscrap/browserpool"
+	"mapsscrap/progress"
+	"mapsscrap/scraper"
+)
+
+const (
+	PhoneWorkers = 3                // Place pages open at the same time by default
+	PhoneTimeout = 30 * time.Second // Timeout for the phone of a place by default
+	phoneDelay   = time.Second      // Rate limiting after each place page
+	panelDelay   = 2 * time.Second  // Time the panel of a loaded place page takes to render
+)
+
+// PanelPhone is the phone of the panel of a place in Google Maps along with
+// its WhatsApp link
+type PanelPhone struct {
+	scraper.PhoneMatch
+	WhatsApp string // wa.me or api.whatsapp.com link of the panel, if any
+}
+
+// Phones is the stage that opens the Google Maps page of every place to read
+// its phone and WhatsApp link
+type Phones struct {
+	Pool          *browserpool.Pool
+	Selectors     *scraper.Profile // The built-in profile when nil
+	Region        string           // Region whose numbering plan validates the phones
+	MinConfidence float64          // Phones found with less confidence are discarded
+	Workers       int              // PhoneWorkers when 0
+	Timeout       time.Duration    // PhoneTimeout when 0
+
+	// Progress receives the point_done, phone_found and error events of the
+	// stage, one at a time. It may be nil.
+	Progress func(progress.Event)
+}
+
+// Find reads the phone of the place page at url, with the rule that found it
+// and its confidence, and the WhatsApp link of the panel. The link is
+// returned even when no phone is found.
+func (s *Phones) Find(ctx context.Context, url string) (PanelPhone, error) {
+	timeout := s.Timeout
+	if timeout <= 0 {
+		timeout = PhoneTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	pooledPage, err := s.Pool.Acquire(ctx)
+	if err != nil {
+		return PanelPhone{}, fmt.Errorf("failed to get browser page: %w", err)
+	}
+	defer s.Pool.Release(pooledPage)
+
+	// Every wait on the page ends with ctx
+	page := pooledPage.Context(ctx)
+	if err := page.Navigate(url); err != nil {
+		return PanelPhone{}, fmt.Errorf("failed to navigate to URL: %w", err)
+	}
+
+	// Wait for the panel to finish loading
+	if err := page.WaitStable(time.Second); err != nil {
+		return PanelPhone{}, fmt.Errorf("failed to load place page: %w", err)
+	}
+	select {
+	case <-time.After(panelDelay):
+	case <-ctx.Done():
+		return PanelPhone{}, fmt.Errorf("failed to load place page: %w", ctx.Err())
+	}
+
+	selectors := s.Selectors
+	if selectors == nil {
+		selectors = scraper.DefaultProfile()
+	}
+	panel := PanelPhone{WhatsApp: scraper.FindWhatsApp(page, selectors)}
+
+	// The phone is searched in a goroutine so the timeout applies to it too
+	done := make(chan scraper.PhoneMatch, 1)
+	go func() {
+		done <- scraper.FindPhone(page, selectors, s.Region)
+	}()
+	select {
+	case match := <-done:
+		switch {
+		case match.E164 == "":
+			return panel, fmt.Errorf("no phone found")
+		case match.Confidence < s.MinConfidence:
+			return panel, fmt.Errorf("phone %s found by %s below minimum confidence (%.2f < %.2f)", match.E164, match.Source, match.Confidence, s.MinConfidence)
+		}
+		panel.PhoneMatch = match
+		return panel, nil
+	case <-ctx.Done():
+		return panel, fmt.Errorf("timeout finding phone")
+	}
+}
+
+// Run reads the phone of every place without one that has a Google Maps URL,
+// Workers places at a time, and decides how each place can be reached by
+// WhatsApp. Once ctx is done the places left are returned unchanged.
+func (s *Phones) Run(ctx context.Context, places []PlaceWithPhone) []PlaceWithPhone {
+	workers := s.Workers
+	if workers <= 0 {
+		workers = PhoneWorkers
+	}
+	updatedPlaces := make([]PlaceWithPhone, len(places))
+	copy(updatedPlaces, places)
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	semaphore := make(chan struct{}, workers)
+	phonesFound := 0
+	done := 0
+
+	for i := range updatedPlaces {
+		wg.Add(1)
+		go func(place *PlaceWithPhone) {
+			defer wg.Done()
+			defer func() {
+				mu.Lock()
+				done++
+				s.emit(progress.Event{Type: progress.PointDone, Stage: progress.StagePhones,
+					Done: done, Total: len(places), Phones: phonesFound})
+				mu.Unlock()
+			}()
+
+			semaphore <- struct{}{}
+			defer func() { <-semaphore }()
+			if ctx.Err() != nil || place.Phone != "" || place.GoogleURL == "" {
+				return
+			}
+
+			panel, err := s.Find(ctx, place.GoogleURL)
+			mu.Lock()
+			place.SetPanelPhone(panel)
+			if err == nil {
+				phonesFound++
+				s.emit(progress.Event{Type: progress.PhoneFound, Stage: progress.StagePhones,
+					Place: place.Name, Phone: panel.E164, Phones: phonesFound})
+			} else {
+				s.emit(progress.Event{Type: progress.Error, Stage: progress.StagePhones,
+					Place: place.Name, Message: err.Error()})
+			}
+			mu.Unlock()
+
+			// Rate limiting
+			select {
+			case <-time.After(phoneDelay):
+			case <-ctx.Done():
+			}
+		}(&updatedPlaces[i])
+	}
+	wg.Wait()
+
+	for i := range updatedPlaces {
+		updatedPlaces[i].UpdateWhatsApp(s.Region)
+	}
+	return updatedPlaces
+}
+
+// emit sends an event to the Progress callback, if any
+func (s *Phones) emit(event progress.Event) {
+	emit(s.Progress, event)
+}
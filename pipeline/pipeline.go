@@ -0,0 +1,231 @@
+// Package pipeline runs the scraping stages in the calling process: the search
+// of Google Maps cell by cell, the visit of every place found for its details
+// and the visit for its phone. Each stage reports its progress as progress
+// events and stops soon after its context is cancelled, keeping what it
+// found. The Pipeline type chains the stages, writing a CSV of the places and
+// one of their phones under names it chooses.
+package pipeline
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"mapsscrap/browserpool"
+	"mapsscrap/progress"
+	"mapsscrap/scraper"
+	"mapsscrap/store"
+)
+
+const (
+	DefaultRegion  = "MX" // Region of the phones when SearchParams.Region is empty
+	poolBrowsers   = 2    // Browser processes shared by the workers of both stages
+	browserMaxUses = 25   // Pages served by a browser before it is restarted
+)
+
+// NewPool returns the browser pool shared by the stages, running the Chrome
+// at bin or the one rod finds or downloads when empty
+func NewPool(bin string) *browserpool.Pool {
+	return browserpool.New(browserpool.Options{
+		Browsers:        poolBrowsers,
+		PagesPerBrowser: SearchWorkers / poolBrowsers,
+		MaxUses:         browserMaxUses,
+		Bin:             bin,
+	})
+}
+
+// Pipeline searches Google Maps and, with Params.Details, reads the details
+// of every place found from its page, dropping the closed ones with
+// Params.SkipClosed. With Phones it then reads the phone of every place. The
+// stages share the same browsers.
+type Pipeline struct {
+	Params        SearchParams
+	Phones        bool             // Run the phone stage after the search
+	MinConfidence float64          // Phones read with less confidence are discarded
+	Dir           string           // Directory the CSVs are written to, the working directory when empty
+	BaseURL       string           // scraper.DefaultBaseURL when empty
+	Selectors     *scraper.Profile // The built-in profile when nil
+	Chrome        string           // Path to the Chrome binary, rod finds or downloads one when empty
+	DBPath        string           // SQLite database the run is recorded in, none when empty
+
+	// Progress receives the events of every stage, including the finished
+	// event of each with the file it wrote. It may be nil.
+	Progress func(progress.Event)
+}
+
+// Result is what a pipeline wrote
+type Result struct {
+	PlacesFile string // CSV of the places found by the search
+	PhonesFile string // CSV of the places with their phones, empty without the phone stage
+	Places     int    // Places found
+	Closed     int    // Closed places dropped by the details stage
+	Phones     int    // Phones read by the phone stage
+}
+
+// Run runs the stages of the pipeline. When ctx is cancelled the current
+// stage stops, the places found so far are written and Run returns the files
+// written along with ctx.Err(); the stages that had not started are skipped.
+func (p *Pipeline) Run(ctx context.Context) (Result, error) {
+	params, cells := Plan(p.Params)
+	if params.Region == "" {
+		params.Region = DefaultRegion
+	}
+	startedAt := time.Now()
+
+	pool := NewPool(p.Chrome)
+	defer pool.Close()
+
+	search := Search{
+		Params:    params,
+		Pool:      pool,
+		BaseURL:   p.BaseURL,
+		Selectors: p.Selectors,
+		Progress:  p.Progress,
+	}
+	found := search.Run(ctx, State{Pending: cells}).Places
+
+	// The CSV is written by the last stage that changes the places
+	var result Result
+	stage := progress.StageScraping
+	if params.Details && len(found) > 0 && ctx.Err() == nil {
+		p.finish(ctx, progress.Event{Stage: progress.StageScraping, Places: len(found)})
+		details := Details{
+			Pool:       pool,
+			Selectors:  p.Selectors,
+			Region:     params.Region,
+			SkipClosed: params.SkipClosed,
+			Progress:   p.Progress,
+		}
+		found, result.Closed = details.Run(ctx, found)
+		stage = progress.StageDetails
+	}
+
+	result.PlacesFile = filepath.Join(p.Dir, FileName(params, startedAt))
+	result.Places = len(found)
+	if err := WritePlacesCSV(found, result.PlacesFile); err != nil {
+		return Result{}, err
+	}
+	if p.DBPath != "" {
+		if _, err := SaveRun(p.DBPath, params, result.PlacesFile, startedAt, found); err != nil {
+			return result, fmt.Errorf("failed to record run in %s: %w", p.DBPath, err)
+		}
+	}
+	p.finish(ctx, progress.Event{Stage: stage, Places: result.Places, Output: result.PlacesFile})
+
+	if !p.Phones || len(found) == 0 || ctx.Err() != nil {
+		return result, ctx.Err()
+	}
+
+	places := make([]PlaceWithPhone, len(found))
+	for i, place := range found {
+		places[i] = NewPlaceWithPhone(place)
+	}
+	phones := Phones{
+		Pool:          pool,
+		Selectors:     p.Selectors,
+		Region:        params.Region,
+		MinConfidence: p.MinConfidence,
+		Progress:      p.Progress,
+	}
+	p.emit(progress.Event{Type: progress.Start, Stage: progress.StagePhones, Total: len(places), Places: len(places)})
+	places = phones.Run(ctx, places)
+	for _, place := range places {
+		if place.ScrapedPhone != "" {
+			result.Phones++
+		}
+	}
+
+	result.PhonesFile = strings.TrimSuffix(result.PlacesFile, ".csv") + "_with_phones.csv"
+	if err := WritePlacesWithPhones(places, result.PhonesFile); err != nil {
+		return Result{PlacesFile: result.PlacesFile, Places: result.Places, Closed: result.Closed}, fmt.Errorf("failed to write %s: %w", result.PhonesFile, err)
+	}
+	p.finish(ctx, progress.Event{Stage: progress.StagePhones, Places: len(places), Phones: result.Phones, Output: result.PhonesFile})
+	return result, ctx.Err()
+}
+
+// finish emits the finished event of a stage, marked as interrupted when ctx
+// was cancelled
+func (p *Pipeline) finish(ctx context.Context, event progress.Event) {
+	event.Type = progress.Finished
+	if ctx.Err() != nil {
+		event.Message = "interrupted"
+	}
+	p.emit(event)
+}
+
+// emit sends an event to the Progress callback, if any
+func (p *Pipeline) emit(event progress.Event) {
+	emit(p.Progress, event)
+}
+
+// emit sends an event to handle, if any, stamping its time like
+// progress.Writer does
+func emit(handle func(progress.Event), event progress.Event) {
+	if handle == nil {
+		return
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	handle(event)
+}
+
+// FileName returns the name of the CSV of a search started at the given
+// time: prospects_<query>_<radius>km_<time>.csv, or prospects_<query>_area_<time>.csv
+func FileName(params SearchParams, startedAt time.Time) string {
+	// Sanitize query for filename (replace spaces and special characters)
+	sanitizedQuery := strings.ReplaceAll(params.Query, " ", "_")
+	sanitizedQuery = strings.ReplaceAll(sanitizedQuery, "/", "_")
+	sanitizedQuery = strings.ReplaceAll(sanitizedQuery, "\\", "_")
+	extent := fmt.Sprintf("%.0fkm", params.RadiusKm)
+	if params.Area != nil {
+		extent = "area"
+	}
+	return fmt.Sprintf("prospects_%s_%s_%s.csv", sanitizedQuery, extent, startedAt.Format("2006-01-02_15-04-05"))
+}
+
+// SaveRun records a run of a search written to outputPath and upserts its
+// places in the SQLite database at dbPath
+func SaveRun(dbPath string, params SearchParams, outputPath string, startedAt time.Time, places []scraper.Place) (store.Run, error) {
+	db, err := store.Open(dbPath)
+	if err != nil {
+		return store.Run{}, err
+	}
+	defer db.Close()
+
+	encoded, err := json.Marshal(params)
+	if err != nil {
+		return store.Run{}, fmt.Errorf("failed to encode search parameters: %w", err)
+	}
+
+	records := make([]store.Place, 0, len(places))
+	for _, place := range places {
+		records = append(records, store.Place{
+			Key:       PlaceKey(place),
+			NameKey:   nameKey(place),
+			PlaceID:   place.PlaceID,
+			Name:      place.Name,
+			Address:   place.Address,
+			Phone:     place.Phone,
+			Website:   place.Website,
+			Hours:     place.Hours,
+			GoogleURL: place.GoogleURL,
+			Latitude:  place.Coordinates.Lat,
+			Longitude: place.Coordinates.Lon,
+			HasCoords: place.HasLocation(),
+			Rating:    place.Stars,
+			Reviews:   place.Reviews,
+		})
+	}
+
+	return db.SaveRun(store.Run{
+		Query:      params.Query,
+		Params:     string(encoded),
+		OutputPath: outputPath,
+		StartedAt:  startedAt,
+		FinishedAt: time.Now(),
+	}, records)
+}
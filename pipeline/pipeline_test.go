@@ -0,0 +1,441 @@
+package pipeline
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-rod/rod/lib/launcher"
+
+	"mapsscrap/fixtures"
+	"mapsscrap/geo"
+	"mapsscrap/jobs"
+	"mapsscrap/phone"
+	"mapsscrap/progress"
+	"mapsscrap/scraper"
+	"mapsscrap/website"
+)
+
+// recorder collects the events of a pipeline
+type recorder struct {
+	mu     sync.Mutex
+	events []progress.Event
+}
+
+func (r *recorder) record(event progress.Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, event)
+}
+
+// finished returns the finished events, one per stage that wrote its file
+func (r *recorder) finished() []progress.Event {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var finished []progress.Event
+	for _, event := range r.events {
+		if event.Type == progress.Finished {
+			finished = append(finished, event)
+		}
+	}
+	return finished
+}
+
+func TestPlan(t *testing.T) {
+	params, cells := Plan(SearchParams{Latitude: 19.43, Longitude: -99.15, RadiusKm: 2.5, Zoom: 15, Layout: geo.LayoutSquare})
+	if len(cells) != 4 {
+		t.Fatalf("got %d cells, want a 2x2 grid", len(cells))
+	}
+	for _, cell := range cells {
+		if cell.SizeKm != GridStepKm || cell.Zoom != 15 {
+			t.Errorf("cell %+v, want size %.1f km at zoom 15", cell, GridStepKm)
+		}
+		if distance := geo.DistanceKm(geo.Point{Lat: params.Latitude, Lon: params.Longitude}, cell.Center); math.Abs(distance-2.5*math.Sqrt2) > 0.1 {
+			t.Errorf("cell %+v is %.2f km from the center", cell, distance)
+		}
+	}
+
+	// A radius within half a step is searched from the center alone
+	params, cells = Plan(SearchParams{Latitude: 19.43, Longitude: -99.15, RadiusKm: 1, Zoom: 15, Layout: geo.LayoutSquare})
+	if len(cells) != 1 || cells[0].Center != (geo.Point{Lat: params.Latitude, Lon: params.Longitude}) {
+		t.Errorf("cells for a 1 km radius = %+v, want one at the center", cells)
+	}
+
+	// An area search is centered on the area
+	area, err := geo.ParseArea([]byte(`{"type":"Polygon","coordinates":[[[-99.2,19.4],[-99.1,19.4],[-99.1,19.5],[-99.2,19.5],[-99.2,19.4]]]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	params, cells = Plan(SearchParams{Area: area, Zoom: 15, Layout: geo.LayoutSquare})
+	if math.Abs(params.Latitude-19.45) > 1e-9 || math.Abs(params.Longitude+99.15) > 1e-9 {
+		t.Errorf("area search centered at %.6f, %.6f", params.Latitude, params.Longitude)
+	}
+	for _, cell := range cells {
+		if !area.Contains(cell.Center) {
+			t.Errorf("cell %+v outside the area", cell)
+		}
+	}
+}
+
+func TestSplit(t *testing.T) {
+	center := geo.Point{Lat: 19.43, Lon: -99.15}
+	lonKm := geo.KmPerDegree * math.Cos(center.Lat*math.Pi/180)
+	east := geo.Cell{Center: geo.Point{Lat: center.Lat, Lon: center.Lon + 1.5/lonKm}, SizeKm: 2, Zoom: 15}
+
+	// Only the western quadrants of a cell on the edge of the circle are kept
+	params := SearchParams{Latitude: center.Lat, Longitude: center.Lon, RadiusKm: 1.2}
+	subCells := params.split(east)
+	if len(subCells) != 2 {
+		t.Fatalf("got %d sub-cells, want the 2 inside the radius", len(subCells))
+	}
+	for _, cell := range subCells {
+		if cell.Center.Lon >= east.Center.Lon || cell.Zoom != 16 {
+			t.Errorf("sub-cell %+v is not a western quadrant", cell)
+		}
+	}
+	if got := len(params.split(geo.Cell{Center: center, SizeKm: 2, Zoom: 15})); got != 4 {
+		t.Errorf("got %d sub-cells of the center cell, want 4", got)
+	}
+
+	// An area keeps the quadrants inside its polygons
+	area, err := geo.ParseArea([]byte(`{"type":"Polygon","coordinates":[[[-99.2,19.4],[-99.15,19.4],[-99.15,19.5],[-99.2,19.5],[-99.2,19.4]]]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	params = SearchParams{Area: area}
+	for _, cell := range params.split(geo.Cell{Center: center, SizeKm: 2, Zoom: 15}) {
+		if !area.Contains(cell.Center) {
+			t.Errorf("sub-cell %+v outside the area", cell)
+		}
+	}
+	if got := len(params.split(geo.Cell{Center: center, SizeKm: 2, Zoom: 15})); got != 2 {
+		t.Errorf("got %d sub-cells inside the area, want 2", got)
+	}
+}
+
+func TestPlaceKey(t *testing.T) {
+	withID := scraper.Place{Name: "Bufete", PlaceID: "0x1:0x2"}
+	if key := PlaceKey(withID); key != "id:0x1:0x2" {
+		t.Errorf("PlaceKey() = %q, want the place ID", key)
+	}
+
+	index := newPlaceIndex([]scraper.Place{{Name: "Café  Juárez", Address: "Av. Juárez 12,"}})
+	if index.add(scraper.Place{Name: "café juárez", Address: "av juárez 12"}) {
+		t.Error("the same name and address written differently was added twice")
+	}
+	if !index.add(scraper.Place{Name: "Café Juárez", Address: "Av. Juárez 14"}) {
+		t.Error("a place at another address was not added")
+	}
+
+	// A place is the same whether or not its ID was known when it was found
+	tests := []struct {
+		name   string
+		places []scraper.Place
+		added  []bool
+	}{
+		{
+			"found without its ID first",
+			[]scraper.Place{{Name: "Bufete", Address: "Reforma 222"}, {Name: "Bufete", Address: "Reforma 222", PlaceID: "0x1:0x2"}},
+			[]bool{true, false},
+		},
+		{
+			"found with its ID first",
+			[]scraper.Place{{Name: "Bufete", Address: "Reforma 222", PlaceID: "0x1:0x2"}, {Name: "Bufete", Address: "Reforma 222"}},
+			[]bool{true, false},
+		},
+		{
+			"another place with the same name and address",
+			[]scraper.Place{{Name: "Bufete", Address: "Reforma 222", PlaceID: "0x1:0x2"}, {Name: "Bufete", Address: "Reforma 222", PlaceID: "0x3:0x4"}},
+			[]bool{true, true},
+		},
+		{
+			"the same ID under another name",
+			[]scraper.Place{{Name: "Bufete", Address: "Reforma 222", PlaceID: "0x1:0x2"}, {Name: "Bufete Jurídico", Address: "Reforma 222", PlaceID: "0x1:0x2"}},
+			[]bool{true, false},
+		},
+	}
+	for _, tt := range tests {
+		index := newPlaceIndex(nil)
+		for i, place := range tt.places {
+			if got := index.add(place); got != tt.added[i] {
+				t.Errorf("%s: add(%+v) = %v, want %v", tt.name, place, got, tt.added[i])
+			}
+		}
+	}
+}
+
+func TestPlacesWithPhonesCSV(t *testing.T) {
+	claimed := true
+	place := scraper.Place{
+		Name:        "Bufete Jurídico Reforma",
+		Address:     "Paseo de la Reforma 222",
+		Stars:       4.8,
+		Reviews:     231,
+		Coordinates: geo.Point{Lat: 19.42847, Lon: -99.16766},
+		Phone:       "55 5208 1234",
+		PhoneE164:   "+525552081234",
+		GoogleURL:   "https://www.google.com/maps/place/Bufete/data=!4m7!3m6!1s0x85d1ff35f5bd1563:0x6c366f0e2de02ff7",
+		PlaceID:     "0x85d1ff35f5bd1563:0x6c366f0e2de02ff7",
+		DistanceKm:  1.234,
+		Claimed:     &claimed,
+		WeeklyHours: []scraper.DayHours{{Day: "lunes", Hours: "9 a.m.–6 p.m."}},
+	}
+
+	// The row of a place is the one read back from the search CSV
+	dir := t.TempDir()
+	placesPath := filepath.Join(dir, "places.csv")
+	if err := WritePlacesCSV([]scraper.Place{place}, placesPath); err != nil {
+		t.Fatalf("WritePlacesCSV failed: %v", err)
+	}
+	read, err := ReadPlacesWithPhones(placesPath)
+	if err != nil {
+		t.Fatalf("ReadPlacesWithPhones failed: %v", err)
+	}
+	row := NewPlaceWithPhone(place)
+	if len(read) != 1 || !reflect.DeepEqual(read[0], row) {
+		t.Fatalf("read %+v\nwant %+v", read, row)
+	}
+	if row.Stars != "4.8" || row.DistanceKm != "1.23" || row.extra("Claimed") != "yes" || row.extra("WeeklyHours") != "lunes: 9 a.m.–6 p.m." {
+		t.Errorf("unexpected row %+v", row)
+	}
+
+	// The columns of the phone and website stages survive a round trip
+	row.SetPanelPhone(PanelPhone{
+		PhoneMatch: scraper.PhoneMatch{Number: phone.Number{E164: "+525552081234", National: "55 5208 1234", Region: "MX", Type: phone.Landline}, Source: "button", Raw: "55 5208 1234", Confidence: 0.95},
+		WhatsApp:   "https://wa.me/5215552081234",
+	})
+	row.AddContacts(website.Contacts{Emails: []string{"hola@bufete.mx"}})
+	row.AddContacts(website.Contacts{Emails: []string{"hola@bufete.mx", "citas@bufete.mx"}})
+	row.UpdateWhatsApp("MX")
+	phonesPath := filepath.Join(dir, "phones.csv")
+	if err := WritePlacesWithPhones([]PlaceWithPhone{row}, phonesPath); err != nil {
+		t.Fatalf("WritePlacesWithPhones failed: %v", err)
+	}
+	read, err = ReadPlacesWithPhones(phonesPath)
+	if err != nil {
+		t.Fatalf("ReadPlacesWithPhones failed: %v", err)
+	}
+	if len(read) != 1 || !reflect.DeepEqual(read[0], row) {
+		t.Fatalf("read %+v\nwant %+v", read, row)
+	}
+	if got := strings.Join(row.Web.Emails, ", "); got != "hola@bufete.mx, citas@bufete.mx" {
+		t.Errorf("emails = %s, want each one once", got)
+	}
+	if row.ScrapedPhoneConfidence != "0.95" || row.WhatsApp != WhatsAppLink {
+		t.Errorf("unexpected phone columns %+v", row)
+	}
+}
+
+func TestUpdateWhatsApp(t *testing.T) {
+	tests := []struct {
+		name  string
+		place PlaceWithPhone
+		reach string
+		url   string
+	}{
+		{"no phone", PlaceWithPhone{}, "", ""},
+		{"mobile", PlaceWithPhone{ScrapedPhoneE164: "+5215512345678", ScrapedPhoneType: "mobile"}, WhatsAppMobile, "https://wa.me/5215512345678"},
+		{"landline", PlaceWithPhone{ScrapedPhoneE164: "+576012345678", ScrapedPhoneType: "landline"}, "", ""},
+		{"unknown type", PlaceWithPhone{Phone: "55 1234 5678"}, WhatsAppPossible, "https://wa.me/525512345678"},
+		{"panel link", PlaceWithPhone{ScrapedPhoneE164: "+576012345678", ScrapedPhoneType: "landline", MapsWhatsApp: "https://wa.me/573001234567"}, WhatsAppLink, "https://wa.me/573001234567"},
+	}
+	for _, tt := range tests {
+		place := tt.place
+		place.UpdateWhatsApp("MX")
+		if place.WhatsApp != tt.reach || place.WhatsAppURL != tt.url {
+			t.Errorf("%s: WhatsApp = %q %q, want %q %q", tt.name, place.WhatsApp, place.WhatsAppURL, tt.reach, tt.url)
+		}
+	}
+}
+
+func TestRunCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// No cell is searched, so no browser is launched
+	events := &recorder{}
+	p := Pipeline{
+		Params:   SearchParams{Latitude: 19.43, Longitude: -99.15, Query: "abogado", RadiusKm: 2.5, Zoom: 15},
+		Phones:   true,
+		Dir:      t.TempDir(),
+		Progress: events.record,
+	}
+	result, err := p.Run(ctx)
+	if err != context.Canceled {
+		t.Fatalf("Run() error = %v, want context.Canceled", err)
+	}
+	if result.PhonesFile != "" || !strings.HasPrefix(filepath.Base(result.PlacesFile), "prospects_abogado_2km_") {
+		t.Errorf("unexpected result %+v", result)
+	}
+	if _, err := os.Stat(result.PlacesFile); err != nil {
+		t.Errorf("the places CSV was not written: %v", err)
+	}
+
+	finished := events.finished()
+	if len(finished) != 1 || finished[0].Stage != progress.StageScraping || finished[0].Output != result.PlacesFile || finished[0].Message != "interrupted" {
+		t.Errorf("finished events = %+v, want the interrupted search", finished)
+	}
+}
+
+func TestRun(t *testing.T) {
+	bin, found := launcher.LookPath()
+	if !found {
+		t.Skip("no Chrome or Chromium installed")
+	}
+	server := httptest.NewServer(fixtures.Handler())
+	t.Cleanup(server.Close)
+
+	events := &recorder{}
+	p := Pipeline{
+		Params:   SearchParams{Latitude: 19.43, Longitude: -99.15, Query: "abogado", RadiusKm: 2.5, Zoom: 15},
+		Phones:   true,
+		Dir:      t.TempDir(),
+		BaseURL:  server.URL + "/maps",
+		Chrome:   bin,
+		Progress: events.record,
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+	result, err := p.Run(ctx)
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+
+	// The four cells list the same five places
+	if result.Places != 5 {
+		t.Errorf("found %d places, want 5", result.Places)
+	}
+	rows, err := ReadPlacesWithPhones(result.PhonesFile)
+	if err != nil {
+		t.Fatalf("failed to read %s: %v", result.PhonesFile, err)
+	}
+	scraped := 0
+	for _, row := range rows {
+		if row.Phone == "" && row.ScrapedPhoneE164 != "+525552081234" {
+			t.Errorf("no phone read for %q", row.Name)
+		}
+		if row.ScrapedPhone != "" {
+			scraped++
+		}
+	}
+	if len(rows) != 5 || scraped != result.Phones {
+		t.Errorf("%d rows with %d scraped phones, result %+v", len(rows), scraped, result)
+	}
+
+	finished := events.finished()
+	if len(finished) != 2 || finished[0].Output != result.PlacesFile || finished[1].Output != result.PhonesFile {
+		t.Errorf("finished events = %+v, want one per stage with its file", finished)
+	}
+}
+
+func TestRunDetails(t *testing.T) {
+	bin, found := launcher.LookPath()
+	if !found {
+		t.Skip("no Chrome or Chromium installed")
+	}
+	server := httptest.NewServer(fixtures.Handler())
+	t.Cleanup(server.Close)
+
+	events := &recorder{}
+	p := Pipeline{
+		Params:   SearchParams{Latitude: 19.43, Longitude: -99.15, Query: "abogado", RadiusKm: 2.5, Zoom: 15, Details: true},
+		Dir:      t.TempDir(),
+		BaseURL:  server.URL + "/maps",
+		Chrome:   bin,
+		Progress: events.record,
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+	result, err := p.Run(ctx)
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+
+	// Every fixture place page is the same operational lawyer
+	places, err := LoadPlaces(result.PlacesFile)
+	if err != nil {
+		t.Fatalf("failed to read %s: %v", result.PlacesFile, err)
+	}
+	for _, place := range places {
+		if place.Category != "Abogado" || place.Status != scraper.StatusOperational || len(place.WeeklyHours) != 7 {
+			t.Errorf("details not written for %q: %+v", place.Name, place)
+		}
+	}
+
+	finished := events.finished()
+	if len(finished) != 2 || finished[0].Stage != progress.StageScraping || finished[0].Output != "" ||
+		finished[1].Stage != progress.StageDetails || finished[1].Output != result.PlacesFile {
+		t.Errorf("finished events = %+v, want the search and the details with the file", finished)
+	}
+}
+
+func TestCancelJob(t *testing.T) {
+	bin, found := launcher.LookPath()
+	if !found {
+		t.Skip("no Chrome or Chromium installed")
+	}
+	// Place pages never finish loading, so the phone stage is busy when the
+	// job is cancelled
+	fixture := fixtures.Handler()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/maps/place/") {
+			<-r.Context().Done()
+			return
+		}
+		fixture.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+
+	phonesStarted := make(chan struct{})
+	var once sync.Once
+	queue := jobs.New(jobs.Options{Dir: t.TempDir()}, func(ctx context.Context, job jobs.Job) (any, error) {
+		p := Pipeline{
+			Params:  SearchParams{Latitude: 19.43, Longitude: -99.15, Query: "abogado", RadiusKm: 2.5, Zoom: 15},
+			Phones:  true,
+			Dir:     job.Dir,
+			BaseURL: server.URL + "/maps",
+			Chrome:  bin,
+			Progress: func(event progress.Event) {
+				if event.Type == progress.Start && event.Stage == progress.StagePhones {
+					once.Do(func() { close(phonesStarted) })
+				}
+			},
+		}
+		result, err := p.Run(ctx)
+		return result, err
+	})
+	defer queue.Close()
+
+	job, err := queue.Submit(nil)
+	if err != nil {
+		t.Fatalf("Submit failed: %v", err)
+	}
+	select {
+	case <-phonesStarted:
+	case <-time.After(5 * time.Minute):
+		t.Fatal("the phone stage did not start")
+	}
+
+	// The job stops well before a place page times out
+	const bound = 10 * time.Second
+	if _, err := queue.Cancel(job.ID); err != nil {
+		t.Fatalf("Cancel failed: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), bound)
+	defer cancel()
+	finished, err := queue.Wait(ctx, job.ID)
+	if err != nil {
+		t.Fatalf("the job was still running %v after it was cancelled", bound)
+	}
+	if result, _ := finished.Result.(Result); finished.Status != jobs.Cancelled || result.PlacesFile == "" {
+		t.Errorf("cancelled job = %+v, want the cancelled status and the places CSV", finished)
+	}
+}
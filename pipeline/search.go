@@ -0,0 +1,404 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"mapsscrap/browserpool"
+	"mapsscrap/geo"
+	"mapsscrap/progress"
+	"mapsscrap/scraper"
+)
+
+const (
+	GridStepKm    = 2.5              // Distance between grid points in kilometers for the square layout
+	ResultListCap = 120              // Maximum number of results Google Maps lists for a single search
+	SearchWorkers = 4                // Cells searched at the same time by default
+	CellTimeout   = 45 * time.Second // Timeout for the search of a cell by default
+	batchDelay    = 2 * time.Second  // Rate limiting between batches
+)
+
+// SearchParams holds the parameters for the search operation
+type SearchParams struct {
+	Latitude   float64
+	Longitude  float64
+	Query      string
+	RadiusKm   float64
+	Area       *geo.Area // Optional polygon area, takes precedence over the radius
+	Layout     geo.Layout
+	Zoom       int
+	OverlapPct float64 // Overlap between adjacent viewports for the hex layout
+	Adaptive   bool    // Split cells whose result list is full
+	MinCellKm  float64 // Smallest cell size adaptive mode splits down to
+	WithinOnly bool    // Drop places located outside the radius or area
+	Details    bool    // Open every place page for its category, status, hours...
+	SkipClosed bool    // Drop temporarily and permanently closed places, needs Details
+	Region     string  // Region whose numbering plan validates phones without country code
+}
+
+// Plan returns the parameters with the center of an area search set to the
+// center of the area, which distances are measured from, and the cells
+// covering the search: inside the area, or around the center coordinates.
+func Plan(params SearchParams) (SearchParams, []geo.Cell) {
+	if params.Area != nil {
+		center := params.Area.Center()
+		params.Latitude, params.Longitude = center.Lat, center.Lon
+	}
+
+	// The hex layout spaces points so that the viewports of neighbours overlap
+	stepKm := GridStepKm
+	if params.Layout == geo.LayoutHex {
+		stepKm = geo.StepKm(params.Zoom, params.Latitude, params.OverlapPct)
+	}
+
+	var points []geo.Point
+	switch {
+	case params.Area != nil:
+		points = params.Area.Grid(params.Layout, stepKm)
+	case params.Layout == geo.LayoutHex:
+		points = geo.HexGrid(geo.Point{Lat: params.Latitude, Lon: params.Longitude}, params.RadiusKm, stepKm)
+	default:
+		points = squareGrid(params.Latitude, params.Longitude, params.RadiusKm, stepKm)
+	}
+
+	cells := make([]geo.Cell, 0, len(points))
+	for _, point := range points {
+		cells = append(cells, geo.Cell{Center: point, SizeKm: stepKm, Zoom: params.Zoom})
+	}
+	return params, cells
+}
+
+// squareGrid creates a grid of coordinates around the center point within
+// the specified radius. The grid points are spaced by stepKm.
+func squareGrid(centerLat, centerLng float64, radiusKm float64, stepKm float64) []geo.Point {
+	// Calculate degree deltas
+	latDelta := radiusKm / geo.KmPerDegree
+	// Longitude degrees per km varies with latitude
+	lngDelta := radiusKm / (geo.KmPerDegree * math.Cos(centerLat*math.Pi/180.0))
+
+	// Calculate steps, at least one
+	latSteps := max(1, int(math.Ceil(2*radiusKm/stepKm)))
+	lngSteps := max(1, int(math.Ceil(2*radiusKm/stepKm)))
+
+	points := make([]geo.Point, 0, latSteps*lngSteps)
+	for i := 0; i < latSteps; i++ {
+		for j := 0; j < lngSteps; j++ {
+			lat := centerLat + gridOffset(latDelta, i, latSteps)
+			lon := centerLng + gridOffset(lngDelta, j, lngSteps)
+			points = append(points, geo.Point{Lat: lat, Lon: lon})
+		}
+	}
+	return points
+}
+
+// gridOffset returns the offset from the center of step i of steps spread
+// evenly from -delta to delta. A single step is the center.
+func gridOffset(delta float64, i, steps int) float64 {
+	if steps == 1 {
+		return 0
+	}
+	return -delta + 2*delta*float64(i)/float64(steps-1)
+}
+
+// contains reports whether the place lies inside the search area or radius.
+// Places whose location is unknown are kept.
+func (params SearchParams) contains(place scraper.Place) bool {
+	if !place.HasLocation() {
+		return true
+	}
+	return params.covers(place.Coordinates)
+}
+
+// covers reports whether the point lies inside the search area or radius
+func (params SearchParams) covers(point geo.Point) bool {
+	if params.Area != nil {
+		return params.Area.Contains(point)
+	}
+	return geo.DistanceKm(geo.Point{Lat: params.Latitude, Lon: params.Longitude}, point) <= params.RadiusKm
+}
+
+// split divides a saturated cell into the sub-cells whose center lies inside
+// the search area or radius, so adaptive mode never searches outside it
+func (params SearchParams) split(cell geo.Cell) []geo.Cell {
+	subCells := []geo.Cell{}
+	for _, subCell := range cell.Split() {
+		if params.covers(subCell.Center) {
+			subCells = append(subCells, subCell)
+		}
+	}
+	return subCells
+}
+
+// State is how far a search got: the cells left, searched and failed and the
+// places found. It is all a checkpoint needs to resume the search.
+type State struct {
+	Pending []geo.Cell
+	Done    []geo.Cell
+	Failed  []geo.Cell
+	Places  []scraper.Place
+}
+
+// SearchResult is the state a search ended in
+type SearchResult struct {
+	State
+	SplitCells int // Saturated cells split into smaller cells
+	Outside    int // Results dropped for lying outside the search area
+}
+
+// Search is the stage that searches Google Maps cell by cell. The places of
+// every cell are deduplicated with the places found before.
+type Search struct {
+	Params    SearchParams
+	Pool      *browserpool.Pool
+	BaseURL   string           // scraper.DefaultBaseURL when empty
+	Selectors *scraper.Profile // The built-in profile when nil
+	Workers   int              // SearchWorkers when 0
+	Timeout   time.Duration    // CellTimeout when 0
+
+	// Progress receives the start, place_found, point_done and error events
+	// of the stage, one at a time. It may be nil.
+	Progress func(progress.Event)
+	// Checkpoint is called after every batch of cells with the state of the
+	// search. It may be nil.
+	Checkpoint func(State)
+}
+
+// cellResult holds the places found when searching a cell
+type cellResult struct {
+	Index  int // Position of the cell in its batch
+	Cell   geo.Cell
+	Places []scraper.Place
+}
+
+// Run searches the pending cells of the state in batches of Workers cells.
+// In adaptive mode a cell whose result list is full is split into four
+// sub-cells at a higher zoom and re-queued, down to Params.MinCellKm; the
+// sub-cells outside the search area or radius are dropped. No
+// batch is started once ctx is done; the cells left stay pending.
+func (s *Search) Run(ctx context.Context, state State) SearchResult {
+	params := s.Params
+	workers := s.Workers
+	if workers <= 0 {
+		workers = SearchWorkers
+	}
+	queue := state.Pending
+	result := SearchResult{State: state}
+	if result.Places == nil {
+		result.Places = []scraper.Place{}
+	}
+
+	seen := newPlaceIndex(result.Places)
+	center := geo.Point{Lat: params.Latitude, Lon: params.Longitude}
+	total := len(queue)
+	done := 0
+	s.emit(progress.Event{Type: progress.Start, Stage: progress.StageScraping, Total: total, Places: len(result.Places)})
+
+	// Process cells in batches until the queue is empty or the search is interrupted
+	for len(queue) > 0 && ctx.Err() == nil {
+		batch := queue[:min(workers, len(queue))]
+		queue = queue[len(batch):]
+
+		results := make(chan cellResult, len(batch))
+		errs := make(chan error, len(batch))
+		var wg sync.WaitGroup
+		for i, cell := range batch {
+			wg.Add(1)
+			go func(i int, cell geo.Cell) {
+				defer wg.Done()
+				places, err := s.searchCell(ctx, cell)
+				if err != nil {
+					errs <- fmt.Errorf("searching at %.6f, %.6f: %w", cell.Center.Lat, cell.Center.Lon, err)
+					return
+				}
+				results <- cellResult{Index: i, Cell: cell, Places: places}
+			}(i, cell)
+		}
+		wg.Wait()
+		close(results)
+		close(errs)
+
+		// Process results, remove duplicates and re-queue saturated cells
+		searched := make([]bool, len(batch))
+		for cell := range results {
+			searched[cell.Index] = true
+
+			if params.Adaptive && len(cell.Places) >= ResultListCap && cell.Cell.SizeKm/2 >= params.MinCellKm {
+				if subCells := params.split(cell.Cell); len(subCells) > 0 {
+					queue = append(queue, subCells...)
+					total += len(subCells)
+					result.SplitCells++
+				}
+			}
+
+			for _, place := range cell.Places {
+				if place.HasLocation() {
+					place.DistanceKm = geo.DistanceKm(center, place.Coordinates)
+				}
+				place.NormalizePhone(params.Region)
+				if params.WithinOnly && !params.contains(place) {
+					result.Outside++
+					continue
+				}
+				if seen.add(place) {
+					result.Places = append(result.Places, place)
+					s.emit(progress.Event{Type: progress.PlaceFound, Stage: progress.StageScraping,
+						Place: place.Name, Phone: place.PhoneE164, Places: len(result.Places)})
+				}
+			}
+			done++
+			s.emit(progress.Event{Type: progress.PointDone, Stage: progress.StageScraping,
+				Done: done, Total: total, Places: len(result.Places)})
+		}
+
+		// Cells that failed or timed out are retried when the search is resumed
+		for err := range errs {
+			s.emit(progress.Event{Type: progress.Error, Stage: progress.StageScraping, Message: err.Error()})
+		}
+		for i, cell := range batch {
+			if searched[i] {
+				result.Done = append(result.Done, cell)
+			} else {
+				result.Failed = append(result.Failed, cell)
+				done++
+				s.emit(progress.Event{Type: progress.PointDone, Stage: progress.StageScraping,
+					Done: done, Total: total, Places: len(result.Places)})
+			}
+		}
+		result.Pending = queue
+		if s.Checkpoint != nil {
+			s.Checkpoint(result.State)
+		}
+
+		if len(queue) > 0 {
+			select {
+			case <-time.After(batchDelay):
+			case <-ctx.Done():
+			}
+		}
+	}
+	return result
+}
+
+// searchCell borrows a page from the pool and searches Google Maps around the
+// center of the cell. The search is abandoned after Timeout.
+func (s *Search) searchCell(ctx context.Context, cell geo.Cell) ([]scraper.Place, error) {
+	timeout := s.Timeout
+	if timeout <= 0 {
+		timeout = CellTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	pooledPage, err := s.Pool.Acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer s.Pool.Release(pooledPage)
+
+	baseURL := s.BaseURL
+	if baseURL == "" {
+		baseURL = scraper.DefaultBaseURL
+	}
+	selectors := s.Selectors
+	if selectors == nil {
+		selectors = scraper.DefaultProfile()
+	}
+
+	// Run the search in a goroutine so a stuck page cannot hold the batch
+	// past the timeout; the page's own timeout releases it soon after
+	type searched struct {
+		places []scraper.Place
+		err    error
+	}
+	done := make(chan searched, 1)
+	go func() {
+		page := pooledPage.Timeout(timeout)
+		places, err := scraper.Search(page, scraper.SearchURL(baseURL, s.Params.Query, cell.Center, cell.Zoom), selectors)
+		done <- searched{places, err}
+	}()
+
+	select {
+	case result := <-done:
+		return result.places, result.err
+	case <-ctx.Done():
+		return nil, fmt.Errorf("search timed out after %s", timeout)
+	}
+}
+
+// emit sends an event to the Progress callback, if any
+func (s *Search) emit(event progress.Event) {
+	emit(s.Progress, event)
+}
+
+// placeIndex remembers the places collected so far by their feature ID and by
+// their normalized name and address. A place listed once without its ID is
+// matched by name and address, unless both places have different IDs.
+type placeIndex struct {
+	ids   map[string]bool
+	names map[string]string // Feature ID of the place with the name key, empty when unknown
+}
+
+// newPlaceIndex creates an index containing the given places
+func newPlaceIndex(places []scraper.Place) placeIndex {
+	index := placeIndex{ids: map[string]bool{}, names: map[string]string{}}
+	for _, place := range places {
+		index.add(place)
+	}
+	return index
+}
+
+// add records the place under both of its keys and reports whether it was
+// not seen before.
+func (index placeIndex) add(place scraper.Place) bool {
+	key := nameKey(place)
+	id, named := index.names[key]
+	if place.PlaceID == "" {
+		if named {
+			return false
+		}
+		index.names[key] = ""
+		return true
+	}
+
+	if index.ids[place.PlaceID] {
+		return false
+	}
+	index.ids[place.PlaceID] = true
+	switch {
+	case !named:
+		index.names[key] = place.PlaceID
+	case id == "":
+		// The place seen without its ID
+		index.names[key] = place.PlaceID
+		return false
+	}
+	return true
+}
+
+// PlaceKey identifies a place by its Google feature ID. Places without one
+// fall back to their normalized name and address.
+func PlaceKey(place scraper.Place) string {
+	if place.PlaceID != "" {
+		return "id:" + place.PlaceID
+	}
+	return nameKey(place)
+}
+
+// nameKey identifies a place by its normalized name and address
+func nameKey(place scraper.Place) string {
+	return "name:" + normalizeText(place.Name) + "|" + normalizeText(place.Address)
+}
+
+// normalizeText lowercases the text and keeps only letters and digits separated
+// by single spaces, so "Av. Juárez  12," and "av juárez 12" compare equal.
+func normalizeText(text string) string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	return strings.Join(words, " ")
+}
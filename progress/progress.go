@@ -0,0 +1,103 @@
+// Package progress is the structured progress protocol between the scraper
+// binaries and external programs running them. With --progress=json a binary
+// writes one JSON event per line to a dedicated file descriptor, leaving
+// stdout and stderr to humans. The web server runs the pipeline in-process
+// and receives the same events as function calls.
+package progress
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// Event types
+const (
+	Start      = "start"       // A stage starts, with its Total units of work
+	PointDone  = "point_done"  // A unit of work finished: a search cell or a place visited for its phone
+	PlaceFound = "place_found" // A new place was found
+	PhoneFound = "phone_found" // A phone was extracted for a place
+	Error      = "error"       // A unit of work failed; the stage goes on
+	Finished   = "finished"    // The stage ended and its output was written
+)
+
+// Stages of the pipeline
+const (
+	StageScraping = "scraping"
+	StageDetails  = "details"
+	StagePhones   = "phones"
+)
+
+// Modes of the --progress flag
+const (
+	ModeBar  = "bar"  // Progress bar for humans, no events
+	ModeJSON = "json" // Events on a dedicated file descriptor
+)
+
+// DefaultFD is the file descriptor events are written to, the first one
+// after stdin, stdout and stderr
+const DefaultFD = 3
+
+// Event is a line of the protocol
+type Event struct {
+	Type    string    `json:"event"`
+	Time    time.Time `json:"time"`
+	Stage   string    `json:"stage,omitempty"`
+	Done    int       `json:"done,omitempty"`    // Units of work finished so far
+	Total   int       `json:"total,omitempty"`   // Units of work of the stage, adaptive searches add cells
+	Place   string    `json:"place,omitempty"`   // Name of the place found or whose phone was found
+	Phone   string    `json:"phone,omitempty"`   // Phone found, in E.164
+	Message string    `json:"message,omitempty"` // Description of an error
+	Places  int       `json:"places,omitempty"`  // Places found so far
+	Phones  int       `json:"phones,omitempty"`  // Phones found so far
+	Output  string    `json:"output,omitempty"`  // File written when the stage finished
+}
+
+// Writer emits events. A nil Writer discards them, so callers need not check
+// whether events were requested.
+type Writer struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+// NewWriter returns a Writer emitting events to w
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{enc: json.NewEncoder(w)}
+}
+
+// Open returns the Writer for a --progress mode: nil for bar and a Writer on
+// the file descriptor fd for json. The descriptor must be open, usually
+// passed by the parent process.
+func Open(mode string, fd int) (*Writer, error) {
+	switch mode {
+	case ModeBar, "":
+		return nil, nil
+	case ModeJSON:
+		file := os.NewFile(uintptr(fd), "progress")
+		if file == nil {
+			return nil, fmt.Errorf("invalid progress file descriptor %d", fd)
+		}
+		if _, err := file.Stat(); err != nil {
+			return nil, fmt.Errorf("progress file descriptor %d is not open: %w", fd, err)
+		}
+		return NewWriter(file), nil
+	}
+	return nil, fmt.Errorf("unknown progress mode %q, expected %s or %s", mode, ModeBar, ModeJSON)
+}
+
+// Emit writes an event, stamping its time. Errors are ignored: progress must
+// never stop a scrape.
+func (w *Writer) Emit(event Event) {
+	if w == nil {
+		return
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.enc.Encode(event)
+}
@@ -0,0 +1,113 @@
+package progress
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWrite(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	sent := []Event{
+		{Type: Start, Stage: StageScraping, Total: 4},
+		{Type: PlaceFound, Stage: StageScraping, Place: "Bufete Reforma", Places: 1},
+		{Type: PointDone, Stage: StageScraping, Done: 1, Total: 4, Places: 1},
+		{Type: Error, Stage: StageScraping, Message: "timeout"},
+		{Type: Finished, Stage: StageScraping, Places: 1, Output: "prospects.csv"},
+	}
+	for _, event := range sent {
+		w.Emit(event)
+	}
+
+	// A nil Writer discards events
+	var none *Writer
+	none.Emit(Event{Type: Start})
+
+	if lines := strings.Count(buf.String(), "\n"); lines != len(sent) {
+		t.Fatalf("wrote %d lines, want one per event:\n%s", lines, buf.String())
+	}
+	if !strings.HasPrefix(buf.String(), `{"event":"start","time":`) {
+		t.Errorf("first line = %q", strings.SplitN(buf.String(), "\n", 2)[0])
+	}
+
+	for i, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var event Event
+		if err := json.Unmarshal([]byte(line), &event); err != nil {
+			t.Fatalf("line %d is not an event: %v", i, err)
+		}
+		if event.Time.IsZero() || time.Since(event.Time) > time.Minute {
+			t.Errorf("event %d has time %v", i, event.Time)
+		}
+		event.Time = time.Time{}
+		if !reflect.DeepEqual(event, sent[i]) {
+			t.Errorf("event %d = %+v, want %+v", i, event, sent[i])
+		}
+	}
+}
+
+func TestOpen(t *testing.T) {
+	if w, err := Open(ModeBar, DefaultFD); w != nil || err != nil {
+		t.Errorf("Open(bar) = %v, %v, want no writer", w, err)
+	}
+	if _, err := Open("xml", DefaultFD); err == nil {
+		t.Error("expected an error for an unknown mode")
+	}
+
+	file, err := os.CreateTemp(t.TempDir(), "events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	w, err := Open(ModeJSON, int(file.Fd()))
+	if err != nil {
+		t.Fatalf("Open(json) failed: %v", err)
+	}
+	w.Emit(Event{Type: Finished})
+	content, _ := os.ReadFile(file.Name())
+	if !bytes.Contains(content, []byte(`"event":"finished"`)) {
+		t.Errorf("file content = %q, want the event", content)
+	}
+
+	if _, err := Open(ModeJSON, 1000); err == nil {
+		t.Error("expected an error for a closed file descriptor")
+	}
+}
+
+func TestTracker(t *testing.T) {
+	var tracker Tracker
+	start := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	tracker.Update(Event{Type: Start, Stage: StagePhones, Total: 4, Time: start})
+	if !tracker.Update(Event{Type: PointDone, Done: 1, Total: 4, Phones: 1, Time: start.Add(10 * time.Second)}) {
+		t.Fatal("point_done did not change the progress")
+	}
+	if tracker.Stage != StagePhones || tracker.Percentage() != 25 || tracker.Phones != 1 {
+		t.Errorf("tracker = %+v, %d%%", tracker, tracker.Percentage())
+	}
+	if eta := tracker.ETA(); eta != 30*time.Second {
+		t.Errorf("ETA() = %v, want 30s", eta)
+	}
+	if tracker.Update(Event{Type: Error, Message: "timeout"}) {
+		t.Error("an error changed the progress")
+	}
+
+	tracker.Update(Event{Type: Finished})
+	if tracker.Percentage() != 100 || tracker.ETA() != 0 {
+		t.Errorf("finished stage at %d%% with ETA %v", tracker.Percentage(), tracker.ETA())
+	}
+}
+
+func TestTrackerUnstamped(t *testing.T) {
+	// Events of the in-process pipeline may come without a time
+	var tracker Tracker
+	tracker.Update(Event{Type: Start, Stage: StageScraping, Total: 10})
+	time.Sleep(20 * time.Millisecond)
+	tracker.Update(Event{Type: PointDone, Done: 1, Total: 10})
+	if eta := tracker.ETA(); eta <= 0 {
+		t.Errorf("ETA() = %v for unstamped events, want a positive estimate", eta)
+	}
+}
@@ -0,0 +1,64 @@
+package progress
+
+import "time"
+
+// Tracker follows a run from its events: the stage in progress, its units of
+// work done and total, the places and phones found so far and the time the
+// stage has left at its current pace
+type Tracker struct {
+	Stage  string
+	Done   int
+	Total  int
+	Places int
+	Phones int
+
+	stageStart time.Time
+	last       time.Time
+}
+
+// Update records an event and reports whether the progress changed. Events
+// without a time are taken as happening now.
+func (t *Tracker) Update(event Event) bool {
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	switch event.Type {
+	case Start:
+		t.Stage = event.Stage
+		t.stageStart = event.Time
+		t.Done, t.Total = 0, event.Total
+	case PointDone:
+		t.Done, t.Total = event.Done, event.Total
+	case PlaceFound, PhoneFound:
+	case Finished:
+		t.Done = t.Total
+	default:
+		return false
+	}
+	t.last = event.Time
+	if event.Places > 0 {
+		t.Places = event.Places
+	}
+	if event.Phones > 0 {
+		t.Phones = event.Phones
+	}
+	return true
+}
+
+// Percentage returns the share of the work of the stage done, from 0 to 100
+func (t *Tracker) Percentage() int {
+	if t.Total <= 0 {
+		return 0
+	}
+	return t.Done * 100 / t.Total
+}
+
+// ETA estimates the time the stage has left from the pace of the work done
+// up to the last event, 0 when unknown or finished
+func (t *Tracker) ETA() time.Duration {
+	if t.Done <= 0 || t.Done >= t.Total || t.stageStart.IsZero() {
+		return 0
+	}
+	elapsed := t.last.Sub(t.stageStart)
+	return time.Duration(float64(elapsed) * float64(t.Total-t.Done) / float64(t.Done))
+}
@@ -0,0 +1,87 @@
+package scraper
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-rod/rod"
+)
+
+// FetchDetails opens the Google Maps page of the place and returns the place
+// with its category, price level, plus code, business status, unclaimed flag and
+// weekly opening hours, also parsed into a Schedule. A phone or website missing
+// from the result card is taken from the page as well, the phone validated with
+// the numbering plan of the region.
+func FetchDetails(page *rod.Page, place Place, profile *Profile, region string) (Place, error) {
+	if place.GoogleURL == "" {
+		return place, fmt.Errorf("place %q has no Google Maps URL", place.Name)
+	}
+
+	if err := page.Navigate(place.GoogleURL); err != nil {
+		return place, fmt.Errorf("failed to navigate: %w", err)
+	}
+	if err := page.WaitStable(time.Second); err != nil {
+		return place, fmt.Errorf("page did not load: %w", err)
+	}
+
+	fields := profile.Place.Fields
+	place.Category = extract(page, fields[FieldCategory], nil)
+	place.PriceLevel = extract(page, fields[FieldPrice], nil)
+	place.PlusCode = extract(page, fields[FieldPlusCode], nil)
+	place.Status = parseStatus(extract(page, fields[FieldStatus], nil))
+	// The page only shows a positive signal for unclaimed listings, a missing
+	// claim link may as well be a selector that no longer matches
+	if extract(page, fields[FieldClaimLink], nil) != "" {
+		claimed := false
+		place.Claimed = &claimed
+	}
+	place.WeeklyHours = weeklyHours(page, profile.Place.WeeklyHours)
+	place.Schedule = ParseSchedule(place.WeeklyHours)
+
+	if place.Phone == "" {
+		if match := FindPhone(page, profile, region); match.E164 != "" {
+			place.SetPhone(match.Number)
+		}
+	}
+	if place.Website == "" {
+		place.Website = extract(page, fields[FieldWebsite], nil)
+	}
+
+	return place, nil
+}
+
+// parseStatus maps the closed notice of a place page to a Status constant
+func parseStatus(notice string) string {
+	notice = strings.ToLower(notice)
+	switch {
+	case strings.Contains(notice, "permanent"):
+		return StatusPermanentlyClosed
+	case strings.Contains(notice, "temporal"), strings.Contains(notice, "temporarily"):
+		return StatusTemporarilyClosed
+	}
+	return StatusOperational
+}
+
+// weeklyHours reads the day and hours of every row of the opening hours table
+func weeklyHours(page *rod.Page, selectors HoursSelectors) []DayHours {
+	for _, selector := range selectors.Row {
+		rows, err := page.Elements(selector)
+		if err != nil || len(rows) == 0 {
+			continue
+		}
+
+		hours := []DayHours{}
+		for _, row := range rows {
+			day := extract(row, selectors.Day, nil)
+			if day == "" {
+				continue
+			}
+			hours = append(hours, DayHours{Day: day, Hours: extract(row, selectors.Time, nil)})
+		}
+		if len(hours) > 0 {
+			return hours
+		}
+	}
+	return nil
+}
@@ -0,0 +1,155 @@
+package scraper
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/go-rod/rod"
+
+	"mapsscrap/geo"
+)
+
+// HealthCheck runs a known search and checks how many results come back and
+// how often each field is filled. When Google changes its markup, selectors
+// stop matching and fill rates drop long before results disappear entirely.
+type HealthCheck struct {
+	Query      string             `json:"query"`
+	Center     geo.Point          `json:"center"`
+	Zoom       int                `json:"zoom"`
+	MinResults int                `json:"min_results"`
+	Thresholds map[string]float64 `json:"thresholds"` // Minimum fill rate per field, between 0 and 1
+}
+
+// HealthFields are the fields whose fill rate is checked, in report order
+var HealthFields = []string{FieldName, FieldRating, FieldReviews, FieldAddress, FieldPhone, FieldWebsite, FieldGoogleURL}
+
+// DefaultHealthCheck searches restaurants around the Zócalo of Mexico City,
+// an area dense enough to always fill the result list.
+func DefaultHealthCheck() HealthCheck {
+	return HealthCheck{
+		Query:      "restaurante",
+		Center:     geo.Point{Lat: 19.4326077, Lon: -99.133208},
+		Zoom:       15,
+		MinResults: 10,
+		Thresholds: map[string]float64{
+			FieldName:      0.95,
+			FieldRating:    0.7,
+			FieldReviews:   0.7,
+			FieldAddress:   0.8,
+			FieldPhone:     0.2,
+			FieldWebsite:   0.1,
+			FieldGoogleURL: 0.95,
+		},
+	}
+}
+
+// HealthReport is the outcome of a health check
+type HealthReport struct {
+	Query          string        `json:"query"`
+	ProfileVersion string        `json:"profile_version"`
+	Results        int           `json:"results"`
+	MinResults     int           `json:"min_results"`
+	Fields         []FieldHealth `json:"fields"`
+	Healthy        bool          `json:"healthy"`
+	Error          string        `json:"error,omitempty"` // Set when the search itself failed
+}
+
+// FieldHealth is the fill rate of a field compared to its threshold
+type FieldHealth struct {
+	Field     string  `json:"field"`
+	FillRate  float64 `json:"fill_rate"`
+	Threshold float64 `json:"threshold"`
+	OK        bool    `json:"ok"`
+}
+
+// Run performs the check's search in the page and evaluates the results
+func (c HealthCheck) Run(page *rod.Page, baseURL string, profile *Profile) HealthReport {
+	places, err := Search(page, SearchURL(baseURL, c.Query, c.Center, c.Zoom), profile)
+	if err != nil {
+		report := c.Evaluate(nil)
+		report.ProfileVersion = profile.Version
+		report.Error = err.Error()
+		return report
+	}
+	report := c.Evaluate(places)
+	report.ProfileVersion = profile.Version
+	return report
+}
+
+// Evaluate computes the fill rate of every field of the places and compares
+// it and the number of results to the check's thresholds.
+func (c HealthCheck) Evaluate(places []Place) HealthReport {
+	report := HealthReport{
+		Query:      c.Query,
+		Results:    len(places),
+		MinResults: c.MinResults,
+		Fields:     make([]FieldHealth, 0, len(HealthFields)),
+		Healthy:    len(places) >= c.MinResults && len(places) > 0,
+	}
+
+	for _, field := range HealthFields {
+		filled := 0
+		for _, place := range places {
+			if place.filled(field) {
+				filled++
+			}
+		}
+
+		health := FieldHealth{Field: field, Threshold: c.Thresholds[field]}
+		if len(places) > 0 {
+			health.FillRate = float64(filled) / float64(len(places))
+		}
+		health.OK = len(places) > 0 && health.FillRate >= health.Threshold
+		if !health.OK {
+			report.Healthy = false
+		}
+		report.Fields = append(report.Fields, health)
+	}
+	return report
+}
+
+// String formats the report as a table for the terminal
+func (r HealthReport) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Query %q, selector profile %s\n", r.Query, r.ProfileVersion)
+	if r.Error != "" {
+		fmt.Fprintf(&b, "Search failed: %s\n", r.Error)
+	}
+	fmt.Fprintf(&b, "%-12s %4d (min %d)\n", "results", r.Results, r.MinResults)
+	for _, field := range r.Fields {
+		status := "ok"
+		if !field.OK {
+			status = "DEGRADED"
+		}
+		fmt.Fprintf(&b, "%-12s %3.0f%% (min %3.0f%%) %s\n", field.Field, field.FillRate*100, field.Threshold*100, status)
+	}
+	if r.Healthy {
+		b.WriteString("Healthy\n")
+	} else {
+		b.WriteString("Degraded\n")
+	}
+	return b.String()
+}
+
+// filled reports whether the place has a value for the profile field
+func (p Place) filled(field string) bool {
+	switch field {
+	case FieldName:
+		return p.Name != ""
+	case FieldRating:
+		return p.Stars > 0
+	case FieldReviews:
+		return p.Reviews > 0
+	case FieldAddress:
+		return p.Address != ""
+	case FieldHours:
+		return p.Hours != ""
+	case FieldPhone:
+		return p.Phone != ""
+	case FieldWebsite:
+		return p.Website != ""
+	case FieldGoogleURL:
+		return p.GoogleURL != ""
+	}
+	return false
+}
@@ -0,0 +1,265 @@
+package scraper
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule is the weekly opening schedule of a place, parsed from the opening
+// hours table of its page. Days missing from the schedule are unknown.
+type Schedule []DaySchedule
+
+// DaySchedule holds when a place is open on a day of the week
+type DaySchedule struct {
+	Day       Weekday    `json:"day"`
+	Closed    bool       `json:"closed,omitempty"`
+	Open24h   bool       `json:"open_24h,omitempty"`
+	Intervals []Interval `json:"intervals,omitempty"`
+}
+
+// Interval is a period a place is open. Close is not after Open when the
+// place closes after midnight, e.g. 20:00 to 02:00.
+type Interval struct {
+	Open  Clock `json:"open"`
+	Close Clock `json:"close"`
+}
+
+// Clock is a time of day in minutes since midnight, written as "15:04"
+type Clock int
+
+// MarshalText writes the clock as "15:04"
+func (c Clock) MarshalText() ([]byte, error) {
+	return []byte(fmt.Sprintf("%02d:%02d", c/60, c%60)), nil
+}
+
+// UnmarshalText reads a clock written as "15:04"
+func (c *Clock) UnmarshalText(text []byte) error {
+	var hour, minute int
+	if _, err := fmt.Sscanf(string(text), "%d:%d", &hour, &minute); err != nil || hour > 23 || minute > 59 {
+		return fmt.Errorf("invalid time of day %q", text)
+	}
+	*c = Clock(hour*60 + minute)
+	return nil
+}
+
+// Weekday is a day of the week written by its lowercase English name
+type Weekday time.Weekday
+
+// MarshalText writes the day as "monday", "tuesday"...
+func (d Weekday) MarshalText() ([]byte, error) {
+	return []byte(strings.ToLower(time.Weekday(d).String())), nil
+}
+
+// UnmarshalText reads a day name in English or Spanish
+func (d *Weekday) UnmarshalText(text []byte) error {
+	weekday, ok := parseWeekday(string(text))
+	if !ok {
+		return fmt.Errorf("unknown day %q", text)
+	}
+	*d = Weekday(weekday)
+	return nil
+}
+
+// weekdayNames maps the day names of the English and Spanish interfaces
+var weekdayNames = map[string]time.Weekday{
+	"sunday": time.Sunday, "domingo": time.Sunday,
+	"monday": time.Monday, "lunes": time.Monday,
+	"tuesday": time.Tuesday, "martes": time.Tuesday,
+	"wednesday": time.Wednesday, "miércoles": time.Wednesday, "miercoles": time.Wednesday,
+	"thursday": time.Thursday, "jueves": time.Thursday,
+	"friday": time.Friday, "viernes": time.Friday,
+	"saturday": time.Saturday, "sábado": time.Saturday, "sabado": time.Saturday,
+}
+
+// parseWeekday reads the day name a row of the hours table starts with.
+// Holidays are noted after the name, e.g. "jueves (Día de la Independencia)".
+func parseWeekday(text string) (time.Weekday, bool) {
+	fields := strings.Fields(strings.ToLower(text))
+	if len(fields) == 0 {
+		return 0, false
+	}
+	weekday, ok := weekdayNames[strings.Trim(fields[0], ",:")]
+	return weekday, ok
+}
+
+var (
+	meridiemPattern   = regexp.MustCompile(`\b([ap])\s*m\b`)
+	rangeWordPattern  = regexp.MustCompile(`\s+(?:to|a|hasta)\s+`)
+	separatorPattern  = regexp.MustCompile(`\s*(?:,|;|\by\b|\band\b)\s*`)
+	clockPattern      = regexp.MustCompile(`^(\d{1,2})(?::(\d{2}))?\s*(am|pm)?$`)
+	open24hPattern    = regexp.MustCompile(`24\s*(?:horas|hours|h)\b`)
+	closedDayPatterns = []string{"cerrado", "closed"}
+)
+
+// ParseSchedule parses the opening hours read from a place page. Days whose
+// hours cannot be understood are left out of the schedule.
+func ParseSchedule(days []DayHours) Schedule {
+	schedule := Schedule{}
+	for _, day := range days {
+		if parsed, err := ParseDayHours(day); err == nil {
+			schedule = append(schedule, parsed)
+		}
+	}
+	if len(schedule) == 0 {
+		return nil
+	}
+	return schedule
+}
+
+// ParseDayHours parses the hours of a day as Google shows them in Spanish or
+// English, e.g. "9 a.m.–2 p.m., 4–8 p.m.", "11:30 AM–10 PM", "Cerrado" or
+// "Open 24 hours".
+func ParseDayHours(day DayHours) (DaySchedule, error) {
+	weekday, ok := parseWeekday(day.Day)
+	if !ok {
+		return DaySchedule{}, fmt.Errorf("unknown day %q", day.Day)
+	}
+	schedule := DaySchedule{Day: Weekday(weekday)}
+
+	text := normalizeHours(day.Hours)
+	if text == "" {
+		return schedule, fmt.Errorf("no hours for %s", day.Day)
+	}
+	if open24hPattern.MatchString(text) {
+		schedule.Open24h = true
+		return schedule, nil
+	}
+	for _, closed := range closedDayPatterns {
+		if strings.HasPrefix(text, closed) {
+			schedule.Closed = true
+			return schedule, nil
+		}
+	}
+
+	for _, part := range separatorPattern.Split(text, -1) {
+		if part == "" {
+			continue
+		}
+		interval, err := parseInterval(part)
+		if err != nil {
+			return schedule, fmt.Errorf("invalid hours %q for %s: %w", day.Hours, day.Day, err)
+		}
+		schedule.Intervals = append(schedule.Intervals, interval)
+	}
+	if len(schedule.Intervals) == 0 {
+		return schedule, fmt.Errorf("no hours for %s", day.Day)
+	}
+	return schedule, nil
+}
+
+// normalizeHours lowercases the hours and writes "a. m.", "a.m." and "AM" as
+// "am", midday and midnight as clock times and every range as "open-close".
+func normalizeHours(hours string) string {
+	text := strings.ToLower(hours)
+	text = strings.NewReplacer(
+		"\u202f", " ", "\u00a0", " ", ".", "",
+		"–", "-", "—", "-", "‒", "-",
+		"mediodía", "12 pm", "mediodia", "12 pm", "noon", "12 pm",
+		"medianoche", "12 am", "midnight", "12 am",
+	).Replace(text)
+	text = meridiemPattern.ReplaceAllString(text, "${1}m")
+	text = rangeWordPattern.ReplaceAllString(text, "-")
+	text = strings.TrimPrefix(text, "de ")
+	text = strings.TrimPrefix(text, "from ")
+	return strings.TrimSpace(text)
+}
+
+// parseInterval parses a normalized range such as "9 am-2 pm" or "16:00-20:00".
+// An opening time without am or pm takes the one of the closing time, as in
+// "4-8 pm".
+func parseInterval(text string) (Interval, error) {
+	open, close, found := strings.Cut(text, "-")
+	if !found {
+		return Interval{}, fmt.Errorf("no range in %q", text)
+	}
+	openMatch := clockPattern.FindStringSubmatch(strings.TrimSpace(open))
+	closeMatch := clockPattern.FindStringSubmatch(strings.TrimSpace(close))
+	if openMatch == nil || closeMatch == nil {
+		return Interval{}, fmt.Errorf("invalid range %q", text)
+	}
+	if openMatch[3] == "" {
+		openMatch[3] = closeMatch[3]
+	}
+
+	var interval Interval
+	var err error
+	if interval.Open, err = parseClock(openMatch); err != nil {
+		return Interval{}, err
+	}
+	if interval.Close, err = parseClock(closeMatch); err != nil {
+		return Interval{}, err
+	}
+	return interval, nil
+}
+
+// parseClock converts the groups matched by clockPattern to a Clock
+func parseClock(match []string) (Clock, error) {
+	hour, _ := strconv.Atoi(match[1])
+	minute := 0
+	if match[2] != "" {
+		minute, _ = strconv.Atoi(match[2])
+	}
+	switch match[3] {
+	case "am", "pm":
+		if hour < 1 || hour > 12 {
+			return 0, fmt.Errorf("invalid hour %q", match[0])
+		}
+		hour %= 12
+		if match[3] == "pm" {
+			hour += 12
+		}
+	default:
+		// "24:00" closes at midnight in 24 hour locales
+		if hour == 24 && minute == 0 {
+			hour = 0
+		}
+	}
+	if hour > 23 || minute > 59 {
+		return 0, fmt.Errorf("invalid time %q", match[0])
+	}
+	return Clock(hour*60 + minute), nil
+}
+
+// OpenAt reports whether the place is open at the given time, read in the
+// place's time zone. Places are considered closed on days of unknown hours.
+func (s Schedule) OpenAt(t time.Time) bool {
+	now := Clock(t.Hour()*60 + t.Minute())
+
+	if today, ok := s.day(t.Weekday()); ok {
+		if today.Open24h {
+			return true
+		}
+		for _, interval := range today.Intervals {
+			if interval.Close > interval.Open {
+				if now >= interval.Open && now < interval.Close {
+					return true
+				}
+			} else if now >= interval.Open {
+				return true
+			}
+		}
+	}
+
+	// Intervals of the previous day that end after midnight
+	if yesterday, ok := s.day((t.Weekday() + 6) % 7); ok {
+		for _, interval := range yesterday.Intervals {
+			if interval.Close <= interval.Open && now < interval.Close {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// day returns the schedule of the weekday
+func (s Schedule) day(weekday time.Weekday) (DaySchedule, bool) {
+	for _, day := range s {
+		if time.Weekday(day.Day) == weekday {
+			return day, true
+		}
+	}
+	return DaySchedule{}, false
+}
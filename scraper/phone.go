@@ -0,0 +1,100 @@
+package scraper
+
+import (
+	"github.com/go-rod/rod"
+
+	"mapsscrap/phone"
+)
+
+const (
+	defaultRuleConfidence = 0.5 // Confidence of phone rules that do not set one
+	corroborationBonus    = 0.1 // Added for every other rule finding the same number
+)
+
+// PhoneMatch is a phone found on a place page, with the rule that found it,
+// the text it was read from and the confidence, between 0 and 1, that it is
+// the phone of the place.
+type PhoneMatch struct {
+	phone.Number
+	Source     string  `json:"source"`
+	Raw        string  `json:"raw"`
+	Confidence float64 `json:"confidence"`
+}
+
+// phoneCandidate is a value read by a phone rule
+type phoneCandidate struct {
+	rule Rule
+	raw  string
+}
+
+// FindPhone looks for the phone number on a place page with every rule of the
+// selector profile and returns the one with the highest confidence. Only
+// numbers valid in the numbering plan of the region, or with a country code,
+// are accepted. It returns an empty PhoneMatch when none is found.
+func FindPhone(page *rod.Page, profile *Profile, region string) PhoneMatch {
+	var candidates []phoneCandidate
+	for _, rule := range profile.Place.Fields[FieldPhone] {
+		elements, err := page.Elements(rule.Selector)
+		if err != nil {
+			continue
+		}
+		for _, element := range elements {
+			if raw := rule.value(element); raw != "" {
+				candidates = append(candidates, phoneCandidate{rule: rule, raw: raw})
+			}
+		}
+	}
+	return bestPhone(candidates, region)
+}
+
+// bestPhone scores the valid numbers of the candidates. The confidence of a
+// number is that of the most reliable rule that found it, plus
+// corroborationBonus for every other rule finding the same number, up to 1.
+func bestPhone(candidates []phoneCandidate, region string) PhoneMatch {
+	type score struct {
+		match PhoneMatch
+		rules map[string]bool
+	}
+	var scores []*score
+	byNumber := map[string]*score{}
+
+	for _, candidate := range candidates {
+		number, err := phone.Parse(candidate.raw, region)
+		if err != nil {
+			continue
+		}
+		confidence := candidate.rule.Confidence
+		if confidence == 0 {
+			confidence = defaultRuleConfidence
+		}
+
+		s, ok := byNumber[number.E164]
+		if !ok {
+			s = &score{rules: map[string]bool{}}
+			byNumber[number.E164] = s
+			scores = append(scores, s)
+		}
+		s.rules[candidate.rule.source()] = true
+		if confidence > s.match.Confidence {
+			s.match = PhoneMatch{Number: number, Source: candidate.rule.source(), Raw: candidate.raw, Confidence: confidence}
+		}
+	}
+
+	var best PhoneMatch
+	for _, s := range scores {
+		s.match.Confidence = min(1, s.match.Confidence+corroborationBonus*float64(len(s.rules)-1))
+		if s.match.Confidence > best.Confidence {
+			best = s.match
+		}
+	}
+	return best
+}
+
+// FindWhatsApp returns the first WhatsApp chat link of a place panel that
+// holds a valid number, or an empty string when there is none
+func FindWhatsApp(page *rod.Page, profile *Profile) string {
+	return extract(page, profile.Place.Fields[FieldWhatsApp], func(value string) bool {
+		_, err := phone.ParseWhatsAppURL(value)
+		return err == nil
+	})
+}
@@ -0,0 +1,97 @@
+// Package scraper reads places from Google Maps pages opened in a headless
+// browser: the result list of a search and the details, phone and reviews of
+// a place page.
+package scraper
+
+import (
+	"encoding/json"
+
+	"mapsscrap/geo"
+	"mapsscrap/phone"
+)
+
+// Place represents a business place with its details
+type Place struct {
+	Name        string     `json:"name"`
+	Address     string     `json:"address"`
+	Stars       float64    `json:"rating"`
+	Reviews     int        `json:"reviews"`
+	Coordinates geo.Point  `json:"location"`
+	Hours       string     `json:"hours,omitempty"`
+	Phone       string     `json:"phone,omitempty"` // National format when valid in the search region
+	PhoneE164   string     `json:"phone_e164,omitempty"`
+	PhoneType   phone.Type `json:"phone_type,omitempty"`
+	Website     string     `json:"website,omitempty"`
+	GoogleURL   string     `json:"google_url,omitempty"`
+	PlaceID     string     `json:"place_id,omitempty"` // Google feature ID parsed from GoogleURL
+	DistanceKm  float64    `json:"distance_km"`        // Distance from the search center
+
+	// Read from the place page by FetchDetails
+	Category    string     `json:"category,omitempty"`
+	PriceLevel  string     `json:"price_level,omitempty"`
+	PlusCode    string     `json:"plus_code,omitempty"`
+	Status      string     `json:"status,omitempty"`  // One of the Status constants, empty when details were not fetched
+	Claimed     *bool      `json:"claimed,omitempty"` // False when the page offers to claim the listing, nil when unknown
+	WeeklyHours []DayHours `json:"weekly_hours,omitempty"`
+	Schedule    Schedule   `json:"schedule,omitempty"` // WeeklyHours parsed into opening intervals
+}
+
+// Business status of a place
+const (
+	StatusOperational       = "operational"
+	StatusTemporarilyClosed = "temporarily_closed"
+	StatusPermanentlyClosed = "permanently_closed"
+)
+
+// DayHours are the opening hours of a day of the week as Google shows them,
+// e.g. {"lunes", "9 a.m.–6 p.m."}
+type DayHours struct {
+	Day   string `json:"day"`
+	Hours string `json:"hours"`
+}
+
+// Closed reports whether the place is temporarily or permanently closed
+func (p Place) Closed() bool {
+	return p.Status == StatusTemporarilyClosed || p.Status == StatusPermanentlyClosed
+}
+
+// SetPhone stores a validated phone number in the place
+func (p *Place) SetPhone(number phone.Number) {
+	p.Phone = number.National
+	p.PhoneE164 = number.E164
+	p.PhoneType = number.Type
+}
+
+// NormalizePhone validates the phone of the place with the numbering plan of
+// the region and writes it in national and E.164 formats. A phone that is not
+// valid is kept as it was read.
+func (p *Place) NormalizePhone(region string) {
+	if p.Phone == "" {
+		return
+	}
+	if number, err := phone.Parse(p.Phone, region); err == nil {
+		p.SetPhone(number)
+	}
+}
+
+// HasLocation reports whether the place's coordinates were found
+func (p Place) HasLocation() bool {
+	return p.Coordinates != geo.Point{}
+}
+
+// MarshalJSON writes the place with its location and distance only when its
+// location is known, so an unknown location is not read as 0,0
+func (p Place) MarshalJSON() ([]byte, error) {
+	// place has the fields of Place without its methods
+	type place Place
+	out := struct {
+		place
+		Coordinates *geo.Point `json:"location,omitempty"`
+		DistanceKm  *float64   `json:"distance_km,omitempty"`
+	}{place: place(p)}
+	if p.HasLocation() {
+		out.Coordinates = &p.Coordinates
+		out.DistanceKm = &p.DistanceKm
+	}
+	return json.Marshal(out)
+}
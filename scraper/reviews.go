@@ -0,0 +1,251 @@
+package scraper
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-rod/rod"
+	"github.com/go-rod/rod/lib/proto"
+
+	"mapsscrap/mapsurl"
+)
+
+// Sort orders of the reviews tab
+const (
+	SortRelevant = "relevant"
+	SortNewest   = "newest"
+	SortHighest  = "highest"
+	SortLowest   = "lowest"
+)
+
+// reviewScrollPause is the time given to the reviews list to load more
+// reviews after it is scrolled to the bottom
+const reviewScrollPause = time.Second
+
+// Review is a review of a place, linked to it by PlaceID
+type Review struct {
+	PlaceID       string `json:"place_id"`
+	PlaceName     string `json:"place_name,omitempty"`
+	ReviewID      string `json:"review_id,omitempty"`
+	Author        string `json:"author"`
+	Rating        int    `json:"rating"`
+	Date          string `json:"date"`                   // As shown by Google, e.g. "hace 2 semanas"
+	PublishedAt   string `json:"published_at,omitempty"` // Approximate date parsed from Date, as 2006-01-02
+	Text          string `json:"text,omitempty"`
+	Language      string `json:"language,omitempty"`
+	OwnerResponse string `json:"owner_response,omitempty"`
+	Photos        int    `json:"photos"`
+}
+
+// ReviewOptions select how many reviews are read and in which order
+type ReviewOptions struct {
+	Max  int    // Reviews read per place, 0 reads them all
+	Sort string // One of the Sort constants, empty keeps the order of the page
+}
+
+// FetchReviews opens the reviews tab of the place page, sorts the reviews and
+// scrolls the list until options.Max reviews are loaded or no more load.
+// Truncated review texts are expanded before they are read.
+func FetchReviews(page *rod.Page, place Place, profile *Profile, options ReviewOptions) ([]Review, error) {
+	if place.GoogleURL == "" {
+		return nil, fmt.Errorf("place %q has no Google Maps URL", place.Name)
+	}
+	selectors := profile.Reviews
+	if _, ok := selectors.Sort[options.Sort]; options.Sort != "" && !ok {
+		return nil, fmt.Errorf("unknown review sort order %q", options.Sort)
+	}
+
+	if err := page.Navigate(place.GoogleURL); err != nil {
+		return nil, fmt.Errorf("failed to navigate: %w", err)
+	}
+	if err := page.WaitStable(time.Second); err != nil {
+		return nil, fmt.Errorf("page did not load: %w", err)
+	}
+
+	if place.Name == "" {
+		place.Name = extract(page, profile.Place.Fields[FieldName], nil)
+	}
+	if place.PlaceID == "" {
+		place.PlaceID = mapsurl.FeatureID(place.GoogleURL)
+	}
+
+	// Places without reviews have no reviews tab
+	tab := firstElement(page, selectors.Tab)
+	if tab == nil {
+		return nil, fmt.Errorf("reviews tab not found")
+	}
+	if err := tab.Click(proto.InputMouseButtonLeft, 1); err != nil {
+		return nil, fmt.Errorf("failed to open reviews tab: %w", err)
+	}
+	if _, err := waitElement(page, selectors.List); err != nil {
+		return nil, fmt.Errorf("reviews list not found: %w", err)
+	}
+
+	if options.Sort != "" {
+		if err := sortReviews(page, selectors, options.Sort); err != nil {
+			return nil, err
+		}
+	}
+
+	// Sorting renders the list again
+	list, err := waitElement(page, selectors.List)
+	if err != nil {
+		return nil, fmt.Errorf("reviews list not found: %w", err)
+	}
+	items := scrollReviews(list, selectors, options.Max)
+
+	now := time.Now()
+	reviews := make([]Review, 0, len(items))
+	for _, item := range items {
+		review := ExtractReview(item, selectors, now)
+		review.PlaceID = place.PlaceID
+		review.PlaceName = place.Name
+		reviews = append(reviews, review)
+	}
+	return reviews, nil
+}
+
+// sortReviews picks the sort order in the sort menu of the reviews tab
+func sortReviews(page *rod.Page, selectors ReviewSelectors, order string) error {
+	button := firstElement(page, selectors.SortButton)
+	if button == nil {
+		return fmt.Errorf("reviews sort button not found")
+	}
+	if err := button.Click(proto.InputMouseButtonLeft, 1); err != nil {
+		return fmt.Errorf("failed to open reviews sort menu: %w", err)
+	}
+	option, err := waitElement(page, selectors.Sort[order])
+	if err != nil {
+		return fmt.Errorf("reviews sort option %q not found: %w", order, err)
+	}
+	if err := option.Click(proto.InputMouseButtonLeft, 1); err != nil {
+		return fmt.Errorf("failed to sort reviews: %w", err)
+	}
+	if err := page.WaitStable(time.Second); err != nil {
+		return fmt.Errorf("reviews did not load: %w", err)
+	}
+	return nil
+}
+
+// scrollReviews scrolls the reviews list to its bottom until max reviews are
+// listed, or the list stops growing, and returns the reviews listed
+func scrollReviews(list *rod.Element, selectors ReviewSelectors, max int) rod.Elements {
+	var items rod.Elements
+	for stalls := 0; stalls < 3; {
+		found := elementsOf(list, selectors.Item)
+		if max > 0 && len(found) >= max {
+			items = found[:max]
+			break
+		}
+		if len(found) == len(items) {
+			stalls++
+		} else {
+			stalls = 0
+		}
+		items = found
+
+		if _, err := list.Eval(`() => this.scrollTo(0, this.scrollHeight)`); err != nil {
+			break
+		}
+		time.Sleep(reviewScrollPause)
+	}
+
+	// Expand the truncated texts of the reviews kept
+	for _, item := range items {
+		for _, button := range elementsOf(item, selectors.More) {
+			button.Eval(`() => this.click()`)
+		}
+	}
+	return items
+}
+
+// ExtractReview reads the fields of a review element. Relative dates are
+// converted to approximate dates counting back from now.
+func ExtractReview(item *rod.Element, selectors ReviewSelectors, now time.Time) Review {
+	fields := selectors.Fields
+	review := Review{
+		ReviewID:      extract(item, fields[FieldReviewID], nil),
+		Author:        extract(item, fields[FieldAuthor], nil),
+		Date:          extract(item, fields[FieldDate], nil),
+		Text:          extract(item, fields[FieldText], nil),
+		Language:      extract(item, fields[FieldLanguage], nil),
+		OwnerResponse: extract(item, fields[FieldOwnerResponse], nil),
+		Photos:        len(elementsOf(item, selectors.Photo)),
+	}
+	review.Rating, _ = strconv.Atoi(extract(item, fields[FieldRating], nil))
+	if published, ok := ParseRelativeDate(review.Date, now); ok {
+		review.PublishedAt = published.Format("2006-01-02")
+	}
+	return review
+}
+
+// relativeDatePattern matches the relative dates of reviews in Spanish and
+// English, e.g. "hace 3 días", "hace un mes", "a week ago" or "2 years ago"
+var relativeDatePattern = regexp.MustCompile(`(?i)\b(un|una|an|a|\d+)\s+(\pL+)`)
+
+// ParseRelativeDate converts a relative review date to the date it refers to,
+// counting back from now
+func ParseRelativeDate(text string, now time.Time) (time.Time, bool) {
+	match := relativeDatePattern.FindStringSubmatch(strings.ToLower(text))
+	if match == nil {
+		return time.Time{}, false
+	}
+	count, err := strconv.Atoi(match[1])
+	if err != nil {
+		count = 1 // un, una, a, an
+	}
+
+	unit := match[2]
+	switch {
+	case strings.HasPrefix(unit, "seg"), strings.HasPrefix(unit, "sec"):
+		return now.Add(-time.Duration(count) * time.Second), true
+	case strings.HasPrefix(unit, "min"):
+		return now.Add(-time.Duration(count) * time.Minute), true
+	case strings.HasPrefix(unit, "hora"), strings.HasPrefix(unit, "hour"):
+		return now.Add(-time.Duration(count) * time.Hour), true
+	case strings.HasPrefix(unit, "día"), strings.HasPrefix(unit, "dia"), strings.HasPrefix(unit, "day"):
+		return now.AddDate(0, 0, -count), true
+	case strings.HasPrefix(unit, "semana"), strings.HasPrefix(unit, "week"):
+		return now.AddDate(0, 0, -7*count), true
+	case strings.HasPrefix(unit, "mes"), strings.HasPrefix(unit, "month"):
+		return now.AddDate(0, -count, 0), true
+	case strings.HasPrefix(unit, "año"), strings.HasPrefix(unit, "ano"), strings.HasPrefix(unit, "year"):
+		return now.AddDate(-count, 0, 0), true
+	}
+	return time.Time{}, false
+}
+
+// firstElement returns the first element matching one of the selectors, tried
+// in order, or nil when none matches
+func firstElement(root elementFinder, selectors []string) *rod.Element {
+	if elements := elementsOf(root, selectors); len(elements) > 0 {
+		return elements[0]
+	}
+	return nil
+}
+
+// elementsOf returns the elements matching the first of the selectors that
+// matches any
+func elementsOf(root elementFinder, selectors []string) rod.Elements {
+	for _, selector := range selectors {
+		if elements, err := root.Elements(selector); err == nil && len(elements) > 0 {
+			return elements
+		}
+	}
+	return nil
+}
+
+// waitElement waits for whichever of the selectors matches first
+func waitElement(page *rod.Page, selectors []string) (*rod.Element, error) {
+	if len(selectors) == 0 {
+		return nil, fmt.Errorf("no selectors")
+	}
+	race := page.Race()
+	for _, selector := range selectors {
+		race = race.Element(selector)
+	}
+	return race.Do()
+}
@@ -0,0 +1,440 @@
+package scraper
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/go-rod/rod"
+	"github.com/go-rod/rod/lib/launcher"
+
+	"mapsscrap/browserpool"
+	"mapsscrap/fixtures"
+	"mapsscrap/geo"
+	"mapsscrap/phone"
+)
+
+// newFixturePage starts the fixture server and opens a page in a local
+// Chrome. The test is skipped when no browser is installed.
+func newFixturePage(t *testing.T) (*rod.Page, string) {
+	t.Helper()
+
+	bin, found := launcher.LookPath()
+	if !found {
+		t.Skip("no Chrome or Chromium installed")
+	}
+
+	server := httptest.NewServer(fixtures.Handler())
+	t.Cleanup(server.Close)
+
+	pool := browserpool.New(browserpool.Options{Browsers: 1, PagesPerBrowser: 1, Bin: bin})
+	t.Cleanup(pool.Close)
+
+	page, err := pool.Acquire(context.Background())
+	if err != nil {
+		t.Fatalf("failed to open page: %v", err)
+	}
+	t.Cleanup(func() { pool.Release(page) })
+
+	return page.Timeout(time.Minute), server.URL + "/maps"
+}
+
+func TestSearch(t *testing.T) {
+	page, baseURL := newFixturePage(t)
+
+	places, err := Search(page, SearchURL(baseURL, "abogado", geo.Point{Lat: 19.43, Lon: -99.15}, 15), DefaultProfile())
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+
+	// Two of the five results are only loaded after scrolling the list
+	if len(places) != 5 {
+		t.Fatalf("got %d places, want 5", len(places))
+	}
+
+	got := places[0]
+	want := Place{
+		Name:        "Bufete Jurídico Reforma",
+		Address:     "Paseo de la Reforma 222",
+		Stars:       4.8,
+		Reviews:     231,
+		Coordinates: geo.Point{Lat: 19.42847, Lon: -99.16766},
+		Hours:       "Abierto",
+		Phone:       "55 5208 1234",
+		Website:     "https://bufetereforma.example.mx/",
+		PlaceID:     "0x85d1ff35f5bd1563:0x6c366f0e2de02ff7",
+	}
+	got.GoogleURL = ""
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("first place\n got %+v\nwant %+v", got, want)
+	}
+
+	// Fields missing from a card stay empty
+	if places[2].Hours != "" || places[2].Phone != "" || places[2].Website != "" {
+		t.Errorf("unexpected details for %q: %+v", places[2].Name, places[2])
+	}
+
+	for _, place := range places {
+		if place.Name == "" || place.Address == "" || place.Stars == 0 || place.Reviews == 0 {
+			t.Errorf("incomplete place %+v", place)
+		}
+		if place.PlaceID == "" || !place.HasLocation() {
+			t.Errorf("place %q without ID or location in %q", place.Name, place.GoogleURL)
+		}
+	}
+}
+
+func TestFindPhone(t *testing.T) {
+	page, baseURL := newFixturePage(t)
+
+	if err := page.Navigate(baseURL + "/place/Bufete+Jur%C3%ADdico+Reforma/data=!4m7!3m6!1s0x85d1ff35f5bd1563:0x6c366f0e2de02ff7"); err != nil {
+		t.Fatalf("failed to navigate: %v", err)
+	}
+	if err := page.WaitLoad(); err != nil {
+		t.Fatalf("page did not load: %v", err)
+	}
+
+	// Every phone rule of the default profile finds the number
+	want := PhoneMatch{
+		Number:     phone.Number{E164: "+525552081234", National: "55 5208 1234", Region: "MX", Type: phone.Unknown},
+		Source:     "button[data-item-id*='phone']@data-item-id",
+		Raw:        "+525552081234",
+		Confidence: 1,
+	}
+	if match := FindPhone(page, DefaultProfile(), "MX"); match != want {
+		t.Errorf("FindPhone() = %+v, want %+v", match, want)
+	}
+	if link := FindWhatsApp(page, DefaultProfile()); link != "https://wa.me/5215552081234" {
+		t.Errorf("FindWhatsApp() = %q, want the wa.me link of the panel", link)
+	}
+}
+
+func TestBestPhone(t *testing.T) {
+	tel := Rule{Selector: "button", Attribute: "data-item-id", Confidence: 0.95}
+	label := Rule{Selector: "button", Attribute: "aria-label", Confidence: 0.8}
+	generic := Rule{Selector: "div", Confidence: 0.4}
+	unscored := Rule{Selector: "span"}
+
+	tests := []struct {
+		name       string
+		candidates []phoneCandidate
+		source     string
+		e164       string
+		confidence float64
+	}{
+		{"none", nil, "", "", 0},
+		{"invalid", []phoneCandidate{{generic, "06600"}}, "", "", 0},
+		{"generic only", []phoneCandidate{{generic, "55 1234 5678"}}, "div", "+525512345678", 0.4},
+		{"default confidence", []phoneCandidate{{unscored, "55 1234 5678"}}, "span", "+525512345678", defaultRuleConfidence},
+		{"most reliable rule wins", []phoneCandidate{
+			{generic, "55 1234 5678"},
+			{tel, "+525552081234"},
+		}, "button@data-item-id", "+525552081234", 0.95},
+		{"agreeing rules", []phoneCandidate{
+			{generic, "55 5208 1234"},
+			{label, "55 5208 1234"},
+			{label, "(55) 5208-1234"},
+		}, "button@aria-label", "+525552081234", 0.9},
+		{"corroborated generic number", []phoneCandidate{
+			{label, "33 1234 5678"},
+			{generic, "55 5208 1234"},
+			{unscored, "55 5208 1234"},
+			{Rule{Selector: "a", Confidence: 0.3}, "55 5208 1234"},
+		}, "button@aria-label", "+523312345678", 0.8},
+	}
+	for _, tt := range tests {
+		match := bestPhone(tt.candidates, "MX")
+		if match.Source != tt.source || match.E164 != tt.e164 || math.Abs(match.Confidence-tt.confidence) > 1e-9 {
+			t.Errorf("%s: bestPhone() = %+v, want %s from %s with confidence %.2f", tt.name, match, tt.e164, tt.source, tt.confidence)
+		}
+	}
+}
+
+func TestFetchDetails(t *testing.T) {
+	page, baseURL := newFixturePage(t)
+
+	place := Place{
+		Name:      "Bufete Jurídico Reforma",
+		GoogleURL: baseURL + "/place/Bufete+Jur%C3%ADdico+Reforma/data=!4m7!3m6!1s0x85d1ff35f5bd1563:0x6c366f0e2de02ff7",
+	}
+	got, err := FetchDetails(page, place, DefaultProfile(), "MX")
+	if err != nil {
+		t.Fatalf("FetchDetails failed: %v", err)
+	}
+
+	if got.Category != "Abogado" || got.PriceLevel != "$$$" || got.PlusCode != "CR9J+9W Ciudad de México, CDMX" {
+		t.Errorf("category, price level or plus code not read: %+v", got)
+	}
+	if got.Status != StatusOperational {
+		t.Errorf("status not read: %+v", got)
+	}
+	// The fixture has no claim link, which does not prove the listing is claimed
+	if got.Claimed != nil {
+		t.Errorf("claimed = %v without a claim link, want unknown", *got.Claimed)
+	}
+	if got.Phone != "55 5208 1234" || got.PhoneE164 != "+525552081234" || got.Website != "https://bufetereforma.example.mx/" {
+		t.Errorf("phone or website not taken from the page: %+v", got)
+	}
+	if len(got.WeeklyHours) != 7 || got.WeeklyHours[0] != (DayHours{"lunes", "9 a.m.–7 p.m."}) || got.WeeklyHours[6] != (DayHours{"domingo", "Cerrado"}) {
+		t.Errorf("weekly hours = %+v", got.WeeklyHours)
+	}
+	if len(got.Schedule) != 7 || !got.Schedule[6].Closed {
+		t.Errorf("schedule = %+v", got.Schedule)
+	}
+}
+
+func TestFetchReviews(t *testing.T) {
+	page, baseURL := newFixturePage(t)
+
+	place := Place{
+		GoogleURL: baseURL + "/place/Bufete+Jur%C3%ADdico+Reforma/data=!4m7!3m6!1s0x85d1ff35f5bd1563:0x6c366f0e2de02ff7",
+	}
+	reviews, err := FetchReviews(page, place, DefaultProfile(), ReviewOptions{Max: 4, Sort: SortNewest})
+	if err != nil {
+		t.Fatalf("FetchReviews failed: %v", err)
+	}
+
+	// Three reviews are loaded sorted by date, the fourth when the list is scrolled
+	authors := []string{}
+	for _, review := range reviews {
+		authors = append(authors, review.Author)
+		if review.PlaceID != "0x85d1ff35f5bd1563:0x6c366f0e2de02ff7" || review.PlaceName != "Bufete Jurídico Reforma" {
+			t.Errorf("review of %s not linked to the place: %+v", review.Author, review)
+		}
+		if review.ReviewID == "" || review.PublishedAt == "" {
+			t.Errorf("review of %s has no ID or date: %+v", review.Author, review)
+		}
+	}
+	if want := []string{"Carlos Méndez", "Mariana López", "John Carter", "Lucía Hernández"}; !reflect.DeepEqual(authors, want) {
+		t.Fatalf("authors = %v, want %v", authors, want)
+	}
+
+	if got := reviews[0]; got.Rating != 1 || got.Date != "hace 3 días" || got.OwnerResponse != "Lamentamos su experiencia, lo contactaremos hoy mismo." {
+		t.Errorf("first review = %+v", got)
+	}
+	if got := reviews[1]; got.Text != "Excelente atención, resolvieron mi caso de arrendamiento en tres semanas y siempre contestaron el teléfono." || got.Photos != 2 {
+		t.Errorf("truncated text not expanded or photos not counted: %+v", got)
+	}
+	if got := reviews[2]; got.Language != "en" || got.Rating != 4 {
+		t.Errorf("third review = %+v", got)
+	}
+}
+
+func TestParseRelativeDate(t *testing.T) {
+	now := time.Date(2025, 8, 4, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"hace 3 días", "2025-08-01"},
+		{"hace un mes", "2025-07-04"},
+		{"Editado hace 2 semanas", "2025-07-21"},
+		{"hace un año", "2024-08-04"},
+		{"a week ago", "2025-07-28"},
+		{"5 months ago", "2025-03-04"},
+		{"an hour ago", "2025-08-04"},
+	}
+	for _, tt := range tests {
+		got, ok := ParseRelativeDate(tt.text, now)
+		if !ok || got.Format("2006-01-02") != tt.want {
+			t.Errorf("ParseRelativeDate(%q) = %s, %v, want %s", tt.text, got.Format("2006-01-02"), ok, tt.want)
+		}
+	}
+	if _, ok := ParseRelativeDate("ayer", now); ok {
+		t.Error("expected no date for an unknown format")
+	}
+}
+
+func TestSearchURL(t *testing.T) {
+	got := SearchURL("https://www.google.com/maps/", "dentista infantil", geo.Point{Lat: 19.4343491, Lon: -99.1775742}, 15)
+	want := "https://www.google.com/maps/search/dentista%20infantil/@19.434349,-99.177574,15z"
+	if got != want {
+		t.Errorf("SearchURL() = %q, want %q", got, want)
+	}
+}
+
+func TestParseProfile(t *testing.T) {
+	profile, err := ParseProfile([]byte(`{
+		"version": "hotfix",
+		"search": {"fields": {"name": [{"selector": "h3.newName"}]}}
+	}`))
+	if err != nil {
+		t.Fatalf("ParseProfile failed: %v", err)
+	}
+
+	if profile.Version != "hotfix" {
+		t.Errorf("version = %q, want %q", profile.Version, "hotfix")
+	}
+	if rules := profile.Search.Fields[FieldName]; len(rules) != 1 || rules[0].Selector != "h3.newName" {
+		t.Errorf("name rules = %+v, want the rule of the file", rules)
+	}
+	// Fields missing from the file keep the built-in rules
+	if len(profile.Search.Fields[FieldWebsite]) == 0 || len(profile.Place.Fields[FieldPhone]) == 0 {
+		t.Errorf("default rules were dropped: %+v", profile)
+	}
+
+	if _, err := ParseProfile([]byte(`{"search": {"fields": {"hours": [{"selector": "div", "regex": "("}]}}}`)); err == nil {
+		t.Error("expected an error for an invalid regex")
+	}
+	if _, err := ParseProfile([]byte(`{"search": {"list": []}}`)); err == nil {
+		t.Error("expected an error for a profile without list selectors")
+	}
+	if _, err := ParseProfile([]byte(`{"place": {"fields": {"phone": [{"selector": "div", "confidence": 2}]}}}`)); err == nil {
+		t.Error("expected an error for a confidence above 1")
+	}
+}
+
+func TestPlaceJSON(t *testing.T) {
+	// A place at the search center keeps its zero distance
+	data, err := json.Marshal(Place{Name: "Centro", Coordinates: geo.Point{Lat: 19.43, Lon: -99.15}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fields map[string]any
+	if err := json.Unmarshal(data, &fields); err != nil {
+		t.Fatal(err)
+	}
+	if fields["distance_km"] != 0.0 || fields["location"] == nil {
+		t.Errorf("place with a location encoded as %s", data)
+	}
+	var place Place
+	if err := json.Unmarshal(data, &place); err != nil || place.Coordinates.Lat != 19.43 {
+		t.Errorf("place read back as %+v, %v", place, err)
+	}
+
+	// An unknown location is left out instead of being written as 0,0
+	data, err = json.Marshal(Place{Name: "Sin ubicación", DistanceKm: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fields = nil
+	if err := json.Unmarshal(data, &fields); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := fields["location"]; ok {
+		t.Errorf("place without a location encoded as %s", data)
+	}
+	if _, ok := fields["distance_km"]; ok {
+		t.Errorf("place without a location encoded as %s", data)
+	}
+}
+
+func TestNormalizePhone(t *testing.T) {
+	place := Place{Phone: "(55) 5208-1234"}
+	place.NormalizePhone("MX")
+	if place.Phone != "55 5208 1234" || place.PhoneE164 != "+525552081234" || place.PhoneType != phone.Unknown {
+		t.Errorf("phone not normalized: %+v", place)
+	}
+
+	// Numbers not valid in the region are kept as read
+	place = Place{Phone: "555 0100"}
+	place.NormalizePhone("US")
+	if place.Phone != "555 0100" || place.PhoneE164 != "" {
+		t.Errorf("invalid phone changed: %+v", place)
+	}
+}
+
+func TestParseDayHours(t *testing.T) {
+	tests := []struct {
+		day  DayHours
+		want DaySchedule
+	}{
+		{DayHours{"lunes", "9 a.m.–7 p.m."}, DaySchedule{Day: Weekday(time.Monday), Intervals: []Interval{{9 * 60, 19 * 60}}}},
+		{DayHours{"martes", "9 a.m.–2 p.m., 4–8 p.m."}, DaySchedule{Day: Weekday(time.Tuesday), Intervals: []Interval{{9 * 60, 14 * 60}, {16 * 60, 20 * 60}}}},
+		{DayHours{"miércoles", "12:30–11:30 p.m."}, DaySchedule{Day: Weekday(time.Wednesday), Intervals: []Interval{{12*60 + 30, 23*60 + 30}}}},
+		{DayHours{"jueves (Día de la Independencia)", "9:00–24:00"}, DaySchedule{Day: Weekday(time.Thursday), Intervals: []Interval{{9 * 60, 0}}}},
+		{DayHours{"sábado", "Abierto las 24 horas"}, DaySchedule{Day: Weekday(time.Saturday), Open24h: true}},
+		{DayHours{"domingo", "Cerrado"}, DaySchedule{Day: Weekday(time.Sunday), Closed: true}},
+		{DayHours{"Friday", "11\u202fAM–2:30\u202fPM, 5\u202fPM–2\u202fAM"}, DaySchedule{Day: Weekday(time.Friday), Intervals: []Interval{{11 * 60, 14*60 + 30}, {17 * 60, 2 * 60}}}},
+		{DayHours{"Sunday", "Open 24 hours"}, DaySchedule{Day: Weekday(time.Sunday), Open24h: true}},
+		{DayHours{"Monday", "Closed"}, DaySchedule{Day: Weekday(time.Monday), Closed: true}},
+	}
+	for _, tt := range tests {
+		got, err := ParseDayHours(tt.day)
+		if err != nil {
+			t.Errorf("ParseDayHours(%v) failed: %v", tt.day, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseDayHours(%v) = %+v, want %+v", tt.day, got, tt.want)
+		}
+	}
+
+	if _, err := ParseDayHours(DayHours{"lunes", "Los horarios pueden variar"}); err == nil {
+		t.Error("expected an error for hours without a range")
+	}
+}
+
+func TestScheduleOpenAt(t *testing.T) {
+	schedule := ParseSchedule([]DayHours{
+		{"Monday", "9 AM–2 PM, 4–8 PM"},
+		{"Friday", "6 PM–2 AM"},
+		{"Saturday", "Closed"},
+		{"Sunday", "Open 24 hours"},
+	})
+
+	// 2025-08-04 is a Monday
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2025, 8, day, hour, minute, 0, 0, time.UTC)
+	}
+	tests := []struct {
+		at   time.Time
+		want bool
+	}{
+		{at(4, 9, 0), true},
+		{at(4, 14, 0), false}, // closing time is exclusive
+		{at(4, 15, 0), false},
+		{at(4, 19, 59), true},
+		{at(8, 23, 0), true},  // Friday evening
+		{at(9, 1, 30), true},  // Friday's interval after midnight
+		{at(9, 12, 0), false}, // Saturday
+		{at(10, 3, 0), true},  // Sunday
+		{at(5, 10, 0), false}, // Tuesday is unknown
+	}
+	for _, tt := range tests {
+		if got := schedule.OpenAt(tt.at); got != tt.want {
+			t.Errorf("OpenAt(%s) = %v, want %v", tt.at.Format("Mon 15:04"), got, tt.want)
+		}
+	}
+}
+
+func TestHealthCheckEvaluate(t *testing.T) {
+	check := DefaultHealthCheck()
+	check.MinResults = 2
+
+	complete := Place{
+		Name:      "Bufete Jurídico Reforma",
+		Address:   "Paseo de la Reforma 222",
+		Stars:     4.8,
+		Reviews:   231,
+		Phone:     "55 5208 1234",
+		Website:   "https://bufetereforma.example.mx/",
+		GoogleURL: "https://www.google.com/maps/place/Bufete",
+	}
+
+	report := check.Evaluate([]Place{complete, complete})
+	if !report.Healthy {
+		t.Errorf("complete places reported as degraded:\n%s", report)
+	}
+
+	// Names still match but the address selector broke
+	broken := complete
+	broken.Address = ""
+	report = check.Evaluate([]Place{complete, broken})
+	if report.Healthy {
+		t.Errorf("missing addresses not detected:\n%s", report)
+	}
+	for _, field := range report.Fields {
+		if want := field.Field != FieldAddress; field.OK != want {
+			t.Errorf("field %s ok = %v, want %v", field.Field, field.OK, want)
+		}
+	}
+
+	if report := check.Evaluate(nil); report.Healthy {
+		t.Error("no results reported as healthy")
+	}
+}
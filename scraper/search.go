@@ -0,0 +1,122 @@
+package scraper
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-rod/rod"
+	"github.com/go-rod/rod/lib/proto"
+
+	"mapsscrap/geo"
+	"mapsscrap/mapsurl"
+)
+
+// DefaultBaseURL is the Google Maps URL searches are made against. Tests point
+// the scraper to a fixture server instead.
+const DefaultBaseURL = "https://www.google.com/maps"
+
+// SearchURL returns the URL of a search for query with the map centered on
+// center at the given zoom level.
+func SearchURL(baseURL string, query string, center geo.Point, zoom int) string {
+	return fmt.Sprintf("%s/search/%s/@%f,%f,%dz",
+		strings.TrimSuffix(baseURL, "/"),
+		url.PathEscape(query),
+		center.Lat,
+		center.Lon,
+		zoom,
+	)
+}
+
+// Search opens the search URL in the page, scrolls the result list so that
+// more results are loaded and returns the places listed.
+// It maps HTML elements to relevant fields using the selector profile.
+func Search(page *rod.Page, searchURL string, profile *Profile) ([]Place, error) {
+	if err := page.Navigate(searchURL); err != nil {
+		return nil, fmt.Errorf("failed to navigate: %w", err)
+	}
+
+	if err := page.WaitStable(time.Second); err != nil {
+		return nil, fmt.Errorf("page did not load: %w", err)
+	}
+
+	places := []Place{}
+
+	// Wait for whichever list selector matches first
+	race := page.Race()
+	for _, selector := range profile.Search.List {
+		race = race.Element(selector)
+	}
+	container, err := race.Do()
+	if err != nil {
+		return nil, fmt.Errorf("result list not found: %w", err)
+	}
+	if err := container.WaitVisible(); err != nil {
+		return nil, fmt.Errorf("result list not visible: %w", err)
+	}
+
+	// move mouse pointer to list which is first third of screen and scroll
+	for i := 0; i < 10; i++ { // 10
+		page.Mouse.MoveTo(proto.Point{X: 250, Y: 300})
+		page.Mouse.Scroll(0.0, 6000.0, 30)
+		// page.Mouse.Scroll(0.0, 1000.0, 5)
+		select {
+		case <-time.After(500 * time.Millisecond):
+		case <-page.GetContext().Done():
+			return nil, fmt.Errorf("result list not loaded: %w", page.GetContext().Err())
+		}
+	}
+
+	var placeElements rod.Elements
+	for _, selector := range profile.Search.Item {
+		placeElements, err = container.Elements(selector)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list results: %w", err)
+		}
+		if len(placeElements) > 0 {
+			break
+		}
+	}
+
+	for _, element := range placeElements {
+		place := ExtractPlace(element, profile)
+		if place.Name != "" {
+			places = append(places, place)
+		}
+	}
+
+	return places, nil
+}
+
+// ExtractPlace extracts details of a place from the given element
+// It retrieves the name, address, rating, reviews, phone number, opening hours, website
+// and location from the Google Maps search result element.
+func ExtractPlace(element *rod.Element, profile *Profile) Place {
+	fields := profile.Search.Fields
+	place := Place{
+		Name:      extract(element, fields[FieldName], nil),
+		Address:   extract(element, fields[FieldAddress], nil),
+		Hours:     extract(element, fields[FieldHours], nil),
+		Phone:     extract(element, fields[FieldPhone], nil),
+		Website:   extract(element, fields[FieldWebsite], nil),
+		GoogleURL: extract(element, fields[FieldGoogleURL], nil),
+	}
+
+	// Ratings use a decimal comma in some locales, review counts a thousands separator
+	if rating := extract(element, fields[FieldRating], nil); rating != "" {
+		fmt.Sscanf(strings.Replace(rating, ",", ".", 1), "%f", &place.Stars)
+	}
+	if reviews := extract(element, fields[FieldReviews], nil); reviews != "" {
+		fmt.Sscanf(strings.NewReplacer(",", "", ".", "", "\u00a0", "").Replace(reviews), "%d", &place.Reviews)
+	}
+
+	if place.GoogleURL != "" {
+		place.PlaceID = mapsurl.FeatureID(place.GoogleURL)
+		if location, ok := mapsurl.Location(place.GoogleURL); ok {
+			place.Coordinates = location
+		}
+	}
+
+	return place
+}
@@ -0,0 +1,233 @@
+package scraper
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/go-rod/rod"
+)
+
+// defaultProfileJSON is the selector profile matching the Google Maps markup
+// at the time of the last release
+//
+//go:embed selectors.json
+var defaultProfileJSON []byte
+
+// Field names used in selector profiles
+const (
+	FieldName      = "name"
+	FieldRating    = "rating"
+	FieldReviews   = "reviews"
+	FieldAddress   = "address"
+	FieldHours     = "hours"
+	FieldPhone     = "phone"
+	FieldWebsite   = "website"
+	FieldGoogleURL = "google_url"
+	FieldCategory  = "category"
+	FieldPrice     = "price_level"
+	FieldPlusCode  = "plus_code"
+	FieldStatus    = "status"
+	FieldClaimLink = "claim_link" // Only shown while the owner has not claimed the place
+	FieldWhatsApp  = "whatsapp"   // wa.me and api.whatsapp.com chat links of the place panel
+
+	FieldReviewID      = "review_id"
+	FieldAuthor        = "author"
+	FieldDate          = "date"
+	FieldText          = "text"
+	FieldLanguage      = "language"
+	FieldOwnerResponse = "owner_response"
+)
+
+// Profile holds the CSS selectors used to read Google Maps pages. Google
+// renames its obfuscated classes every few months; a profile file lets a
+// broken selector be fixed without rebuilding the scraper.
+type Profile struct {
+	Version string          `json:"version"`
+	Search  SearchSelectors `json:"search"`
+	Place   PlaceSelectors  `json:"place"`
+	Reviews ReviewSelectors `json:"reviews"`
+}
+
+// SearchSelectors locate the result list of a search and the fields of each
+// result card. List and Item are tried in order until one matches.
+type SearchSelectors struct {
+	List   []string          `json:"list"`
+	Item   []string          `json:"item"`
+	Fields map[string][]Rule `json:"fields"`
+}
+
+// PlaceSelectors locate the fields of a place page
+type PlaceSelectors struct {
+	Fields      map[string][]Rule `json:"fields"`
+	WeeklyHours HoursSelectors    `json:"weekly_hours"`
+}
+
+// HoursSelectors locate the rows of the opening hours table of a place page.
+// The Day and Time rules are applied to each row.
+type HoursSelectors struct {
+	Row  []string `json:"row"`
+	Day  []Rule   `json:"day"`
+	Time []Rule   `json:"time"`
+}
+
+// ReviewSelectors locate the reviews tab of a place page, its sort menu and
+// the fields of each review. Sort maps a sort order to its menu option.
+type ReviewSelectors struct {
+	Tab        []string            `json:"tab"`
+	SortButton []string            `json:"sort_button"`
+	Sort       map[string][]string `json:"sort"`
+	List       []string            `json:"list"`
+	Item       []string            `json:"item"`
+	More       []string            `json:"more"`  // Buttons expanding truncated review texts
+	Photo      []string            `json:"photo"` // Photos attached to a review, counted
+	Fields     map[string][]Rule   `json:"fields"`
+}
+
+// Rule extracts a value from the elements matching Selector. The value is the
+// element's text, or the given attribute. With Regex, the value is its first
+// capture group (or whole match) and elements that do not match are skipped.
+// Confidence, between 0 and 1, is how reliable the values of the rule are;
+// only phone rules use it.
+type Rule struct {
+	Selector   string  `json:"selector"`
+	Attribute  string  `json:"attribute,omitempty"`
+	Regex      string  `json:"regex,omitempty"`
+	Confidence float64 `json:"confidence,omitempty"`
+
+	regex *regexp.Regexp
+}
+
+// DefaultProfile returns the selector profile built into the scraper
+func DefaultProfile() *Profile {
+	profile, err := ParseProfile(nil)
+	if err != nil {
+		panic(fmt.Sprintf("invalid built-in selector profile: %v", err))
+	}
+	return profile
+}
+
+// LoadProfile reads a selector profile file. An empty path returns the
+// default profile.
+func LoadProfile(path string) (*Profile, error) {
+	if path == "" {
+		return DefaultProfile(), nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read selector profile: %w", err)
+	}
+	profile, err := ParseProfile(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return profile, nil
+}
+
+// ParseProfile parses a JSON selector profile on top of the default one, so a
+// file only needs the fields it changes. Fields it lists replace all the
+// default rules of that field.
+func ParseProfile(data []byte) (*Profile, error) {
+	profile := &Profile{}
+	if err := json.Unmarshal(defaultProfileJSON, profile); err != nil {
+		return nil, fmt.Errorf("invalid selector profile: %w", err)
+	}
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, profile); err != nil {
+			return nil, fmt.Errorf("invalid selector profile: %w", err)
+		}
+	}
+
+	if len(profile.Search.List) == 0 || len(profile.Search.Item) == 0 {
+		return nil, fmt.Errorf("selector profile needs search list and item selectors")
+	}
+	hours := map[string][]Rule{
+		"weekly_hours.day":  profile.Place.WeeklyHours.Day,
+		"weekly_hours.time": profile.Place.WeeklyHours.Time,
+	}
+	for _, fields := range []map[string][]Rule{profile.Search.Fields, profile.Place.Fields, hours, profile.Reviews.Fields} {
+		for name, rules := range fields {
+			for i := range rules {
+				if rules[i].Selector == "" {
+					return nil, fmt.Errorf("rule %d of field %q has no selector", i+1, name)
+				}
+				if rules[i].Confidence < 0 || rules[i].Confidence > 1 {
+					return nil, fmt.Errorf("rule %d of field %q has a confidence outside 0 to 1", i+1, name)
+				}
+				if rules[i].Regex == "" {
+					continue
+				}
+				regex, err := regexp.Compile(rules[i].Regex)
+				if err != nil {
+					return nil, fmt.Errorf("rule %d of field %q: %w", i+1, name, err)
+				}
+				rules[i].regex = regex
+			}
+		}
+	}
+	return profile, nil
+}
+
+// elementFinder is a page or an element whose descendants can be searched
+type elementFinder interface {
+	Elements(selector string) (rod.Elements, error)
+}
+
+// extract returns the first non empty value the rules of the field find in
+// root. Values rejected by accept are skipped; accept may be nil.
+func extract(root elementFinder, rules []Rule, accept func(string) bool) string {
+	for _, rule := range rules {
+		elements, err := root.Elements(rule.Selector)
+		if err != nil {
+			continue
+		}
+		for _, element := range elements {
+			value := rule.value(element)
+			if value != "" && (accept == nil || accept(value)) {
+				return value
+			}
+		}
+	}
+	return ""
+}
+
+// source describes the rule in the provenance of the values it reads
+func (r Rule) source() string {
+	if r.Attribute != "" {
+		return r.Selector + "@" + r.Attribute
+	}
+	return r.Selector
+}
+
+// value reads the rule's text or attribute from the element and applies its regex
+func (r Rule) value(element *rod.Element) string {
+	var value string
+	if r.Attribute != "" {
+		attribute, err := element.Attribute(r.Attribute)
+		if err != nil || attribute == nil {
+			return ""
+		}
+		value = *attribute
+	} else {
+		text, err := element.Text()
+		if err != nil {
+			return ""
+		}
+		value = text
+	}
+
+	if r.regex != nil {
+		match := r.regex.FindStringSubmatch(value)
+		if match == nil {
+			return ""
+		}
+		value = match[0]
+		if len(match) > 1 {
+			value = match[1]
+		}
+	}
+	return strings.TrimSpace(value)
+}
@@ -39,20 +39,7 @@ fi
 log "📦 Verificando dependencias..."
 go mod tidy
 
-# Compilar binarios necesarios si no existen
-if [ ! -f "mapsscrap-1" ]; then
-    log "🔨 Compilando mapsscrap-1..."
-    go build -o mapsscrap-1 main.go
-    success "mapsscrap-1 compilado exitosamente"
-fi
-
-if [ ! -f "phone_scraper" ]; then
-    log "🔨 Compilando phone_scraper..."
-    go build -o phone_scraper enhanced_phone_scraper.go
-    success "phone_scraper compilado exitosamente"
-fi
-
-# Compilar y ejecutar servidor web
+# Compilar y ejecutar servidor web, que ejecuta el pipeline sin otros binarios
 log "🚀 Compilando y ejecutando servidor web..."
 go build -o web_server web_server.go
 
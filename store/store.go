@@ -0,0 +1,301 @@
+// Package store keeps the results of every scraping run in a SQLite database
+// so places can be followed across runs: when they were first and last seen,
+// which runs found them and how their rating evolved.
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+const schema = `
+CREATE TABLE IF NOT EXISTS runs (
+	id          INTEGER PRIMARY KEY AUTOINCREMENT,
+	query       TEXT NOT NULL,
+	params      TEXT NOT NULL,
+	output_path TEXT NOT NULL,
+	started_at  TIMESTAMP NOT NULL,
+	finished_at TIMESTAMP NOT NULL,
+	place_count INTEGER NOT NULL,
+	new_count   INTEGER NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS places (
+	place_key     TEXT PRIMARY KEY,
+	name_key      TEXT NOT NULL DEFAULT '',
+	place_id      TEXT NOT NULL,
+	name          TEXT NOT NULL,
+	address       TEXT NOT NULL,
+	phone         TEXT NOT NULL,
+	website       TEXT NOT NULL,
+	hours         TEXT NOT NULL,
+	google_url    TEXT NOT NULL,
+	latitude      REAL,
+	longitude     REAL,
+	rating        REAL NOT NULL,
+	reviews       INTEGER NOT NULL,
+	first_seen    TIMESTAMP NOT NULL,
+	last_seen     TIMESTAMP NOT NULL,
+	first_run_id  INTEGER NOT NULL REFERENCES runs(id),
+	last_run_id   INTEGER NOT NULL REFERENCES runs(id)
+);
+
+CREATE TABLE IF NOT EXISTS run_places (
+	run_id    INTEGER NOT NULL REFERENCES runs(id),
+	place_key TEXT NOT NULL REFERENCES places(place_key),
+	PRIMARY KEY (run_id, place_key)
+);
+
+CREATE TABLE IF NOT EXISTS rating_history (
+	place_key   TEXT NOT NULL REFERENCES places(place_key),
+	run_id      INTEGER NOT NULL REFERENCES runs(id),
+	observed_at TIMESTAMP NOT NULL,
+	rating      REAL NOT NULL,
+	reviews     INTEGER NOT NULL,
+	PRIMARY KEY (place_key, run_id)
+);
+`
+
+// Place is a scraped place as stored in the database. Key identifies the place
+// across runs: its Google place ID when known, otherwise its name and address.
+// NameKey is always its name and address, so a place stored before its ID
+// was known is matched once a run finds its ID, and the other way round.
+type Place struct {
+	Key       string
+	NameKey   string
+	PlaceID   string
+	Name      string
+	Address   string
+	Phone     string
+	Website   string
+	Hours     string
+	GoogleURL string
+	Latitude  float64
+	Longitude float64
+	HasCoords bool
+	Rating    float64
+	Reviews   int
+}
+
+// Run describes a single execution of the scraper
+type Run struct {
+	ID         int64     `json:"id"`
+	Query      string    `json:"query"`
+	Params     string    `json:"params"` // Search parameters as JSON
+	OutputPath string    `json:"output_path"`
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	PlaceCount int       `json:"place_count"`
+	NewCount   int       `json:"new_count"` // Places not found by any earlier run
+}
+
+// Store is a SQLite database of runs and places
+type Store struct {
+	db *sql.DB
+}
+
+// Open opens the database at path, creating it and its tables when needed
+func Open(path string) (*Store, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	// SQLite allows a single writer, serialize access through one connection
+	db.SetMaxOpenConns(1)
+
+	if _, err := db.Exec("PRAGMA busy_timeout = 5000"); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to configure database: %w", err)
+	}
+	if _, err := db.Exec(schema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create tables: %w", err)
+	}
+	if err := migrate(db); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &Store{db: db}, nil
+}
+
+// migrate updates the tables of databases created by older versions
+func migrate(db *sql.DB) error {
+	// Places stored before they were matched by name as well have no name key
+	var count int
+	err := db.QueryRow("SELECT COUNT(*) FROM pragma_table_info('places') WHERE name = 'name_key'").Scan(&count)
+	if err != nil {
+		return fmt.Errorf("failed to read places table: %w", err)
+	}
+	if count == 0 {
+		if _, err := db.Exec("ALTER TABLE places ADD COLUMN name_key TEXT NOT NULL DEFAULT ''"); err != nil {
+			return fmt.Errorf("failed to add name_key column: %w", err)
+		}
+	}
+	if _, err := db.Exec("CREATE INDEX IF NOT EXISTS places_name_key ON places (name_key)"); err != nil {
+		return fmt.Errorf("failed to create name_key index: %w", err)
+	}
+	return nil
+}
+
+// Close closes the database
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// SaveRun records a run and upserts the places it found in one transaction.
+// It returns the run with its ID and the number of new places filled in.
+func (s *Store) SaveRun(run Run, places []Place) (Run, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return run, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(
+		`INSERT INTO runs (query, params, output_path, started_at, finished_at, place_count, new_count)
+		 VALUES (?, ?, ?, ?, ?, ?, 0)`,
+		run.Query, run.Params, run.OutputPath, run.StartedAt.UTC(), run.FinishedAt.UTC(), len(places),
+	)
+	if err != nil {
+		return run, fmt.Errorf("failed to insert run: %w", err)
+	}
+	run.ID, err = result.LastInsertId()
+	if err != nil {
+		return run, fmt.Errorf("failed to read run id: %w", err)
+	}
+	run.PlaceCount = len(places)
+
+	seen := run.FinishedAt.UTC()
+	for _, place := range places {
+		key, exists, err := storedKey(tx, place)
+		if err != nil {
+			return run, err
+		}
+		if !exists {
+			run.NewCount++
+		}
+		place.Key = key
+
+		var lat, lon sql.NullFloat64
+		if place.HasCoords {
+			lat = sql.NullFloat64{Float64: place.Latitude, Valid: true}
+			lon = sql.NullFloat64{Float64: place.Longitude, Valid: true}
+		}
+
+		// Keep previously known details when this run did not get them
+		_, err = tx.Exec(
+			`INSERT INTO places (place_key, name_key, place_id, name, address, phone, website, hours, google_url,
+			                     latitude, longitude, rating, reviews, first_seen, last_seen, first_run_id, last_run_id)
+			 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			 ON CONFLICT (place_key) DO UPDATE SET
+				name_key   = CASE WHEN excluded.name_key   != '' THEN excluded.name_key   ELSE places.name_key   END,
+				place_id   = CASE WHEN excluded.place_id   != '' THEN excluded.place_id   ELSE places.place_id   END,
+				name       = CASE WHEN excluded.name       != '' THEN excluded.name       ELSE places.name       END,
+				address    = CASE WHEN excluded.address    != '' THEN excluded.address    ELSE places.address    END,
+				phone      = CASE WHEN excluded.phone      != '' THEN excluded.phone      ELSE places.phone      END,
+				website    = CASE WHEN excluded.website    != '' THEN excluded.website    ELSE places.website    END,
+				hours      = CASE WHEN excluded.hours      != '' THEN excluded.hours      ELSE places.hours      END,
+				google_url = CASE WHEN excluded.google_url != '' THEN excluded.google_url ELSE places.google_url END,
+				latitude   = COALESCE(excluded.latitude, places.latitude),
+				longitude  = COALESCE(excluded.longitude, places.longitude),
+				rating     = excluded.rating,
+				reviews    = excluded.reviews,
+				last_seen  = excluded.last_seen,
+				last_run_id = excluded.last_run_id`,
+			place.Key, place.NameKey, place.PlaceID, place.Name, place.Address, place.Phone, place.Website, place.Hours, place.GoogleURL,
+			lat, lon, place.Rating, place.Reviews, seen, seen, run.ID, run.ID,
+		)
+		if err != nil {
+			return run, fmt.Errorf("failed to upsert place %q: %w", place.Name, err)
+		}
+
+		_, err = tx.Exec("INSERT OR IGNORE INTO run_places (run_id, place_key) VALUES (?, ?)", run.ID, place.Key)
+		if err != nil {
+			return run, fmt.Errorf("failed to link place to run: %w", err)
+		}
+
+		_, err = tx.Exec(
+			"INSERT OR REPLACE INTO rating_history (place_key, run_id, observed_at, rating, reviews) VALUES (?, ?, ?, ?, ?)",
+			place.Key, run.ID, seen, place.Rating, place.Reviews,
+		)
+		if err != nil {
+			return run, fmt.Errorf("failed to record rating: %w", err)
+		}
+	}
+
+	if _, err := tx.Exec("UPDATE runs SET new_count = ? WHERE id = ?", run.NewCount, run.ID); err != nil {
+		return run, fmt.Errorf("failed to update run: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return run, fmt.Errorf("failed to commit run: %w", err)
+	}
+	return run, nil
+}
+
+// storedKey returns the key the place is stored under and whether it is
+// stored at all. A place stored by its name and address before its ID was
+// known is moved to its ID key; a place found without its ID is matched by
+// name and address with a place stored under its ID.
+func storedKey(tx *sql.Tx, place Place) (string, bool, error) {
+	var exists bool
+	err := tx.QueryRow("SELECT EXISTS (SELECT 1 FROM places WHERE place_key = ?)", place.Key).Scan(&exists)
+	if err != nil {
+		return "", false, fmt.Errorf("failed to look up place: %w", err)
+	}
+	if exists || place.NameKey == "" {
+		return place.Key, exists, nil
+	}
+
+	if place.NameKey == place.Key {
+		var key string
+		err := tx.QueryRow("SELECT place_key FROM places WHERE name_key = ? ORDER BY first_seen LIMIT 1", place.NameKey).Scan(&key)
+		switch {
+		case err == sql.ErrNoRows:
+			return place.Key, false, nil
+		case err != nil:
+			return "", false, fmt.Errorf("failed to look up place: %w", err)
+		}
+		return key, true, nil
+	}
+
+	err = tx.QueryRow("SELECT EXISTS (SELECT 1 FROM places WHERE place_key = ?)", place.NameKey).Scan(&exists)
+	if err != nil {
+		return "", false, fmt.Errorf("failed to look up place: %w", err)
+	}
+	if !exists {
+		return place.Key, false, nil
+	}
+	for _, table := range []string{"places", "run_places", "rating_history"} {
+		if _, err := tx.Exec("UPDATE "+table+" SET place_key = ? WHERE place_key = ?", place.Key, place.NameKey); err != nil {
+			return "", false, fmt.Errorf("failed to move place to its ID: %w", err)
+		}
+	}
+	return place.Key, true, nil
+}
+
+// Runs returns every recorded run, most recent first
+func (s *Store) Runs() ([]Run, error) {
+	rows, err := s.db.Query(
+		`SELECT id, query, params, output_path, started_at, finished_at, place_count, new_count
+		 FROM runs ORDER BY finished_at DESC, id DESC`,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list runs: %w", err)
+	}
+	defer rows.Close()
+
+	runs := []Run{}
+	for rows.Next() {
+		var run Run
+		err := rows.Scan(&run.ID, &run.Query, &run.Params, &run.OutputPath,
+			&run.StartedAt, &run.FinishedAt, &run.PlaceCount, &run.NewCount)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read run: %w", err)
+		}
+		runs = append(runs, run)
+	}
+	return runs, rows.Err()
+}
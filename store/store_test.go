@@ -0,0 +1,159 @@
+package store
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// openTestStore opens a store in a temporary directory
+func openTestStore(t *testing.T) *Store {
+	t.Helper()
+	s, err := Open(filepath.Join(t.TempDir(), "places.db"))
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+// saveRun records a run of places finished at the given time
+func saveRun(t *testing.T, s *Store, finished time.Time, places ...Place) Run {
+	t.Helper()
+	run, err := s.SaveRun(Run{Query: "abogados", Params: "{}", StartedAt: finished.Add(-time.Minute), FinishedAt: finished}, places)
+	if err != nil {
+		t.Fatalf("SaveRun failed: %v", err)
+	}
+	return run
+}
+
+// placeKeys returns the keys of the stored places
+func placeKeys(t *testing.T, s *Store) []string {
+	t.Helper()
+	rows, err := s.db.Query("SELECT place_key FROM places ORDER BY place_key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	var keys []string
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			t.Fatal(err)
+		}
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+func TestSaveRunMatchesNameAndID(t *testing.T) {
+	const nameKey = "name:bufete|reforma 222"
+	withoutID := Place{Key: nameKey, NameKey: nameKey, Name: "Bufete", Address: "Reforma 222"}
+	withID := Place{Key: "id:0x1:0x2", NameKey: nameKey, PlaceID: "0x1:0x2", Name: "Bufete", Address: "Reforma 222"}
+	start := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name string
+		runs [][]Place
+	}{
+		{"found without its ID first", [][]Place{{withoutID}, {withID}, {withoutID}}},
+		{"found with its ID first", [][]Place{{withID}, {withoutID}, {withID}}},
+	}
+	for _, tt := range tests {
+		s := openTestStore(t)
+		for i, places := range tt.runs {
+			run := saveRun(t, s, start.Add(time.Duration(i)*time.Hour), places...)
+			if want := map[bool]int{true: 1, false: 0}[i == 0]; run.NewCount != want {
+				t.Errorf("%s: run %d found %d new places, want %d", tt.name, i+1, run.NewCount, want)
+			}
+		}
+
+		if keys := placeKeys(t, s); len(keys) != 1 || keys[0] != withID.Key {
+			t.Errorf("%s: stored places %q, want only %q", tt.name, keys, withID.Key)
+		}
+		var history int
+		if err := s.db.QueryRow("SELECT COUNT(*) FROM rating_history WHERE place_key = ?", withID.Key).Scan(&history); err != nil {
+			t.Fatal(err)
+		}
+		if history != len(tt.runs) {
+			t.Errorf("%s: %d rating history rows, want %d", tt.name, history, len(tt.runs))
+		}
+	}
+}
+
+func TestSaveRun(t *testing.T) {
+	s := openTestStore(t)
+	bufete := Place{Key: "id:0x1:0x2", PlaceID: "0x1:0x2", Name: "Bufete", Phone: "55 5208 1234", Rating: 4.5, Reviews: 10}
+	notaria := Place{Key: "id:0x3:0x4", PlaceID: "0x3:0x4", Name: "Notaría", Rating: 4.0, Reviews: 3}
+	first := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	second := first.Add(24 * time.Hour)
+
+	run1 := saveRun(t, s, first, bufete)
+	if run1.NewCount != 1 || run1.PlaceCount != 1 {
+		t.Errorf("first run: %d new of %d places, want 1 of 1", run1.NewCount, run1.PlaceCount)
+	}
+
+	// The second run finds the place again with a new rating and no phone
+	updated := bufete
+	updated.Phone = ""
+	updated.Rating, updated.Reviews = 4.7, 12
+	run2 := saveRun(t, s, second, updated, notaria)
+	if run2.NewCount != 1 || run2.PlaceCount != 2 {
+		t.Errorf("second run: %d new of %d places, want 1 of 2", run2.NewCount, run2.PlaceCount)
+	}
+
+	var phone string
+	var rating float64
+	var firstSeen, lastSeen time.Time
+	var firstRun, lastRun int64
+	err := s.db.QueryRow(
+		"SELECT phone, rating, first_seen, last_seen, first_run_id, last_run_id FROM places WHERE place_key = ?", bufete.Key,
+	).Scan(&phone, &rating, &firstSeen, &lastSeen, &firstRun, &lastRun)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if phone != bufete.Phone {
+		t.Errorf("phone = %q, want the one of the first run %q", phone, bufete.Phone)
+	}
+	if rating != updated.Rating {
+		t.Errorf("rating = %v, want the latest %v", rating, updated.Rating)
+	}
+	if !firstSeen.Equal(first) || !lastSeen.Equal(second) {
+		t.Errorf("seen from %v to %v, want %v to %v", firstSeen, lastSeen, first, second)
+	}
+	if firstRun != run1.ID || lastRun != run2.ID {
+		t.Errorf("seen from run %d to %d, want %d to %d", firstRun, lastRun, run1.ID, run2.ID)
+	}
+
+	rows, err := s.db.Query("SELECT run_id, rating, reviews FROM rating_history WHERE place_key = ? ORDER BY run_id", bufete.Key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	type observation struct {
+		run     int64
+		rating  float64
+		reviews int
+	}
+	var history []observation
+	for rows.Next() {
+		var o observation
+		if err := rows.Scan(&o.run, &o.rating, &o.reviews); err != nil {
+			t.Fatal(err)
+		}
+		history = append(history, o)
+	}
+	want := []observation{{run1.ID, 4.5, 10}, {run2.ID, 4.7, 12}}
+	if len(history) != len(want) || history[0] != want[0] || history[1] != want[1] {
+		t.Errorf("rating history = %+v, want %+v", history, want)
+	}
+
+	runs, err := s.Runs()
+	if err != nil {
+		t.Fatalf("Runs failed: %v", err)
+	}
+	if len(runs) != 2 || runs[0].ID != run2.ID || runs[0].NewCount != 1 {
+		t.Errorf("Runs() = %+v, want the second run first", runs)
+	}
+}
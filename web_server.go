@@ -1,72 +1,196 @@
 package main
 
 import (
-	"bufio"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"log"
 	"net/http"
 	"os"
-	"os/exec"
 	"path/filepath"
-	"regexp"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/gorilla/websocket"
+
+	"mapsscrap/browserpool"
+	"mapsscrap/geo"
+	"mapsscrap/jobs"
+	"mapsscrap/pipeline"
+	"mapsscrap/progress"
+	"mapsscrap/scraper"
+	"mapsscrap/store"
 )
 
 type PipelineRequest struct {
-	Latitude     float64 `json:"latitude"`
-	Longitude    float64 `json:"longitude"`
-	Keyword      string  `json:"keyword"`
-	Radius       float64 `json:"radius"`
-	IncludePhone bool    `json:"includePhone"`
+	Latitude     float64         `json:"latitude"`
+	Longitude    float64         `json:"longitude"`
+	Keyword      string          `json:"keyword"`
+	Radius       float64         `json:"radius"`
+	IncludePhone bool            `json:"includePhone"`
+	Details      bool            `json:"details,omitempty"`    // Leer categoría, estado y horarios de la página de cada lugar
+	SkipClosed   bool            `json:"skipClosed,omitempty"` // Descartar los lugares cerrados, implica details
+	Polygon      json.RawMessage `json:"polygon,omitempty"` // GeoJSON Polygon/MultiPolygon, reemplaza latitud/longitud/radio
 }
 
 type PipelineResponse struct {
-	Success    bool   `json:"success"`
-	Message    string `json:"message"`
-	FileName   string `json:"fileName,omitempty"`
-	FilePath   string `json:"filePath,omitempty"`
-	PlaceCount int    `json:"placeCount,omitempty"`
-	PhoneCount int    `json:"phoneCount,omitempty"`
+	Success     bool   `json:"success"`
+	Message     string `json:"message"`
+	FileName    string `json:"fileName,omitempty"`
+	FilePath    string `json:"filePath,omitempty"`
+	DownloadURL string `json:"downloadUrl,omitempty"`
+	PlaceCount  int    `json:"placeCount,omitempty"`
+	PhoneCount  int    `json:"phoneCount,omitempty"`
 }
 
+// searchZoom es el nivel de zoom de Google Maps de cada punto de búsqueda,
+// el mismo que usa mapsscrap por defecto
+const searchZoom = 15
+
+// resultsDir guarda un directorio de salida por trabajo
+const resultsDir = "results"
+
+// defaultJobWorkers es el número de pipelines ejecutados a la vez si no se
+// indica MAPSSCRAP_JOB_WORKERS. Cada uno abre su propio Chrome.
+const defaultJobWorkers = 2
+
+// jobTTL es el tiempo que se recuerda un trabajo terminado. Sus archivos se
+// conservan en resultsDir.
+const jobTTL = 24 * time.Hour
+
+// jobQueue ejecuta los pipelines pedidos por la interfaz web
+var jobQueue *jobs.Queue
+
+// ProgressMessage es un evento de progreso de un trabajo, enviado a los
+// clientes WebSocket suscritos a él
 type ProgressMessage struct {
-	Type       string `json:"type"`       // "progress", "log", "complete", "error"
-	Message    string `json:"message"`
-	Percentage int    `json:"percentage,omitempty"`
-	Current    int    `json:"current,omitempty"`
-	Total      int    `json:"total,omitempty"`
-	Stage      string `json:"stage,omitempty"` // "scraping", "phones"
+	Type        string `json:"type"` // "progress", "complete", "error", "cancelled"
+	JobID       string `json:"jobId"`
+	Message     string `json:"message,omitempty"`
+	Percentage  int    `json:"percentage,omitempty"`
+	Current     int    `json:"current,omitempty"`
+	Total       int    `json:"total,omitempty"`
+	Stage       string `json:"stage,omitempty"`      // "scraping", "details", "phones"
+	ETASeconds  int    `json:"etaSeconds,omitempty"` // Tiempo restante estimado de la etapa
+	Places      int    `json:"places"`               // Lugares encontrados hasta ahora
+	Phones      int    `json:"phones"`               // Teléfonos encontrados hasta ahora
+	FileName    string `json:"fileName,omitempty"`
+	DownloadURL string `json:"downloadUrl,omitempty"`
 }
 
-var clients = make(map[*websocket.Conn]bool)
-var broadcast = make(chan ProgressMessage)
+// subscriptionWriteTimeout limita lo que se espera a que un cliente reciba un mensaje
+const subscriptionWriteTimeout = 5 * time.Second
+
+// subscriberBuffer es el número de mensajes pendientes de un cliente antes de
+// desconectarlo por lento
+const subscriberBuffer = 16
+
+// subscriber es un cliente WebSocket suscrito a un trabajo. Sus mensajes se
+// escriben en su propia goroutine, así un cliente lento no retrasa a los demás.
+type subscriber struct {
+	conn *websocket.Conn
+	send chan ProgressMessage
+}
+
+// write envía los mensajes del cliente hasta que se cierra send
+func (s *subscriber) write() {
+	for msg := range s.send {
+		s.conn.SetWriteDeadline(time.Now().Add(subscriptionWriteTimeout))
+		if err := s.conn.WriteJSON(msg); err != nil {
+			// handleWebSocket lo da de baja al fallar la lectura
+			s.conn.Close()
+			return
+		}
+	}
+}
+
+var (
+	// subscribers guarda los clientes WebSocket suscritos a cada trabajo
+	subscribers = make(map[string]map[*subscriber]bool)
+	// lastProgress guarda el último mensaje de cada trabajo, que reciben los
+	// clientes al suscribirse
+	lastProgress  = make(map[string]ProgressMessage)
+	subscribersMu sync.Mutex
+)
+
+var broadcast = make(chan ProgressMessage, 100)
 
 func init() {
 	// Manejar mensajes de broadcast
 	go handleMessages()
 }
 
+// handleMessages envía cada mensaje a los clientes suscritos a su trabajo
 func handleMessages() {
-	for {
-		msg := <-broadcast
-		for client := range clients {
-			err := client.WriteJSON(msg)
-			if err != nil {
-				client.Close()
-				delete(clients, client)
+	for msg := range broadcast {
+		subscribersMu.Lock()
+		lastProgress[msg.JobID] = msg
+		for client := range subscribers[msg.JobID] {
+			select {
+			case client.send <- msg:
+			default:
+				// El cliente no lee sus mensajes, desconectarlo
+				log.Printf("Cliente WebSocket lento desconectado del trabajo %s", msg.JobID)
+				delete(subscribers[msg.JobID], client)
+				close(client.send)
+				client.conn.Close()
 			}
 		}
+		subscribersMu.Unlock()
 	}
 }
 
+// jobProgress sigue el avance de un trabajo a partir de los eventos de
+// progreso de su pipeline: la etapa en curso, su estimación de tiempo
+// restante y los lugares y teléfonos encontrados
+type jobProgress struct {
+	mu      sync.Mutex
+	msg     ProgressMessage
+	tracker progress.Tracker
+}
+
+func newJobProgress(jobID string) *jobProgress {
+	return &jobProgress{msg: ProgressMessage{Type: "progress", JobID: jobID}}
+}
+
+// handle registra un evento y publica el progreso que cambia
+func (p *jobProgress) handle(event progress.Event) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if event.Type == progress.Error {
+		log.Printf("⚠️  %s: %s %s", event.Stage, event.Place, event.Message)
+		return
+	}
+	if !p.tracker.Update(event) {
+		return
+	}
+
+	p.msg.Stage = p.tracker.Stage
+	p.msg.Current, p.msg.Total = p.tracker.Done, p.tracker.Total
+	p.msg.Places, p.msg.Phones = p.tracker.Places, p.tracker.Phones
+	p.msg.Percentage = p.tracker.Percentage()
+	p.msg.ETASeconds = int(p.tracker.ETA().Seconds())
+	broadcast <- p.msg
+}
+
+// finish publica el último mensaje del trabajo con su resultado
+func (p *jobProgress) finish(kind string, response PipelineResponse) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	msg := p.msg
+	msg.Type = kind
+	msg.Message = response.Message
+	msg.FileName = response.FileName
+	msg.DownloadURL = response.DownloadURL
+	msg.ETASeconds = 0
+	broadcast <- msg
+}
+
 var upgrader = websocket.Upgrader{
 	CheckOrigin: func(r *http.Request) bool {
 		return true // Permitir conexiones desde cualquier origen (solo para desarrollo)
@@ -74,6 +198,9 @@ var upgrader = websocket.Upgrader{
 }
 
 func main() {
+	jobQueue = jobs.New(jobs.Options{Dir: resultsDir, Workers: jobWorkers()}, runPipelineJob)
+	go pruneJobs()
+
 	r := mux.NewRouter()
 
 	// Servir archivos estáticos
@@ -81,8 +208,14 @@ func main() {
 	
 	// API endpoints
 	r.HandleFunc("/api/execute", handleExecutePipeline).Methods("POST")
+	r.HandleFunc("/api/jobs", handleSubmitJob).Methods("POST")
+	r.HandleFunc("/api/jobs", handleListJobs).Methods("GET")
+	r.HandleFunc("/api/jobs/{id}", handleGetJob).Methods("GET")
+	r.HandleFunc("/api/jobs/{id}", handleCancelJob).Methods("DELETE")
+	r.HandleFunc("/api/jobs/{id}/download/{filename}", handleDownloadJobFile).Methods("GET")
 	r.HandleFunc("/api/download/{filename}", handleDownloadFile).Methods("GET")
 	r.HandleFunc("/api/files", handleListFiles).Methods("GET")
+	r.HandleFunc("/api/selftest", handleSelftest).Methods("GET")
 	r.HandleFunc("/api/ws", handleWebSocket)
 	
 	// Redirigir root a la interfaz web
@@ -122,157 +255,295 @@ func handleExecutePipeline(w http.ResponseWriter, r *http.Request) {
 	log.Printf("Received request: %+v", req)
 
 	// Validar parámetros
-	if req.Latitude == 0 || req.Longitude == 0 || req.Keyword == "" || req.Radius <= 0 {
-		log.Printf("Invalid parameters: lat=%f, lon=%f, keyword=%s, radius=%f", req.Latitude, req.Longitude, req.Keyword, req.Radius)
+	if err := validatePipelineRequest(req); err != nil {
+		log.Printf("Invalid request: %v", err)
 		response := PipelineResponse{
 			Success: false,
-			Message: fmt.Sprintf("Missing or invalid parameters: lat=%f, lon=%f, keyword=%s, radius=%f", req.Latitude, req.Longitude, req.Keyword, req.Radius),
+			Message: err.Error(),
 		}
 		w.WriteHeader(http.StatusBadRequest)
 		json.NewEncoder(w).Encode(response)
 		return
 	}
 
-	// Ejecutar pipeline
-	response := executePipeline(req)
+	// Ejecutar pipeline en la cola de trabajos y esperar su resultado. Los
+	// clientes nuevos deben usar POST /api/jobs, que responde de inmediato.
+	job, err := jobQueue.Submit(req)
+	if err != nil {
+		log.Printf("❌ Error encolando pipeline: %v", err)
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(PipelineResponse{Success: false, Message: err.Error()})
+		return
+	}
+	finished, err := jobQueue.Wait(r.Context(), job.ID)
+	if err != nil {
+		// Nadie más espera este trabajo, cancelarlo
+		log.Printf("Cliente desconectado esperando el trabajo %s, cancelándolo: %v", job.ID, err)
+		jobQueue.Cancel(job.ID)
+		return
+	}
+	response, _ := finished.Result.(PipelineResponse)
 	
 	// Al finalizar el pipeline, enviar respuesta minimalista sin estadísticas
 	responseMinimal := struct {
-		FileName string `json:"fileName"`
+		FileName    string `json:"fileName"`
+		DownloadURL string `json:"downloadUrl,omitempty"`
 	}{
-		FileName: response.FileName,
+		FileName:    response.FileName,
+		DownloadURL: response.DownloadURL,
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(responseMinimal)
 }
 
-func executePipeline(req PipelineRequest) PipelineResponse {
-	log.Printf("🚀 Iniciando pipeline de scraping con parámetros: %+v", req)
-	
-	// Convertir parámetros a strings
-	latStr := strconv.FormatFloat(req.Latitude, 'f', -1, 64)
-	lonStr := strconv.FormatFloat(req.Longitude, 'f', -1, 64)
-	radiusStr := strconv.FormatFloat(req.Radius, 'f', -1, 64)
+// validatePipelineRequest verifica que la petición tenga palabra clave y un
+// área de búsqueda: un polígono válido o latitud, longitud y radio
+func validatePipelineRequest(req PipelineRequest) error {
+	if len(req.Polygon) > 0 {
+		if _, err := geo.ParseArea(req.Polygon); err != nil {
+			return fmt.Errorf("Invalid polygon: %w", err)
+		}
+	}
+	if req.Keyword == "" || (len(req.Polygon) == 0 && (req.Latitude == 0 || req.Longitude == 0 || req.Radius <= 0)) {
+		return fmt.Errorf("Missing or invalid parameters: lat=%f, lon=%f, keyword=%s, radius=%f", req.Latitude, req.Longitude, req.Keyword, req.Radius)
+	}
+	return nil
+}
 
-	log.Printf("📋 Preparando comando con: latitud=%s, longitud=%s, palabra=%s, radio=%s km", latStr, lonStr, req.Keyword, radiusStr)
+// pruneJobs olvida cada hora los trabajos terminados hace más de jobTTL y su
+// último mensaje de progreso
+func pruneJobs() {
+	for range time.Tick(time.Hour) {
+		pruned := jobQueue.Prune(jobTTL)
+		subscribersMu.Lock()
+		for _, job := range pruned {
+			delete(lastProgress, job.ID)
+		}
+		subscribersMu.Unlock()
+		if len(pruned) > 0 {
+			log.Printf("🧹 %d trabajos terminados olvidados", len(pruned))
+		}
+	}
+}
 
-	var cmd *exec.Cmd
-	if req.IncludePhone {
-		log.Printf("📞 Pipeline completo: scraping + extracción de teléfonos")
-		cmd = exec.Command("./pipeline.sh", latStr, lonStr, req.Keyword, radiusStr)
-	} else {
-		log.Printf("📊 Pipeline básico: solo scraping de lugares")
-		cmd = exec.Command("./mapsscrap-1", "--lat", latStr, "--lon", lonStr, "--query", req.Keyword, "--radius", radiusStr)
+// jobWorkers lee de MAPSSCRAP_JOB_WORKERS cuántos pipelines se ejecutan a la vez
+func jobWorkers() int {
+	if workers, err := strconv.Atoi(os.Getenv("MAPSSCRAP_JOB_WORKERS")); err == nil && workers > 0 {
+		return workers
 	}
+	return defaultJobWorkers
+}
 
-	// Agregar timeout de 10 minutos para pipelines con teléfonos, 5 para básico
-	timeout := 5 * time.Minute
-	if req.IncludePhone {
-		timeout = 10 * time.Minute
+// handleSubmitJob encola un pipeline y responde de inmediato con el ID del
+// trabajo, cuyo estado se consulta en GET /api/jobs/{id}
+func handleSubmitJob(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	var req PipelineRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(PipelineResponse{Success: false, Message: "Invalid request body: " + err.Error()})
+		return
+	}
+	if err := validatePipelineRequest(req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(PipelineResponse{Success: false, Message: err.Error()})
+		return
 	}
-	
-	ctx, cancel := context.WithTimeout(context.Background(), timeout)
-	defer cancel()
-	cmd = exec.CommandContext(ctx, cmd.Args[0], cmd.Args[1:]...)
 
-	log.Printf("⏰ Timeout configurado: %.0f minutos", timeout.Minutes())
-	log.Printf("🔄 Ejecutando comando: %v", cmd.Args)
-	log.Printf("⏳ Esto puede tomar varios minutos, especialmente si incluye teléfonos...")
-	
-	// Ejecutar con streaming de output
-	stdout, err := cmd.StdoutPipe()
+	job, err := jobQueue.Submit(req)
 	if err != nil {
-		log.Printf("❌ Error creando pipe: %v", err)
-		return PipelineResponse{
-			Success: false,
-			Message: "Error interno del servidor",
+		log.Printf("❌ Error encolando pipeline: %v", err)
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(PipelineResponse{Success: false, Message: err.Error()})
+		return
+	}
+	log.Printf("📥 Trabajo %s encolado: %+v", job.ID, req)
+
+	w.Header().Set("Location", "/api/jobs/"+job.ID)
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(job)
+}
+
+// handleListJobs devuelve todos los trabajos, los más recientes primero
+func handleListJobs(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	json.NewEncoder(w).Encode(jobQueue.List())
+}
+
+// handleGetJob devuelve el estado de un trabajo y, al terminar, su resultado
+func handleGetJob(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	job, ok := jobQueue.Get(mux.Vars(r)["id"])
+	if !ok {
+		http.Error(w, "Job not found", http.StatusNotFound)
+		return
+	}
+	json.NewEncoder(w).Encode(job)
+}
+
+// handleCancelJob cancela un trabajo. Uno en cola no llega a ejecutarse; uno
+// en ejecución se detiene y conserva los resultados parciales que haya escrito.
+func handleCancelJob(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	job, err := jobQueue.Cancel(mux.Vars(r)["id"])
+	switch {
+	case errors.Is(err, jobs.ErrNotFound):
+		http.Error(w, "Job not found", http.StatusNotFound)
+		return
+	case errors.Is(err, jobs.ErrFinished):
+		w.WriteHeader(http.StatusConflict)
+	default:
+		log.Printf("🛑 Cancelando trabajo %s", job.ID)
+		// Un trabajo en cola no llega a publicar su cancelación
+		if job.Status == jobs.Cancelled {
+			broadcast <- ProgressMessage{Type: "cancelled", JobID: job.ID}
 		}
+		w.WriteHeader(http.StatusAccepted)
 	}
-	
-	stderr, err := cmd.StderrPipe()
+	json.NewEncoder(w).Encode(job)
+}
+
+// handleDownloadJobFile descarga un CSV del directorio de un trabajo
+func handleDownloadJobFile(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	filename := vars["filename"]
+
+	job, ok := jobQueue.Get(vars["id"])
+	if !ok {
+		http.Error(w, "Job not found", http.StatusNotFound)
+		return
+	}
+	if !isValidFilename(filename) {
+		http.Error(w, "Invalid filename", http.StatusBadRequest)
+		return
+	}
+	filePath := filepath.Join(job.Dir, filename)
+	if _, err := os.Stat(filePath); err != nil {
+		http.Error(w, fmt.Sprintf("File not found: %s", filename), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s", filename))
+	w.Header().Set("Content-Type", "text/csv")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	http.ServeFile(w, r, filePath)
+}
+
+// runPipelineJob ejecuta el pipeline de un trabajo en su directorio
+func runPipelineJob(ctx context.Context, job jobs.Job) (any, error) {
+	req := job.Params.(PipelineRequest)
+	log.Printf("🏃 Trabajo %s iniciado en %s", job.ID, job.Dir)
+
+	tracker := newJobProgress(job.ID)
+	response := executePipeline(ctx, req, job.Dir, tracker)
+	if response.FileName != "" {
+		response.DownloadURL = "/api/jobs/" + job.ID + "/download/" + response.FileName
+	}
+	switch {
+	case ctx.Err() != nil:
+		tracker.finish("cancelled", response)
+	case !response.Success:
+		tracker.finish("error", response)
+	default:
+		tracker.finish("complete", response)
+	}
+	if !response.Success {
+		return response, errors.New(response.Message)
+	}
+	return response, nil
+}
+
+// executePipeline ejecuta el pipeline en el proceso del servidor y escribe
+// sus CSV en dir. Al cancelar parent, la etapa en curso se detiene y se
+// devuelve el CSV parcial que haya escrito.
+func executePipeline(parent context.Context, req PipelineRequest, dir string, tracker *jobProgress) PipelineResponse {
+	log.Printf("🚀 Iniciando pipeline de scraping con parámetros: %+v", req)
+
+	selectors, err := scraper.LoadProfile(os.Getenv("MAPSSCRAP_SELECTORS"))
 	if err != nil {
-		log.Printf("❌ Error creando stderr pipe: %v", err)
+		log.Printf("❌ Error cargando el perfil de selectores: %v", err)
 		return PipelineResponse{
 			Success: false,
 			Message: "Error interno del servidor",
 		}
 	}
 
-	if err := cmd.Start(); err != nil {
-		log.Printf("❌ Error iniciando comando: %v", err)
-		return PipelineResponse{
-			Success: false,
-			Message: fmt.Sprintf("Error iniciando pipeline: %v", err),
+	// Los mismos valores por defecto que los flags de mapsscrap
+	params := pipeline.SearchParams{
+		Latitude:   req.Latitude,
+		Longitude:  req.Longitude,
+		Query:      req.Keyword,
+		RadiusKm:   req.Radius,
+		Layout:     geo.LayoutSquare,
+		Zoom:       searchZoom,
+		OverlapPct: 20,
+		MinCellKm:  0.5,
+		Details:    req.Details || req.SkipClosed,
+		SkipClosed: req.SkipClosed,
+		Region:     pipeline.DefaultRegion,
+	}
+	if len(req.Polygon) > 0 {
+		area, err := geo.ParseArea(req.Polygon)
+		if err != nil {
+			return PipelineResponse{
+				Success: false,
+				Message: fmt.Sprintf("Invalid polygon: %v", err),
+			}
 		}
+		params.Area = area
+		log.Printf("🗺️  Búsqueda dentro de %d polígono(s)", len(area.Polygons))
 	}
 
-	log.Printf("✅ Comando iniciado exitosamente, PID: %d", cmd.Process.Pid)
-
-	// Leer output en tiempo real y parsear progreso
-	go func() {
-		scanner := bufio.NewScanner(stdout)
-		progressRegex := regexp.MustCompile(`(\d+)%\s*\|([█\s]+)\|\s*\((\d+)/(\d+)`)
-		phoneRegex := regexp.MustCompile(`🔄 Procesados:\s*(\d+)/(\d+)`)
-		
-		for scanner.Scan() {
-			line := scanner.Text()
-			log.Printf("📤 STDOUT: %s", line)
+	if req.IncludePhone {
+		log.Printf("📞 Pipeline completo: scraping + extracción de teléfonos")
+	} else {
+		log.Printf("📊 Pipeline básico: solo scraping de lugares")
+	}
+	run := pipeline.Pipeline{
+		Params:    params,
+		Phones:    req.IncludePhone,
+		Dir:       dir,
+		Selectors: selectors,
+		DBPath:    os.Getenv("MAPSSCRAP_DB"),
+		Chrome:    os.Getenv("MAPSSCRAP_CHROME"),
+		Progress:  tracker.handle,
+	}
 
-			// Agregar log detallado para errores
-			if err != nil {
-				log.Printf("❌ Error procesando línea: %v", err)
-			}
-			
-			// Detectar barra de progreso del scraper principal
-			if matches := progressRegex.FindStringSubmatch(line); len(matches) > 0 {
-				percentage, _ := strconv.Atoi(matches[1])
-				current, _ := strconv.Atoi(matches[3])
-				total, _ := strconv.Atoi(matches[4])
-				log.Printf("� Progreso scraping: %d%% (%d/%d)", percentage, current, total)
-			}
-			
-			// Detectar progreso de extracción de teléfonos
-			if matches := phoneRegex.FindStringSubmatch(line); len(matches) > 0 {
-				current, _ := strconv.Atoi(matches[1])
-				total, _ := strconv.Atoi(matches[2])
-				percentage := int(float64(current) / float64(total) * 100)
-				
-				// Crear barra visual
-				barLength := 20
-				filled := int(float64(percentage) / 100.0 * float64(barLength))
-				bar := strings.Repeat("█", filled) + strings.Repeat("░", barLength-filled)
-				
-				log.Printf("📞 Extrayendo teléfonos... %d%% |%s| (%d/%d)", percentage, bar, current, total)
-			}
-		}
-	}()
+	// Agregar timeout de 10 minutos para pipelines con teléfonos, 5 para básico y 5 más con detalles
+	timeout := 5 * time.Minute
+	if req.IncludePhone {
+		timeout = 10 * time.Minute
+	}
+	if params.Details {
+		timeout += 5 * time.Minute
+	}
+	
+	ctx, cancel := context.WithTimeout(parent, timeout)
+	defer cancel()
 
-	go func() {
-		scanner := bufio.NewScanner(stderr)
-		progressRegex := regexp.MustCompile(`(\d+)%\s*\|([█\s]+)\|\s*\((\d+)/(\d+)`)
-		
-		for scanner.Scan() {
-			line := scanner.Text()
-			log.Printf("📤 STDERR: %s", line)
-			
-			// También verificar stderr para barras de progreso
-			if matches := progressRegex.FindStringSubmatch(line); len(matches) > 0 {
-				percentage, _ := strconv.Atoi(matches[1])
-				current, _ := strconv.Atoi(matches[3])
-				total, _ := strconv.Atoi(matches[4])
-				log.Printf("📊 Progreso: %d%% (%d/%d)", percentage, current, total)
-			}
-		}
-	}()
+	log.Printf("⏰ Timeout configurado: %.0f minutos", timeout.Minutes())
+	log.Printf("⏳ Esto puede tomar varios minutos, especialmente si incluye teléfonos...")
 
 	// Mostrar progreso cada 30 segundos
 	progressTicker := time.NewTicker(30 * time.Second)
 	defer progressTicker.Stop()
-	
-	done := make(chan error, 1)
+
+	type pipelineOutcome struct {
+		result pipeline.Result
+		err    error
+	}
+	done := make(chan pipelineOutcome, 1)
 	go func() {
-		done <- cmd.Wait()
+		result, err := run.Run(ctx)
+		done <- pipelineOutcome{result, err}
 	}()
 
 	startTime := time.Now()
@@ -286,157 +557,53 @@ func executePipeline(req PipelineRequest) PipelineResponse {
 				log.Printf("📞 Procesando teléfonos - esto puede tomar tiempo adicional...")
 			}
 			
-		case err := <-done:
+		case outcome := <-done:
 			elapsed := time.Since(startTime)
-			log.Printf("🏁 Comando terminado después de %.1f minutos", elapsed.Minutes())
-			
-			if err != nil {
-				log.Printf("❌ Error ejecutando pipeline: %v", err)
-				
-				// Si es timeout, devolver error específico
-				if ctx.Err() == context.DeadlineExceeded {
-					log.Printf("⏰ Pipeline cancelado por timeout (%.0f minutos)", timeout.Minutes())
-					return PipelineResponse{
-						Success: false,
-						Message: fmt.Sprintf("El pipeline tardó más de %.0f minutos y fue cancelado. Prueba con un radio menor.", timeout.Minutes()),
-					}
-				}
-				
-				return PipelineResponse{
-					Success: false,
-					Message: fmt.Sprintf("Error en el pipeline: %v", err),
-				}
-			}
-
-			log.Printf("✅ Pipeline completado exitosamente!")
-			
-			// Buscar archivo generado
-			log.Printf("🔍 Buscando archivo CSV generado...")
-			fileName, filePath := findLatestCSV(req.Keyword, req.Radius)
-			
-			if fileName == "" {
-				log.Printf("❌ No se encontró archivo CSV")
-				return PipelineResponse{
-					Success: false,
-					Message: "El pipeline se ejecutó pero no se generó el archivo CSV esperado",
-				}
-			}
-
-			log.Printf("📄 Archivo encontrado: %s", fileName)
-			
-			// Analizar contenido
-			log.Printf("📊 Analizando contenido del archivo...")
-			placeCount, phoneCount := countPlacesInCSV(filePath, req.IncludePhone)
-			log.Printf("📈 Análisis completado: %d lugares, %d teléfonos", placeCount, phoneCount)
-
-			return PipelineResponse{
-				Success:    true,
-				Message:    "Pipeline ejecutado exitosamente",
-				FileName:   fileName,
-				FilePath:   filePath,
-				PlaceCount: placeCount,
-				PhoneCount: phoneCount,
+			log.Printf("🏁 Pipeline terminado después de %.1f minutos", elapsed.Minutes())
+
+			// El último CSV escrito es el resultado, el de teléfonos si se llegó a escribir
+			result := outcome.result
+			response := PipelineResponse{
+				FilePath:   result.PhonesFile,
+				PlaceCount: result.Places,
+				PhoneCount: result.Phones,
 			}
-		}
-	}
-}
-
-func findLatestCSV(keyword string, radius float64) (string, string) {
-	// Crear patrones de búsqueda
-	sanitizedKeyword := strings.ReplaceAll(keyword, " ", "_")
-	
-	patterns := []string{
-		fmt.Sprintf("prospects_%s_%.1fkm_*.csv", sanitizedKeyword, radius),
-		fmt.Sprintf("prospects_%s_%.0fkm_*.csv", sanitizedKeyword, radius),
-		fmt.Sprintf("prospects_%s_*_with_phones.csv", sanitizedKeyword),
-		fmt.Sprintf("prospects_%s_*.csv", sanitizedKeyword),
-		"prospects_*_with_phones.csv",
-		"prospects_*.csv",
-	}
-	
-	log.Printf("Searching for CSV files with patterns: %v", patterns)
-	
-	var latestFile string
-	var latestTime time.Time
-	
-	for _, pattern := range patterns {
-		matches, err := filepath.Glob(pattern)
-		if err != nil {
-			log.Printf("Error with pattern %s: %v", pattern, err)
-			continue
-		}
-		
-		log.Printf("Pattern %s found %d files: %v", pattern, len(matches), matches)
-		
-		for _, match := range matches {
-			info, err := os.Stat(match)
-			if err != nil {
-				log.Printf("Error getting info for %s: %v", match, err)
-				continue
+			if response.FilePath == "" {
+				response.FilePath = result.PlacesFile
 			}
-			
-			log.Printf("File %s: modified at %v", match, info.ModTime())
-			
-			if info.ModTime().After(latestTime) {
-				latestTime = info.ModTime()
-				latestFile = match
-				log.Printf("New latest file: %s", latestFile)
+			if response.FilePath != "" {
+				response.FileName = filepath.Base(response.FilePath)
 			}
-		}
-		
-		if latestFile != "" {
-			break
-		}
-	}
-	
-	if latestFile != "" {
-		log.Printf("Selected file: %s (path: %s)", filepath.Base(latestFile), latestFile)
-		return filepath.Base(latestFile), latestFile
-	}
-	
-	log.Printf("No CSV file found")
-	return "", ""
-}
 
-func countPlacesInCSV(filePath string, includePhone bool) (int, int) {
-	file, err := os.Open(filePath)
-	if err != nil {
-		return 0, 0
-	}
-	defer file.Close()
-
-	content, err := io.ReadAll(file)
-	if err != nil {
-		return 0, 0
-	}
+			switch {
+			case parent.Err() != nil:
+				// Si fue cancelado, devolver los resultados parciales
+				log.Printf("🛑 Pipeline cancelado después de %.1f minutos", elapsed.Minutes())
+				response.Message = "El pipeline fue cancelado"
+				if response.FileName != "" {
+					log.Printf("📄 Resultados parciales: %s", response.FileName)
+					response.Message = "El pipeline fue cancelado, se conservan los resultados parciales"
+				}
+				return response
 
-	lines := strings.Split(string(content), "\n")
-	placeCount := len(lines) - 1 // Restar header
-	
-	if placeCount < 0 {
-		placeCount = 0
-	}
+			case errors.Is(outcome.err, context.DeadlineExceeded):
+				log.Printf("⏰ Pipeline cancelado por timeout (%.0f minutos)", timeout.Minutes())
+				response.Message = fmt.Sprintf("El pipeline tardó más de %.0f minutos y fue cancelado. Prueba con un radio menor.", timeout.Minutes())
+				return response
 
-	phoneCount := 0
-	if includePhone {
-		// Contar líneas que tienen teléfono en la columna correspondiente
-		for i, line := range lines[1:] { // Skip header
-			if line == "" {
-				continue
-			}
-			fields := strings.Split(line, ",")
-			if len(fields) > 4 && fields[4] != "" && strings.Trim(fields[4], `"`) != "" {
-				phoneCount++
-			}
-			// También verificar ScrapedPhone si existe
-			if len(fields) > 8 && fields[8] != "" && strings.Trim(fields[8], `"`) != "" {
-				phoneCount++
+			case outcome.err != nil:
+				log.Printf("❌ Error ejecutando pipeline: %v", outcome.err)
+				response.Message = fmt.Sprintf("Error en el pipeline: %v", outcome.err)
+				return response
 			}
-			_ = i
+
+			log.Printf("✅ Pipeline completado exitosamente!")
+			log.Printf("📄 Archivo generado: %s (%d lugares, %d teléfonos)", response.FileName, response.PlaceCount, response.PhoneCount)
+			response.Success = true
+			response.Message = "Pipeline ejecutado exitosamente"
+			return response
 		}
 	}
-
-	return placeCount, phoneCount
 }
 
 func handleDownloadFile(w http.ResponseWriter, r *http.Request) {
@@ -452,10 +619,10 @@ func handleDownloadFile(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	
-	filePath := filepath.Join(".", filename)
+	filePath, _, found := locateResultFile(filename)
 	log.Printf("Looking for file at path: %s", filePath)
 	
-	if _, err := os.Stat(filePath); os.IsNotExist(err) {
+	if !found {
 		log.Printf("File not found: %s", filePath)
 		
 		// Buscar archivos similares para debug
@@ -494,19 +661,28 @@ func isValidFilename(filename string) bool {
 func handleListFiles(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	w.Header().Set("Access-Control-Allow-Origin", "*")
-	
+
+	// Con una base de datos configurada, los archivos salen de las corridas registradas
+	if dbPath := os.Getenv("MAPSSCRAP_DB"); dbPath != "" {
+		files, err := listRunFiles(dbPath)
+		if err != nil {
+			log.Printf("❌ Error leyendo corridas de %s: %v", dbPath, err)
+			http.Error(w, "Error listing files", http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(files)
+		return
+	}
+
+	// Archivos del directorio del servidor y de los directorios de los trabajos
 	matches, err := filepath.Glob("prospects_*.csv")
 	if err != nil {
 		http.Error(w, "Error listing files", http.StatusInternalServerError)
 		return
 	}
-	
-	type FileInfo struct {
-		Name     string    `json:"name"`
-		Size     int64     `json:"size"`
-		Modified time.Time `json:"modified"`
-	}
-	
+	jobMatches, _ := filepath.Glob(filepath.Join(resultsDir, "*", "prospects_*.csv"))
+	matches = append(matches, jobMatches...)
+
 	var files []FileInfo
 	for _, match := range matches {
 		info, err := os.Stat(match)
@@ -517,13 +693,180 @@ func handleListFiles(w http.ResponseWriter, r *http.Request) {
 			Name:     filepath.Base(match),
 			Size:     info.Size(),
 			Modified: info.ModTime(),
+			URL:      downloadURL(match),
 		})
 	}
 	
 	json.NewEncoder(w).Encode(files)
 }
 
+// locateResultFile busca un CSV de resultados en el directorio del servidor
+// y, si no está, en los directorios de los trabajos, el más reciente primero.
+// Devuelve su ruta y su URL de descarga.
+func locateResultFile(name string) (string, string, bool) {
+	candidates := []string{name}
+	if matches, err := filepath.Glob(filepath.Join(resultsDir, "*", name)); err == nil {
+		sort.Slice(matches, func(i, j int) bool {
+			return modTime(matches[i]).After(modTime(matches[j]))
+		})
+		candidates = append(candidates, matches...)
+	}
+	for _, path := range candidates {
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			return path, downloadURL(path), true
+		}
+	}
+	return name, "", false
+}
+
+// downloadURL devuelve la URL de descarga de un CSV de resultados
+func downloadURL(path string) string {
+	name := filepath.Base(path)
+	if dir := filepath.Dir(path); filepath.Dir(dir) == resultsDir {
+		return "/api/jobs/" + filepath.Base(dir) + "/download/" + name
+	}
+	return "/api/download/" + name
+}
+
+// modTime devuelve la fecha de modificación de un archivo, o cero si no existe
+func modTime(path string) time.Time {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
+
+// FileInfo describe un archivo de resultados descargable
+type FileInfo struct {
+	Name       string    `json:"name"`
+	Size       int64     `json:"size"`
+	Modified   time.Time `json:"modified"`
+	URL        string    `json:"url"` // Ruta de descarga, la del trabajo para archivos de trabajos
+	RunID      int64     `json:"runId,omitempty"`
+	Query      string    `json:"query,omitempty"`
+	PlaceCount int       `json:"placeCount,omitempty"`
+	NewCount   int       `json:"newCount,omitempty"` // Lugares que ninguna corrida anterior había encontrado
+}
+
+// listRunFiles devuelve los CSV de las corridas guardadas en la base de datos,
+// incluyendo la versión con teléfonos cuando existe
+func listRunFiles(dbPath string) ([]FileInfo, error) {
+	db, err := store.Open(dbPath)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	runs, err := db.Runs()
+	if err != nil {
+		return nil, err
+	}
+
+	files := []FileInfo{}
+	for _, run := range runs {
+		csvPath := strings.TrimSuffix(run.OutputPath, filepath.Ext(run.OutputPath)) + ".csv"
+		phonesPath := strings.TrimSuffix(csvPath, ".csv") + "_with_phones.csv"
+		for _, path := range []string{phonesPath, csvPath} {
+			// Solo se pueden descargar archivos del directorio del servidor o
+			// de los trabajos
+			name := filepath.Base(path)
+			if !isValidFilename(name) {
+				continue
+			}
+			located, url, found := locateResultFile(name)
+			if !found {
+				continue
+			}
+			info, err := os.Stat(located)
+			if err != nil {
+				continue
+			}
+			files = append(files, FileInfo{
+				Name:       name,
+				Size:       info.Size(),
+				Modified:   info.ModTime(),
+				URL:        url,
+				RunID:      run.ID,
+				Query:      run.Query,
+				PlaceCount: run.PlaceCount,
+				NewCount:   run.NewCount,
+			})
+		}
+	}
+	return files, nil
+}
+
+// selftestCacheTTL evita lanzar una búsqueda real en Google Maps en cada
+// consulta del monitoreo
+const selftestCacheTTL = 5 * time.Minute
+
+var (
+	selftestMu     sync.Mutex
+	selftestReport scraper.HealthReport
+	selftestAt     time.Time
+)
+
+// handleSelftest ejecuta la misma verificación que "mapsscrap selftest" y
+// responde 503 si los selectores están degradados. ?fresh=1 ignora el caché.
+func handleSelftest(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	// Una sola verificación a la vez, las demás esperan su resultado
+	selftestMu.Lock()
+	defer selftestMu.Unlock()
+
+	if selftestAt.IsZero() || time.Since(selftestAt) > selftestCacheTTL || r.URL.Query().Get("fresh") == "1" {
+		report, err := runSelftest()
+		if err != nil {
+			log.Printf("❌ Error ejecutando selftest: %v", err)
+			http.Error(w, fmt.Sprintf("Error ejecutando selftest: %v", err), http.StatusInternalServerError)
+			return
+		}
+		selftestReport = report
+		selftestAt = time.Now()
+		log.Printf("🩺 Selftest: %d resultados, saludable=%v", report.Results, report.Healthy)
+	}
+
+	if !selftestReport.Healthy {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(struct {
+		scraper.HealthReport
+		CheckedAt time.Time `json:"checked_at"`
+	}{selftestReport, selftestAt})
+}
+
+// runSelftest ejecuta la verificación de selectores en un navegador propio
+func runSelftest() (scraper.HealthReport, error) {
+	selectors, err := scraper.LoadProfile(os.Getenv("MAPSSCRAP_SELECTORS"))
+	if err != nil {
+		return scraper.HealthReport{}, err
+	}
+
+	pool := browserpool.New(browserpool.Options{Browsers: 1, PagesPerBrowser: 1, Bin: os.Getenv("MAPSSCRAP_CHROME")})
+	defer pool.Close()
+
+	page, err := pool.Acquire(context.Background())
+	if err != nil {
+		return scraper.HealthReport{}, err
+	}
+	defer pool.Release(page)
+
+	return scraper.DefaultHealthCheck().Run(page.Timeout(time.Minute), scraper.DefaultBaseURL, selectors), nil
+}
+
+// handleWebSocket suscribe al cliente al progreso del trabajo indicado en
+// ?job=<id>. Recibe el último mensaje publicado y luego cada actualización.
 func handleWebSocket(w http.ResponseWriter, r *http.Request) {
+	jobID := r.URL.Query().Get("job")
+	job, ok := jobQueue.Get(jobID)
+	if !ok {
+		http.Error(w, "Job not found", http.StatusNotFound)
+		return
+	}
+
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		log.Printf("Error upgrading to websocket: %v", err)
@@ -532,16 +875,37 @@ func handleWebSocket(w http.ResponseWriter, r *http.Request) {
 	defer conn.Close()
 
 	// Registrar cliente
-	clients[conn] = true
-	log.Printf("Cliente WebSocket conectado. Total: %d", len(clients))
+	client := &subscriber{conn: conn, send: make(chan ProgressMessage, subscriberBuffer)}
+	subscribersMu.Lock()
+	if subscribers[jobID] == nil {
+		subscribers[jobID] = make(map[*subscriber]bool)
+	}
+	subscribers[jobID][client] = true
+	msg, published := lastProgress[jobID]
+	if !published {
+		msg = ProgressMessage{Type: "progress", JobID: jobID, Message: string(job.Status)}
+	}
+	client.send <- msg
+	log.Printf("Cliente WebSocket suscrito al trabajo %s. Total: %d", jobID, len(subscribers[jobID]))
+	subscribersMu.Unlock()
+	go client.write()
 
 	// Mantener conexión activa
 	for {
 		_, _, err := conn.ReadMessage()
 		if err != nil {
 			log.Printf("Cliente WebSocket desconectado: %v", err)
-			delete(clients, conn)
 			break
 		}
 	}
-}
\ No newline at end of file
+
+	subscribersMu.Lock()
+	if subscribers[jobID][client] {
+		delete(subscribers[jobID], client)
+		close(client.send)
+	}
+	if len(subscribers[jobID]) == 0 {
+		delete(subscribers, jobID)
+	}
+	subscribersMu.Unlock()
+}
@@ -0,0 +1,107 @@
+package website
+
+import (
+	"bufio"
+	"regexp"
+	"strings"
+)
+
+// robots holds the rules of a robots.txt that apply to the crawler
+type robots struct {
+	rules []robotsRule
+}
+
+// robotsRule allows or disallows the paths matching its pattern
+type robotsRule struct {
+	allow   bool
+	length  int // Length of the pattern, the longest matching rule wins
+	pattern *regexp.Regexp
+}
+
+// parseRobots reads the group of a robots.txt for the agent, or the group of
+// every agent ("*") when the file has none for it. Only Allow and Disallow
+// lines are used; patterns may contain * and end with $.
+func parseRobots(text, agent string) robots {
+	agent = strings.ToLower(agent)
+
+	var specific, wildcard []robotsRule
+	var current []*[]robotsRule
+	inAgents := false // Consecutive User-agent lines share a group
+
+	scanner := bufio.NewScanner(strings.NewReader(text))
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		key, value, found := strings.Cut(line, ":")
+		if !found {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+
+		switch key {
+		case "user-agent":
+			if !inAgents {
+				current = nil
+			}
+			inAgents = true
+			name := strings.ToLower(value)
+			switch {
+			case name == "*":
+				current = append(current, &wildcard)
+			case name != "" && strings.Contains(agent, name):
+				current = append(current, &specific)
+			}
+		case "allow", "disallow":
+			inAgents = false
+			// An empty Disallow allows everything
+			if value == "" {
+				continue
+			}
+			rule := robotsRule{allow: key == "allow", length: len(value), pattern: robotsPattern(value)}
+			for _, group := range current {
+				*group = append(*group, rule)
+			}
+		default:
+			inAgents = false
+		}
+	}
+
+	if specific != nil {
+		return robots{rules: specific}
+	}
+	return robots{rules: wildcard}
+}
+
+// robotsPattern compiles a path pattern of robots.txt
+func robotsPattern(value string) *regexp.Regexp {
+	anchored := strings.HasSuffix(value, "$")
+	value = strings.TrimSuffix(value, "$")
+
+	parts := strings.Split(value, "*")
+	for i, part := range parts {
+		parts[i] = regexp.QuoteMeta(part)
+	}
+	pattern := "^" + strings.Join(parts, ".*")
+	if anchored {
+		pattern += "$"
+	}
+	return regexp.MustCompile(pattern)
+}
+
+// allowed reports whether the path, with its query, may be crawled. The
+// longest matching rule decides, Allow winning ties.
+func (r robots) allowed(path string) bool {
+	allow, length := true, -1
+	for _, rule := range r.rules {
+		if !rule.pattern.MatchString(path) {
+			continue
+		}
+		if rule.length > length || (rule.length == length && rule.allow) {
+			allow, length = rule.allow, rule.length
+		}
+	}
+	return allow
+}
+
+// disallowAll is used when the robots.txt of a site cannot be read
+var disallowAll = robots{rules: []robotsRule{{allow: false, length: 1, pattern: regexp.MustCompile("^/")}}}
@@ -0,0 +1,410 @@
+// Package website crawls the websites of places for the contact details that
+// Google Maps does not show: emails, phone and WhatsApp links and the profiles
+// of the business on social networks.
+package website
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Default limits of a crawl
+const (
+	DefaultMaxPages = 10
+	DefaultMaxBytes = 1 << 20
+	DefaultTimeout  = 15 * time.Second
+)
+
+// Agent is the name of the crawler matched against the User-agent lines of
+// robots.txt files
+const Agent = "mapsscrap"
+
+const userAgent = "Mozilla/5.0 (compatible; " + Agent + "/1.0)"
+
+// Options limit what a crawl reads from a site
+type Options struct {
+	MaxPages int           // Pages fetched per site, DefaultMaxPages when 0
+	MaxDepth int           // Links followed away from the home page, 0 only reads the home page
+	MaxBytes int64         // Bytes read per page, DefaultMaxBytes when 0
+	Timeout  time.Duration // Of every request, DefaultTimeout when 0
+}
+
+// Contacts are the contact details found on a site, without duplicates and
+// in the order they were found
+type Contacts struct {
+	Emails    []string `json:"emails,omitempty"`
+	Phones    []string `json:"phones,omitempty"`   // Numbers of tel: links, as written
+	WhatsApp  []string `json:"whatsapp,omitempty"` // wa.me and api.whatsapp.com links
+	Facebook  []string `json:"facebook,omitempty"`
+	Instagram []string `json:"instagram,omitempty"`
+	LinkedIn  []string `json:"linkedin,omitempty"`
+	TikTok    []string `json:"tiktok,omitempty"`
+}
+
+// Empty reports whether no contact details were found
+func (c Contacts) Empty() bool {
+	return len(c.Emails)+len(c.Phones)+len(c.WhatsApp)+len(c.Facebook)+len(c.Instagram)+len(c.LinkedIn)+len(c.TikTok) == 0
+}
+
+// Crawler reads the contact details of websites. It is safe for concurrent
+// use.
+type Crawler struct {
+	client  *http.Client
+	options Options
+}
+
+// New returns a crawler with the given limits
+func New(options Options) *Crawler {
+	if options.MaxPages <= 0 {
+		options.MaxPages = DefaultMaxPages
+	}
+	if options.MaxBytes <= 0 {
+		options.MaxBytes = DefaultMaxBytes
+	}
+	if options.Timeout <= 0 {
+		options.Timeout = DefaultTimeout
+	}
+	return &Crawler{
+		client:  &http.Client{Timeout: options.Timeout},
+		options: options,
+	}
+}
+
+// link is a page to crawl and its distance in links from the home page
+type link struct {
+	url   *url.URL
+	depth int
+}
+
+// Crawl reads the home page of the site and follows its links to other pages
+// of the same site, contact pages first, until MaxPages pages are read. Pages
+// disallowed by the site's robots.txt are not fetched. An error is returned
+// only when the home page cannot be read.
+func (c *Crawler) Crawl(ctx context.Context, site string) (Contacts, error) {
+	var contacts Contacts
+	home, err := siteURL(site)
+	if err != nil {
+		return contacts, err
+	}
+	rules := c.robots(ctx, home)
+
+	queue := []link{{url: home}}
+	seen := map[string]bool{pageKey(home): true}
+	for fetched := 0; len(queue) > 0 && fetched < c.options.MaxPages; {
+		next := queue[0]
+		queue = queue[1:]
+
+		if !rules.allowed(next.url.RequestURI()) {
+			if next.depth == 0 {
+				return contacts, fmt.Errorf("%s is disallowed by robots.txt", next.url)
+			}
+			continue
+		}
+		page, final, err := c.fetch(ctx, next.url)
+		fetched++
+		if err != nil {
+			if next.depth == 0 {
+				return contacts, err
+			}
+			continue
+		}
+		// The home page may redirect, e.g. to https or www
+		if next.depth == 0 {
+			home = final
+		}
+
+		links := contacts.read(page, final)
+		if next.depth >= c.options.MaxDepth {
+			continue
+		}
+		var contactPages, otherPages []link
+		for _, target := range links {
+			key := pageKey(target)
+			if seen[key] || !sameSite(target, home) || !isPage(target) {
+				continue
+			}
+			seen[key] = true
+			if contactPagePattern.MatchString(target.Path) {
+				contactPages = append(contactPages, link{url: target, depth: next.depth + 1})
+			} else {
+				otherPages = append(otherPages, link{url: target, depth: next.depth + 1})
+			}
+		}
+		queue = append(append(contactPages, queue...), otherPages...)
+	}
+	return contacts, nil
+}
+
+// robots reads the robots.txt of the site. Sites without one may be crawled
+// entirely, while an unreachable one forbids the whole site.
+func (c *Crawler) robots(ctx context.Context, home *url.URL) robots {
+	robotsURL := &url.URL{Scheme: home.Scheme, Host: home.Host, Path: "/robots.txt"}
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, robotsURL.String(), nil)
+	if err != nil {
+		return disallowAll
+	}
+	request.Header.Set("User-Agent", userAgent)
+
+	response, err := c.client.Do(request)
+	if err != nil {
+		return disallowAll
+	}
+	defer response.Body.Close()
+
+	switch {
+	case response.StatusCode >= 500:
+		return disallowAll
+	case response.StatusCode >= 400:
+		return robots{}
+	}
+	body, err := io.ReadAll(io.LimitReader(response.Body, c.options.MaxBytes))
+	if err != nil {
+		return disallowAll
+	}
+	return parseRobots(string(body), Agent)
+}
+
+// fetch reads an HTML page and returns it with its URL after redirects
+func (c *Crawler) fetch(ctx context.Context, page *url.URL) (string, *url.URL, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, page.String(), nil)
+	if err != nil {
+		return "", nil, err
+	}
+	request.Header.Set("User-Agent", userAgent)
+	request.Header.Set("Accept", "text/html,application/xhtml+xml")
+
+	response, err := c.client.Do(request)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to fetch %s: %w", page, err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return "", nil, fmt.Errorf("%s returned %s", page, response.Status)
+	}
+	if contentType := response.Header.Get("Content-Type"); contentType != "" && !strings.Contains(contentType, "html") {
+		return "", nil, fmt.Errorf("%s is not an HTML page (%s)", page, contentType)
+	}
+	body, err := io.ReadAll(io.LimitReader(response.Body, c.options.MaxBytes))
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to read %s: %w", page, err)
+	}
+	return string(body), response.Request.URL, nil
+}
+
+var (
+	hrefPattern        = regexp.MustCompile(`(?i)\bhref\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s"'>]+))`)
+	emailPattern       = regexp.MustCompile(`[a-zA-Z0-9._%+-]+@[a-zA-Z0-9-]+(?:\.[a-zA-Z0-9-]+)*\.[a-zA-Z]{2,}`)
+	contactPagePattern = regexp.MustCompile(`(?i)contact|about|nosotros|acerca|quienes|ubicaci`)
+)
+
+// fileExtensions are the extensions of links to files other than pages, also
+// matched by the email pattern in names such as logo@2x.png
+var fileExtensions = map[string]bool{
+	"png": true, "jpg": true, "jpeg": true, "gif": true, "svg": true, "webp": true, "ico": true,
+	"css": true, "js": true, "pdf": true, "zip": true, "mp4": true, "mp3": true, "doc": true, "docx": true, "xls": true, "xlsx": true,
+}
+
+// read adds the contact details of an HTML page to the contacts and returns
+// the http and https links of the page, resolved against its URL
+func (c *Contacts) read(page string, base *url.URL) []*url.URL {
+	text := html.UnescapeString(page)
+	for _, email := range emailPattern.FindAllString(text, -1) {
+		email = strings.ToLower(email)
+		if !fileExtensions[email[strings.LastIndex(email, ".")+1:]] {
+			c.Emails = appendUnique(c.Emails, email)
+		}
+	}
+
+	var links []*url.URL
+	for _, match := range hrefPattern.FindAllStringSubmatch(page, -1) {
+		href := strings.TrimSpace(html.UnescapeString(match[1] + match[2] + match[3]))
+		if number, found := cutPrefixFold(href, "tel:"); found {
+			if unescaped, err := url.PathUnescape(number); err == nil {
+				number = unescaped
+			}
+			if number = strings.TrimSpace(number); number != "" {
+				c.Phones = appendUnique(c.Phones, number)
+			}
+			continue
+		}
+
+		target, err := base.Parse(href)
+		if err != nil {
+			continue
+		}
+		target.Host = strings.ToLower(target.Host)
+		host := strings.TrimPrefix(target.Host, "www.")
+		switch {
+		case target.Scheme == "whatsapp", host == "wa.me", host == "api.whatsapp.com", host == "web.whatsapp.com":
+			c.WhatsApp = appendUnique(c.WhatsApp, target.String())
+		case target.Scheme != "http" && target.Scheme != "https":
+		case onDomain(host, "facebook.com"), onDomain(host, "fb.com"):
+			c.Facebook = appendUnique(c.Facebook, facebookProfile(target))
+		case onDomain(host, "instagram.com"):
+			c.Instagram = appendUnique(c.Instagram, instagramProfile(target))
+		case onDomain(host, "linkedin.com"):
+			c.LinkedIn = appendUnique(c.LinkedIn, linkedInProfile(target))
+		case onDomain(host, "tiktok.com"):
+			c.TikTok = appendUnique(c.TikTok, tikTokProfile(target))
+		default:
+			links = append(links, target)
+		}
+	}
+	return links
+}
+
+// facebookPages are the first path segments of Facebook links that are not
+// profiles, such as share buttons
+var facebookPages = map[string]bool{
+	"sharer": true, "sharer.php": true, "share": true, "share.php": true, "dialog": true, "plugins": true,
+	"tr": true, "login": true, "login.php": true, "watch": true, "hashtag": true, "events": true, "help": true,
+}
+
+// facebookProfile returns the canonical URL of a Facebook page, or an empty
+// string for other Facebook links
+func facebookProfile(target *url.URL) string {
+	segments := pathSegments(target)
+	switch {
+	case len(segments) == 0:
+		return ""
+	case strings.EqualFold(segments[0], "profile.php"):
+		if id := target.Query().Get("id"); id != "" {
+			return "https://www.facebook.com/profile.php?id=" + url.QueryEscape(id)
+		}
+		return ""
+	case facebookPages[strings.ToLower(segments[0])]:
+		return ""
+	}
+	return "https://www.facebook.com/" + segments[0]
+}
+
+// instagramPages are the first path segments of Instagram links to posts and
+// other pages that are not profiles
+var instagramPages = map[string]bool{
+	"p": true, "reel": true, "reels": true, "tv": true, "explore": true, "stories": true, "accounts": true, "share": true,
+}
+
+// instagramProfile returns the canonical URL of an Instagram profile, or an
+// empty string for other Instagram links
+func instagramProfile(target *url.URL) string {
+	segments := pathSegments(target)
+	if len(segments) == 0 || instagramPages[strings.ToLower(segments[0])] {
+		return ""
+	}
+	return "https://www.instagram.com/" + segments[0]
+}
+
+// linkedInProfile returns the canonical URL of a LinkedIn company or member
+// profile, or an empty string for other LinkedIn links
+func linkedInProfile(target *url.URL) string {
+	segments := pathSegments(target)
+	if len(segments) < 2 {
+		return ""
+	}
+	switch kind := strings.ToLower(segments[0]); kind {
+	case "company", "in", "school", "showcase":
+		return "https://www.linkedin.com/" + kind + "/" + segments[1]
+	}
+	return ""
+}
+
+// tikTokProfile returns the canonical URL of a TikTok profile, or an empty
+// string for other TikTok links
+func tikTokProfile(target *url.URL) string {
+	segments := pathSegments(target)
+	if len(segments) == 0 || !strings.HasPrefix(segments[0], "@") || len(segments[0]) == 1 {
+		return ""
+	}
+	return "https://www.tiktok.com/" + segments[0]
+}
+
+// pathSegments returns the non empty segments of the URL path
+func pathSegments(target *url.URL) []string {
+	var segments []string
+	for _, segment := range strings.Split(target.Path, "/") {
+		if segment != "" {
+			segments = append(segments, segment)
+		}
+	}
+	return segments
+}
+
+// siteURL reads the website of a place, written by Google Maps without its
+// scheme, e.g. "bufetereforma.example.mx"
+func siteURL(site string) (*url.URL, error) {
+	site = strings.TrimSpace(site)
+	if !strings.Contains(site, "://") {
+		site = "https://" + site
+	}
+	home, err := url.Parse(site)
+	if err != nil || home.Host == "" || (home.Scheme != "http" && home.Scheme != "https") {
+		return nil, fmt.Errorf("invalid website %q", site)
+	}
+	home.Host = strings.ToLower(home.Host)
+	home.Fragment = ""
+	if home.Path == "" {
+		home.Path = "/"
+	}
+	return home, nil
+}
+
+// sameSite reports whether the page is on the host of the home page, with or
+// without www.
+func sameSite(page, home *url.URL) bool {
+	return strings.TrimPrefix(page.Host, "www.") == strings.TrimPrefix(home.Host, "www.")
+}
+
+// isPage reports whether the link may lead to an HTML page
+func isPage(page *url.URL) bool {
+	if page.Scheme != "http" && page.Scheme != "https" {
+		return false
+	}
+	extension := strings.ToLower(strings.TrimPrefix(path.Ext(page.Path), "."))
+	return !fileExtensions[extension]
+}
+
+// pageKey identifies a page regardless of its fragment and of www.
+func pageKey(page *url.URL) string {
+	key := *page
+	key.Fragment = ""
+	key.Host = strings.TrimPrefix(key.Host, "www.")
+	if key.Path == "" {
+		key.Path = "/"
+	}
+	return key.String()
+}
+
+// onDomain reports whether the host is the domain or one of its subdomains
+func onDomain(host, domain string) bool {
+	return host == domain || strings.HasSuffix(host, "."+domain)
+}
+
+// cutPrefixFold is strings.CutPrefix ignoring case
+func cutPrefixFold(s, prefix string) (string, bool) {
+	if len(s) >= len(prefix) && strings.EqualFold(s[:len(prefix)], prefix) {
+		return s[len(prefix):], true
+	}
+	return s, false
+}
+
+// appendUnique appends the value unless it is empty or already listed
+func appendUnique(list []string, value string) []string {
+	if value == "" {
+		return list
+	}
+	for _, existing := range list {
+		if existing == value {
+			return list
+		}
+	}
+	return append(list, value)
+}
@@ -0,0 +1,158 @@
+package website
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+// sitePages is a small business website. The private page is disallowed by
+// robots.txt and the team page is two links away from the home page.
+var sitePages = map[string]string{
+	"/robots.txt": "User-agent: *\nDisallow: /privado\n\nUser-agent: OtherBot\nDisallow: /\n",
+	"/": `<html><body>
+		<img src="/img/logo@2x.png">
+		<a href="/blog">Blog</a>
+		<a href="/privado">Intranet</a>
+		<a href='/contacto'>Contacto</a>
+		<a href="/folleto.pdf">Folleto</a>
+		<a href="https://otro.example.com/">Partner</a>
+		<a href="https://www.facebook.com/sharer/sharer.php?u=https%3A%2F%2Fbufete.example.mx">Compartir</a>
+		<a href="https://www.facebook.com/BufeteReforma/?ref=page">Facebook</a>
+		<a href="https://instagram.com/bufete.reforma/">Instagram</a>
+		<p>Escríbenos a info&#64;bufete.example.mx</p>
+	</body></html>`,
+	"/contacto": `<html><body>
+		<a href="mailto:Citas@Bufete.example.mx?subject=Cita">Citas@Bufete.example.mx</a>
+		<a href="tel:+52%2055%205208%201234">55 5208 1234</a>
+		<a href="https://wa.me/5215552081234?text=Hola">WhatsApp</a>
+		<a href="https://mx.linkedin.com/company/bufete-reforma/about">LinkedIn</a>
+		<a href="https://www.tiktok.com/@bufetereforma?lang=es">TikTok</a>
+		<a href="https://www.instagram.com/p/Cx1/">Publicación</a>
+	</body></html>`,
+	"/blog":        `<html><body><a href="/blog/equipo">Equipo</a><a href="#top">Arriba</a></body></html>`,
+	"/blog/equipo": `<html><body>equipo@bufete.example.mx</body></html>`,
+	"/privado":     `<html><body>secreto@bufete.example.mx</body></html>`,
+}
+
+// newSite serves sitePages and records the paths requested
+func newSite(t *testing.T) (*httptest.Server, func() []string) {
+	var mu sync.Mutex
+	var requested []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requested = append(requested, r.URL.Path)
+		mu.Unlock()
+
+		page, ok := sitePages[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		if r.URL.Path == "/robots.txt" {
+			w.Header().Set("Content-Type", "text/plain")
+		} else {
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		}
+		w.Write([]byte(page))
+	}))
+	t.Cleanup(server.Close)
+	return server, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), requested...)
+	}
+}
+
+func TestCrawl(t *testing.T) {
+	server, requested := newSite(t)
+
+	contacts, err := New(Options{MaxDepth: 1}).Crawl(context.Background(), server.URL)
+	if err != nil {
+		t.Fatalf("Crawl failed: %v", err)
+	}
+
+	want := Contacts{
+		Emails:    []string{"info@bufete.example.mx", "citas@bufete.example.mx"},
+		Phones:    []string{"+52 55 5208 1234"},
+		WhatsApp:  []string{"https://wa.me/5215552081234?text=Hola"},
+		Facebook:  []string{"https://www.facebook.com/BufeteReforma"},
+		Instagram: []string{"https://www.instagram.com/bufete.reforma"},
+		LinkedIn:  []string{"https://www.linkedin.com/company/bufete-reforma"},
+		TikTok:    []string{"https://www.tiktok.com/@bufetereforma"},
+	}
+	if !reflect.DeepEqual(contacts, want) {
+		t.Errorf("Crawl() = %+v, want %+v", contacts, want)
+	}
+
+	// The contact page is read first, the disallowed page, the file and the
+	// page beyond MaxDepth are not requested
+	wantRequests := []string{"/robots.txt", "/", "/contacto", "/blog"}
+	if got := requested(); !reflect.DeepEqual(got, wantRequests) {
+		t.Errorf("requested %v, want %v", got, wantRequests)
+	}
+}
+
+func TestCrawlLimits(t *testing.T) {
+	server, requested := newSite(t)
+
+	// Only the home page and its contact page fit in two pages
+	if _, err := New(Options{MaxPages: 2, MaxDepth: 3}).Crawl(context.Background(), server.URL); err != nil {
+		t.Fatalf("Crawl failed: %v", err)
+	}
+	if got, want := requested(), []string{"/robots.txt", "/", "/contacto"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("requested %v, want %v", got, want)
+	}
+
+	contacts, err := New(Options{MaxDepth: 3}).Crawl(context.Background(), server.URL)
+	if err != nil {
+		t.Fatalf("Crawl failed: %v", err)
+	}
+	if want := []string{"info@bufete.example.mx", "citas@bufete.example.mx", "equipo@bufete.example.mx"}; !reflect.DeepEqual(contacts.Emails, want) {
+		t.Errorf("emails = %v, want %v", contacts.Emails, want)
+	}
+
+	if _, err := New(Options{}).Crawl(context.Background(), server.URL+"/privado"); err == nil {
+		t.Error("expected an error for a home page disallowed by robots.txt")
+	}
+	if _, err := New(Options{}).Crawl(context.Background(), server.URL+"/no-existe"); err == nil {
+		t.Error("expected an error for a missing home page")
+	}
+}
+
+func TestParseRobots(t *testing.T) {
+	text := `# Comments and unknown lines are ignored
+Sitemap: https://example.com/sitemap.xml
+
+User-agent: *
+Disallow: /admin
+Allow: /admin/public
+Disallow: /*.php$
+
+User-agent: Googlebot
+User-agent: mapsscrap
+Disallow: /search
+Disallow:
+`
+	tests := []struct {
+		agent   string
+		path    string
+		allowed bool
+	}{
+		{"other", "/", true},
+		{"other", "/admin/users", false},
+		{"other", "/admin/public/page", true},
+		{"other", "/index.php", false},
+		{"other", "/index.php?page=2", true},
+		{"mapsscrap", "/admin/users", true},
+		{"mapsscrap", "/search?q=abogado", false},
+	}
+	for _, tt := range tests {
+		if got := parseRobots(text, tt.agent).allowed(tt.path); got != tt.allowed {
+			t.Errorf("allowed(%q) for %s = %v, want %v", tt.path, tt.agent, got, tt.allowed)
+		}
+	}
+}